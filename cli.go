@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"main.go/client"
+	"main.go/config"
+	"main.go/server"
+	"main.go/store"
+)
+
+const cliUsage = `Usage: videoparty <command> [flags]
+
+Commands:
+  serve                              run the server (default)
+  config print [-format yaml|json]   show the effective configuration
+  rooms list                         list rooms
+  rooms create -url URL [-name N]    create a room
+  rooms close [-token T] <roomID>    close a room and disconnect everyone
+  chat tail <roomID>                 stream a room's chat to the terminal
+  export [-o FILE]                   write all rooms as JSON
+  import <FILE|->                    load rooms from JSON
+
+Commands other than serve and chat talk to a running server (-server, or
+$VIDEOPARTY_SERVER) or, with -data, directly to the server's room file.
+Run "videoparty <command> -h" for command flags.
+`
+
+func runCLI(args []string) error {
+	if len(args) == 0 {
+		return serveCmd(nil)
+	}
+	// "videoparty -addr :9000" — флаги без команды относятся к serve
+	if strings.HasPrefix(args[0], "-") && !isHelpFlag(args[0]) {
+		return serveCmd(args)
+	}
+
+	switch args[0] {
+	case "serve":
+		return serveCmd(args[1:])
+	case "config":
+		return configCmd(args[1:])
+	case "rooms":
+		return roomsCmd(args[1:])
+	case "chat":
+		return chatCmd(args[1:])
+	case "export":
+		return exportCmd(args[1:])
+	case "import":
+		return importCmd(args[1:])
+	case "help":
+		fmt.Print(cliUsage)
+		return nil
+	}
+	if isHelpFlag(args[0]) {
+		fmt.Print(cliUsage)
+		return nil
+	}
+	fmt.Fprint(os.Stderr, cliUsage)
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+func serveCmd(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	cfg, err := config.Load(fs, args)
+	if err != nil {
+		return err
+	}
+	return serve(cfg)
+}
+
+func configCmd(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: videoparty config print [-format yaml|json] [serve flags]")
+	}
+
+	fs := flag.NewFlagSet("config print", flag.ExitOnError)
+	format := fs.String("format", "yaml", "output format: yaml or json")
+	cfg, err := config.Load(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	return cfg.Write(os.Stdout, *format)
+}
+
+func roomsCmd(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: videoparty rooms list|create|close")
+	}
+
+	fs := flag.NewFlagSet("rooms "+args[0], flag.ExitOnError)
+	be := backendFlags(fs)
+
+	switch args[0] {
+	case "list":
+		fs.Parse(args[1:])
+		list, err := be().List()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tOWNER\tCREATED\tVIDEO")
+		for _, r := range list {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+				r.ID, r.Name, r.Owner, r.CreatedAt.Format("2006-01-02 15:04"), r.VideoURL)
+		}
+		return tw.Flush()
+
+	case "create":
+		videoURL := fs.String("url", "", "video URL (required)")
+		name := fs.String("name", "", "room name")
+		owner := fs.String("owner", "cli", "room owner name")
+		fs.Parse(args[1:])
+		if *videoURL == "" {
+			return errors.New("-url is required")
+		}
+		r, token, err := be().Create(*videoURL, *name, *owner)
+		if err != nil {
+			return err
+		}
+		fmt.Println(r.ID)
+		// Секрет владельца — в stderr, чтобы stdout оставался только ID
+		if token != "" {
+			fmt.Fprintln(os.Stderr, "owner token:", token)
+		}
+		return nil
+
+	case "close":
+		token := fs.String("token", "", "owner token printed by rooms create (not needed with -data)")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			return errors.New("usage: videoparty rooms close [flags] <roomID>")
+		}
+		return be().Close(fs.Arg(0), *token)
+	}
+	return fmt.Errorf("unknown rooms command %q", args[0])
+}
+
+func chatCmd(args []string) error {
+	if len(args) == 0 || args[0] != "tail" {
+		return errors.New("usage: videoparty chat tail [flags] <roomID>")
+	}
+
+	fs := flag.NewFlagSet("chat tail", flag.ExitOnError)
+	serverURL := fs.String("server", defaultServer(), "server URL")
+	username := fs.String("username", "chat-tail", "name to join the room under")
+	fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		return errors.New("usage: videoparty chat tail [flags] <roomID>")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := client.New(*serverURL, fs.Arg(0), *username)
+	c.OnChat = func(user, text string) {
+		fmt.Printf("%s <%s> %s\n", time.Now().Format("15:04:05"), user, text)
+	}
+	c.OnDisconnect = func(err error) {
+		fmt.Fprintln(os.Stderr, "disconnected:", err)
+	}
+	err := c.Run(ctx)
+	if errors.Is(err, context.Canceled) {
+		c.Close()
+		return nil
+	}
+	return err
+}
+
+func exportCmd(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	be := backendFlags(fs)
+	out := fs.String("o", "", "output file (default stdout)")
+	fs.Parse(args)
+
+	list, err := be().Export()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*out, data, 0o644)
+}
+
+func importCmd(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	be := backendFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: videoparty import [flags] <FILE|->")
+	}
+
+	var data []byte
+	var err error
+	if fs.Arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+
+	var list []store.Room
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	res, err := be().Import(list)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported %d rooms, skipped %d\n", res.Imported, res.Skipped)
+	for _, e := range res.Rejected {
+		fmt.Fprintf(os.Stderr, "rejected %s: %s\n", e.ID, e.Error)
+	}
+	return nil
+}
+
+func defaultServer() string {
+	if s := os.Getenv("VIDEOPARTY_SERVER"); s != "" {
+		return s
+	}
+	return "http://localhost:8080"
+}
+
+// Куда ходит CLI: в API работающего сервера или напрямую в файл комнат
+type backend interface {
+	List() ([]store.Room, error)
+	// Export отдаёт записи целиком: с правилами чата, словами и субтитрами
+	Export() ([]store.Room, error)
+	Create(videoURL, name, owner string) (r store.Room, ownerToken string, err error)
+	Close(roomID, ownerToken string) error
+	Import(list []store.Room) (server.ImportResult, error)
+}
+
+func backendFlags(fs *flag.FlagSet) func() backend {
+	serverURL := fs.String("server", defaultServer(), "server URL")
+	data := fs.String("data", "", "room file to use directly instead of the server (stop the server first)")
+	return func() backend {
+		if *data != "" {
+			return &storeBackend{path: *data}
+		}
+		return &apiBackend{base: strings.TrimSuffix(*serverURL, "/")}
+	}
+}
+
+type apiBackend struct {
+	base string
+}
+
+func (b *apiBackend) do(method, path string, body, out interface{}) error {
+	_, err := b.doHeader(method, path, "", body, out)
+	return err
+}
+
+// Как do, но отдаёт и заголовки ответа; ownerToken подтверждает
+// владельца комнаты
+func (b *apiBackend) doHeader(method, path, ownerToken string, body, out interface{}) (http.Header, error) {
+	var rd io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		rd = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, b.base+path, rd)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if ownerToken != "" {
+		req.Header.Set("X-Owner-Token", ownerToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var apiErr server.APIError
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("%s %s: %s", method, path, apiErr.Error)
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if out != nil {
+		return resp.Header, json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.Header, nil
+}
+
+func (b *apiBackend) List() ([]store.Room, error) {
+	var list []store.Room
+	err := b.do(http.MethodGet, "/api/rooms", nil, &list)
+	return list, err
+}
+
+func (b *apiBackend) Export() ([]store.Room, error) {
+	var list []store.Room
+	err := b.do(http.MethodGet, "/api/export", nil, &list)
+	return list, err
+}
+
+func (b *apiBackend) Create(videoURL, name, owner string) (store.Room, string, error) {
+	var r store.Room
+	h, err := b.doHeader(http.MethodPost, "/api/rooms", "", server.CreateRoomRequest{VideoURL: videoURL, Name: name, Owner: owner}, &r)
+	if err != nil {
+		return r, "", err
+	}
+	return r, h.Get("X-Owner-Token"), nil
+}
+
+func (b *apiBackend) Close(roomID, ownerToken string) error {
+	_, err := b.doHeader(http.MethodDelete, "/api/rooms/"+url.PathEscape(roomID), ownerToken, nil, nil)
+	return err
+}
+
+func (b *apiBackend) Import(list []store.Room) (server.ImportResult, error) {
+	var res server.ImportResult
+	err := b.do(http.MethodPost, "/api/import", list, &res)
+	return res, err
+}
+
+type storeBackend struct {
+	path string
+}
+
+func (b *storeBackend) open() (*store.File, error) {
+	return store.OpenFile(b.path)
+}
+
+func (b *storeBackend) List() ([]store.Room, error) {
+	st, err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	return st.List()
+}
+
+func (b *storeBackend) Export() ([]store.Room, error) {
+	return b.List()
+}
+
+func (b *storeBackend) Create(videoURL, name, owner string) (store.Room, string, error) {
+	st, err := b.open()
+	if err != nil {
+		return store.Room{}, "", err
+	}
+	token, key := server.NewOwnerToken()
+	r := store.Room{
+		ID:        server.NewRoomID(),
+		Name:      name,
+		VideoURL:  videoURL,
+		Owner:     owner,
+		OwnerKey:  key,
+		CreatedAt: time.Now(),
+	}
+	if r.Name == "" {
+		r.Name = "Room " + r.ID[:4]
+	}
+	return r, token, st.Put(r)
+}
+
+// Файл комнат правит администратор сервера: секрет владельца не нужен
+func (b *storeBackend) Close(roomID, _ string) error {
+	st, err := b.open()
+	if err != nil {
+		return err
+	}
+	return st.Delete(roomID)
+}
+
+func (b *storeBackend) Import(list []store.Room) (server.ImportResult, error) {
+	var res server.ImportResult
+	st, err := b.open()
+	if err != nil {
+		return res, err
+	}
+	for _, r := range list {
+		if _, err := st.Get(r.ID); r.ID == "" || err == nil {
+			res.Skipped++
+			continue
+		}
+		if err := st.Put(r); err != nil {
+			return res, err
+		}
+		res.Imported++
+	}
+	return res, nil
+}
@@ -0,0 +1,352 @@
+// Пакет client — Go-клиент комнат VideoParty для ботов и сервисов.
+//
+//	c := client.New("https://videoparty.example.com", roomID, "announcer")
+//	c.OnChat = func(user, text string) { log.Printf("%s: %s", user, text) }
+//	go c.Run(ctx)
+//	c.SendChat("Hello!")
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"main.go/protocol"
+)
+
+// Константы (совпадают с серверными)
+const (
+	PongWait   = 60 * time.Second
+	PingPeriod = (PongWait * 9) / 10
+	WriteWait  = 10 * time.Second
+)
+
+var (
+	ErrNotConnected = errors.New("client: not connected")
+	ErrRoomNotFound = errors.New("client: room not found")
+	ErrClosed       = errors.New("client: closed")
+)
+
+type Client struct {
+	// Задержка перед переподключением; удваивается до MaxReconnectDelay
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+	Dialer            *websocket.Dialer
+	Header            http.Header
+
+	// Колбэки вызываются из горутины чтения; не блокируйте их надолго
+	OnConnect      func()
+	OnDisconnect   func(err error)
+	OnChat         func(user, text string)
+	OnUsers        func(users []string)
+	OnPlay         func(user string)
+	OnPause        func(user string)
+	OnSeek         func(user string, seconds float64)
+	OnState        func(state protocol.VideoState)
+	OnRestart      func(reconnectAfter time.Duration)                    // сервер останавливается
+	OnRateLimited  func(msgType string, retryAfter time.Duration)        // сообщение отброшено сервером
+	OnChatPolicy   func(policy protocol.ChatPolicy)                      // правила чата комнаты
+	OnChatRejected func(reason, detail string, retryAfter time.Duration) // сообщение чата не прошло правила или фильтр
+	OnChatFiltered func(text string, reasons []string)                   // фильтры изменили отправленное сообщение
+	OnChatFlagged  func(user, text string, reasons []string)             // помеченное сообщение; приходит модераторам
+	OnSubtitles    func(subs protocol.Subtitles)                         // дорожки субтитров комнаты
+	OnMessage      func(msg protocol.Message)                            // любые сообщения, включая неизвестные типы
+
+	url      string
+	username string
+
+	restartAfter time.Duration // задержка из server_restarting; только в горутине Run
+
+	mu     sync.Mutex // защищает conn и запись в него
+	conn   *websocket.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+// New создаёт клиент комнаты roomID на сервере serverURL (http, https, ws или wss)
+func New(serverURL, roomID, username string) *Client {
+	u := strings.TrimSuffix(serverURL, "/")
+	switch {
+	case strings.HasPrefix(u, "https://"):
+		u = "wss://" + strings.TrimPrefix(u, "https://")
+	case strings.HasPrefix(u, "http://"):
+		u = "ws://" + strings.TrimPrefix(u, "http://")
+	}
+	u += "/ws/" + url.PathEscape(roomID) + "?username=" + url.QueryEscape(username)
+
+	return &Client{
+		ReconnectDelay:    time.Second,
+		MaxReconnectDelay: 30 * time.Second,
+		Dialer:            websocket.DefaultDialer,
+		url:               u,
+		username:          username,
+		closed:            make(chan struct{}),
+	}
+}
+
+// Run подключается к комнате и держит соединение, переподключаясь при обрывах.
+// Возвращает управление после отмены ctx, вызова Close или если комнаты нет.
+func (c *Client) Run(ctx context.Context) error {
+	delay := c.ReconnectDelay
+	for {
+		conn, err := c.dial(ctx)
+		if err == nil {
+			delay = c.ReconnectDelay
+			err = c.serve(ctx, conn)
+			if c.OnDisconnect != nil {
+				c.OnDisconnect(err)
+			}
+		}
+		if errors.Is(err, ErrRoomNotFound) {
+			return err
+		}
+		// Сервер сам назвал задержку — ждём её вместо обычной
+		wait := delay
+		if c.restartAfter > 0 {
+			wait, c.restartAfter = c.restartAfter, 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.closed:
+			return ErrClosed
+		case <-time.After(wait):
+		}
+
+		delay *= 2
+		if delay > c.MaxReconnectDelay {
+			delay = c.MaxReconnectDelay
+		}
+	}
+}
+
+func (c *Client) dial(ctx context.Context) (*websocket.Conn, error) {
+	conn, resp, err := c.Dialer.DialContext(ctx, c.url, c.Header)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, ErrRoomNotFound
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Обслуживает одно соединение до его разрыва
+func (c *Client) serve(ctx context.Context, conn *websocket.Conn) error {
+	conn.SetReadDeadline(time.Now().Add(PongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(PongWait))
+		return nil
+	})
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(PongWait))
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(WriteWait))
+	})
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+
+	stop := make(chan struct{})
+	defer func() {
+		close(stop)
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		conn.Close()
+	}()
+	go c.pingLoop(conn, stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.closed:
+		case <-stop:
+			return
+		}
+		conn.Close()
+	}()
+
+	if c.OnConnect != nil {
+		c.OnConnect()
+	}
+	if err := c.Send(protocol.Message{Type: protocol.TypeJoin}); err != nil {
+		return err
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		// Сервер может склеить несколько сообщений из очереди в один кадр
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for {
+			var msg protocol.Message
+			if err := dec.Decode(&msg); err != nil {
+				break
+			}
+			c.dispatch(msg)
+		}
+	}
+}
+
+func (c *Client) pingLoop(conn *websocket.Conn, stop chan struct{}) {
+	ticker := time.NewTicker(PingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WriteWait))
+			c.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) dispatch(msg protocol.Message) {
+	if c.OnMessage != nil {
+		c.OnMessage(msg)
+	}
+
+	switch msg.Type {
+	case protocol.TypeChat:
+		if c.OnChat != nil {
+			text, _ := msg.Data.(string)
+			c.OnChat(msg.User, text)
+		}
+	case protocol.TypeUsers:
+		if c.OnUsers != nil {
+			var users []string
+			decodeData(msg.Data, &users)
+			c.OnUsers(users)
+		}
+	case protocol.TypePlay:
+		if c.OnPlay != nil {
+			c.OnPlay(msg.User)
+		}
+	case protocol.TypePause:
+		if c.OnPause != nil {
+			c.OnPause(msg.User)
+		}
+	case protocol.TypeSeek:
+		if c.OnSeek != nil {
+			seconds, _ := msg.Data.(float64)
+			c.OnSeek(msg.User, seconds)
+		}
+	case protocol.TypeState:
+		if c.OnState != nil {
+			var state protocol.VideoState
+			decodeData(msg.Data, &state)
+			c.OnState(state)
+		}
+	case protocol.TypeServerRestarting:
+		var restart protocol.Restart
+		decodeData(msg.Data, &restart)
+		c.restartAfter = time.Duration(restart.ReconnectAfterMs) * time.Millisecond
+		if c.OnRestart != nil {
+			c.OnRestart(c.restartAfter)
+		}
+	case protocol.TypeRateLimited:
+		if c.OnRateLimited != nil {
+			var rl protocol.RateLimited
+			decodeData(msg.Data, &rl)
+			c.OnRateLimited(rl.MessageType, time.Duration(rl.RetryAfterMs)*time.Millisecond)
+		}
+	case protocol.TypeChatPolicy:
+		if c.OnChatPolicy != nil {
+			var policy protocol.ChatPolicy
+			decodeData(msg.Data, &policy)
+			c.OnChatPolicy(policy)
+		}
+	case protocol.TypeChatRejected:
+		if c.OnChatRejected != nil {
+			var rej protocol.ChatRejected
+			decodeData(msg.Data, &rej)
+			c.OnChatRejected(rej.Reason, rej.Detail, time.Duration(rej.RetryAfterMs)*time.Millisecond)
+		}
+	case protocol.TypeChatFiltered:
+		if c.OnChatFiltered != nil {
+			var f protocol.ChatFiltered
+			decodeData(msg.Data, &f)
+			c.OnChatFiltered(f.Text, f.Reasons)
+		}
+	case protocol.TypeChatFlagged:
+		if c.OnChatFlagged != nil {
+			var f protocol.ChatFlagged
+			decodeData(msg.Data, &f)
+			c.OnChatFlagged(f.User, f.Text, f.Reasons)
+		}
+	case protocol.TypeSubtitles:
+		if c.OnSubtitles != nil {
+			var subs protocol.Subtitles
+			decodeData(msg.Data, &subs)
+			c.OnSubtitles(subs)
+		}
+	}
+}
+
+// Data приходит как map[string]interface{}/[]interface{}; перекладываем в тип
+func decodeData(data interface{}, dst interface{}) {
+	b, err := json.Marshal(data)
+	if err == nil {
+		json.Unmarshal(b, dst)
+	}
+}
+
+// Send отправляет произвольное сообщение; User подставляется автоматически
+func (c *Client) Send(msg protocol.Message) error {
+	if msg.User == "" {
+		msg.User = c.username
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(WriteWait))
+	return c.conn.WriteJSON(msg)
+}
+
+func (c *Client) SendChat(text string) error {
+	return c.Send(protocol.Message{Type: protocol.TypeChat, Data: text})
+}
+
+func (c *Client) Play() error {
+	return c.Send(protocol.Message{Type: protocol.TypePlay})
+}
+
+func (c *Client) Pause() error {
+	return c.Send(protocol.Message{Type: protocol.TypePause})
+}
+
+func (c *Client) Seek(seconds float64) error {
+	return c.Send(protocol.Message{Type: protocol.TypeSeek, Data: seconds})
+}
+
+func (c *Client) UpdateState(state protocol.VideoState) error {
+	return c.Send(protocol.Message{Type: protocol.TypeStateUpdate, Data: state})
+}
+
+// Close сообщает серверу о выходе и останавливает Run
+func (c *Client) Close() error {
+	err := c.Send(protocol.Message{Type: protocol.TypeLeave})
+	c.once.Do(func() { close(c.closed) })
+	return err
+}
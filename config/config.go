@@ -0,0 +1,616 @@
+// Пакет config собирает настройки сервера из значений по умолчанию,
+// YAML/JSON-файла, переменных окружения и флагов — именно в таком
+// порядке, каждый следующий источник перекрывает предыдущий.
+//
+// Имена флагов и переменных берутся из тегов полей: вложенные секции
+// добавляют свой префикс ("ws" + "pong-wait" -> -ws-pong-wait,
+// VIDEOPARTY_WS_PONG_WAIT).
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "VIDEOPARTY_"
+
+type Config struct {
+	Addr     string `json:"addr" yaml:"addr" flag:"addr" env:"ADDR" usage:"listen address; $PORT is used when unset"`
+	DataFile string `json:"dataFile" yaml:"dataFile" flag:"data" env:"DATA" usage:"JSON file to keep rooms in between restarts (empty: memory only)"`
+	BaseURL  string `json:"baseUrl" yaml:"baseUrl" flag:"base-url" env:"BASE_URL" usage:"public URL used in invite links (empty: taken from the request)"`
+	Prefix   string `json:"prefix" yaml:"prefix" flag:"prefix" env:"PREFIX" usage:"path prefix to serve under, e.g. /party"`
+
+	TrustProxy     bool     `json:"trustProxy" yaml:"trustProxy" flag:"trust-proxy" env:"TRUST_PROXY" usage:"take client addresses from X-Forwarded-For (only behind a reverse proxy)"`
+	AllowedOrigins []string `json:"allowedOrigins" yaml:"allowedOrigins" flag:"allowed-origins" env:"ALLOWED_ORIGINS" usage:"comma-separated extra origins allowed to open sockets and post forms, e.g. https://*.example.com (own origin is always allowed)"`
+
+	HTTP      HTTP      `json:"http" yaml:"http" flag:"http" env:"HTTP"`
+	TLS       TLS       `json:"tls" yaml:"tls" flag:"tls" env:"TLS"`
+	Cookies   Cookies   `json:"cookies" yaml:"cookies" flag:"cookie" env:"COOKIE"`
+	Security  Security  `json:"security" yaml:"security" flag:"security" env:"SECURITY"`
+	RateLimit RateLimit `json:"rateLimit" yaml:"rateLimit" flag:"ratelimit" env:"RATELIMIT"`
+	Chat      Chat      `json:"chat" yaml:"chat" flag:"chat" env:"CHAT"`
+	Log       Log       `json:"log" yaml:"log" flag:"log" env:"LOG"`
+	WebSocket WebSocket `json:"websocket" yaml:"websocket" flag:"ws" env:"WS"`
+	Shutdown  Shutdown  `json:"shutdown" yaml:"shutdown" flag:"shutdown" env:"SHUTDOWN"`
+	Media     Media     `json:"media" yaml:"media" flag:"media" env:"MEDIA"`
+	Uploads   Uploads   `json:"uploads" yaml:"uploads" flag:"uploads" env:"UPLOADS"`
+}
+
+type HTTP struct {
+	ReadHeaderTimeout Duration `json:"readHeaderTimeout" yaml:"readHeaderTimeout" flag:"read-header-timeout" env:"READ_HEADER_TIMEOUT" usage:"time allowed to read request headers"`
+	ReadTimeout       Duration `json:"readTimeout" yaml:"readTimeout" flag:"read-timeout" env:"READ_TIMEOUT" usage:"time allowed to read a whole request"`
+	WriteTimeout      Duration `json:"writeTimeout" yaml:"writeTimeout" flag:"write-timeout" env:"WRITE_TIMEOUT" usage:"time allowed to write a response (WebSocket connections are exempt)"`
+	IdleTimeout       Duration `json:"idleTimeout" yaml:"idleTimeout" flag:"idle-timeout" env:"IDLE_TIMEOUT" usage:"how long to keep idle keep-alive connections"`
+	MaxHeaderBytes    int      `json:"maxHeaderBytes" yaml:"maxHeaderBytes" flag:"max-header-bytes" env:"MAX_HEADER_BYTES" usage:"largest accepted request header in bytes"`
+	MaxFormBytes      int64    `json:"maxFormBytes" yaml:"maxFormBytes" flag:"max-form-bytes" env:"MAX_FORM_BYTES" usage:"largest create-room form body in bytes"`
+	MaxJSONBytes      int64    `json:"maxJsonBytes" yaml:"maxJsonBytes" flag:"max-json-bytes" env:"MAX_JSON_BYTES" usage:"largest JSON API request body in bytes"`
+	MaxImportBytes    int64    `json:"maxImportBytes" yaml:"maxImportBytes" flag:"max-import-bytes" env:"MAX_IMPORT_BYTES" usage:"largest room import body in bytes"`
+	MaxSubtitleBytes  int64    `json:"maxSubtitleBytes" yaml:"maxSubtitleBytes" flag:"max-subtitle-bytes" env:"MAX_SUBTITLE_BYTES" usage:"largest uploaded subtitle file (SRT or WebVTT) in bytes"`
+}
+
+// Сертификат и ключ перечитываются при изменении файлов без перезапуска
+type TLS struct {
+	CertFile string `json:"certFile" yaml:"certFile" flag:"cert" env:"CERT" usage:"TLS certificate file (PEM); enables HTTPS together with -tls-key"`
+	KeyFile  string `json:"keyFile" yaml:"keyFile" flag:"key" env:"KEY" usage:"TLS private key file (PEM)"`
+}
+
+type Cookies struct {
+	SameSite string `json:"sameSite" yaml:"sameSite" flag:"same-site" env:"SAME_SITE" usage:"SameSite cookie attribute: lax, strict or none"`
+	Secure   string `json:"secure" yaml:"secure" flag:"secure" env:"SECURE" usage:"Secure cookie attribute: auto (when served over HTTPS), always or never"`
+}
+
+type Security struct {
+	CSP            string   `json:"csp" yaml:"csp" flag:"csp" env:"CSP" usage:"Content-Security-Policy for pages; {nonce} and {frame-src} are filled in (empty: built-in policy)"`
+	FrameSources   []string `json:"frameSources" yaml:"frameSources" flag:"frame-sources" env:"FRAME_SOURCES" usage:"comma-separated extra origins allowed in page iframes, besides the supported video players"`
+	HSTSMaxAge     Duration `json:"hstsMaxAge" yaml:"hstsMaxAge" flag:"hsts-max-age" env:"HSTS_MAX_AGE" usage:"Strict-Transport-Security max-age for HTTPS responses (0: no HSTS)"`
+	ReferrerPolicy string   `json:"referrerPolicy" yaml:"referrerPolicy" flag:"referrer-policy" env:"REFERRER_POLICY" usage:"Referrer-Policy header"`
+}
+
+// Бюджеты вида "5/s", "10/m" или "30/10s": столько событий сразу,
+// дальше с той же средней частотой. "off" — без ограничения.
+type RateLimit struct {
+	CreateRoom    Rate         `json:"createRoom" yaml:"createRoom" flag:"create-room" env:"CREATE_ROOM" usage:"rooms one address may create or import"`
+	Client        MessageRates `json:"client" yaml:"client" flag:"client" env:"CLIENT"`
+	Room          MessageRates `json:"room" yaml:"room" flag:"room" env:"ROOM"`
+	MaxViolations int          `json:"maxViolations" yaml:"maxViolations" flag:"max-violations" env:"MAX_VIOLATIONS" usage:"rate-limited messages per minute before a client is disconnected (0: never)"`
+}
+
+// Правила чата по умолчанию; владелец комнаты меняет их через API
+type Chat struct {
+	SlowMode            Duration `json:"slowMode" yaml:"slowMode" flag:"slow-mode" env:"SLOW_MODE" usage:"minimum time between chat messages of one user (0: off)"`
+	RejectDuplicates    bool     `json:"rejectDuplicates" yaml:"rejectDuplicates" flag:"reject-duplicates" env:"REJECT_DUPLICATES" usage:"reject a chat message repeating the user's previous one"`
+	MaxLength           int      `json:"maxLength" yaml:"maxLength" flag:"max-length" env:"MAX_LENGTH" usage:"longest chat message in characters (0: no limit)"`
+	MaxLinks            int      `json:"maxLinks" yaml:"maxLinks" flag:"max-links" env:"MAX_LINKS" usage:"most links in one chat message (0: no limit)"`
+	LinksModeratorsOnly bool     `json:"linksModeratorsOnly" yaml:"linksModeratorsOnly" flag:"links-moderators-only" env:"LINKS_MODERATORS_ONLY" usage:"only the room owner may post links"`
+
+	// Фильтры содержимого
+	Normalize    bool     `json:"normalize" yaml:"normalize" flag:"normalize" env:"NORMALIZE" usage:"strip invisible characters and fold full-width letters in chat messages"`
+	Words        []string `json:"words" yaml:"words" flag:"words" env:"WORDS" usage:"comma-separated blocked words; look-alike letters are matched too (rooms may add their own)"`
+	WordAction   string   `json:"wordAction" yaml:"wordAction" flag:"word-action" env:"WORD_ACTION" usage:"what to do with a message containing a blocked word: mask, reject or flag"`
+	AllowedLinks []string `json:"allowedLinks" yaml:"allowedLinks" flag:"allowed-links" env:"ALLOWED_LINKS" usage:"comma-separated hosts chat links may point to, e.g. example.com,*.example.org (empty: any)"`
+	DeniedLinks  []string `json:"deniedLinks" yaml:"deniedLinks" flag:"denied-links" env:"DENIED_LINKS" usage:"comma-separated domains chat links may not point to, subdomains included"`
+}
+
+type Media struct {
+	Probe  bool     `json:"probe" yaml:"probe" flag:"probe" env:"PROBE" usage:"send HEAD requests to video links without a known file extension to learn their type"`
+	Dir    string   `json:"dir" yaml:"dir" flag:"dir" env:"DIR" usage:"directory with video files served as the media library (empty: no library)"`
+	Rescan Duration `json:"rescan" yaml:"rescan" flag:"rescan" env:"RESCAN" usage:"how often to look for new files in the media library (0: only at startup)"`
+	Proxy  Proxy    `json:"proxy" yaml:"proxy" flag:"proxy" env:"PROXY"`
+}
+
+// Прокси прямых ссылок на видео
+type Proxy struct {
+	Enabled   bool     `json:"enabled" yaml:"enabled" flag:"enabled" env:"ENABLED" usage:"let rooms play direct video links through this server (private addresses are always refused)"`
+	Hosts     []string `json:"hosts" yaml:"hosts" flag:"hosts" env:"HOSTS" usage:"comma-separated hosts the proxy may fetch from, e.g. cdn.example.com,*.example.org (empty: any public host)"`
+	Bandwidth int64    `json:"bandwidth" yaml:"bandwidth" flag:"bandwidth" env:"BANDWIDTH" usage:"bytes per second one room may pull through the proxy (0: no limit)"`
+}
+
+// Загрузка видео в медиатеку
+type Uploads struct {
+	MaxSize    int64    `json:"maxSize" yaml:"maxSize" flag:"max-size" env:"MAX_SIZE" usage:"largest uploaded video in bytes (0: uploads are off; needs media.dir)"`
+	UserQuota  int64    `json:"userQuota" yaml:"userQuota" flag:"user-quota" env:"USER_QUOTA" usage:"bytes one client address may upload in total (0: no limit)"`
+	TotalQuota int64    `json:"totalQuota" yaml:"totalQuota" flag:"total-quota" env:"TOTAL_QUOTA" usage:"bytes all uploads may take (0: no limit)"`
+	Expire     Duration `json:"expire" yaml:"expire" flag:"expire" env:"EXPIRE" usage:"how long an unfinished upload is kept (0: forever)"`
+}
+
+// Бюджеты WebSocket-сообщений по типам
+type MessageRates struct {
+	Chat        Rate `json:"chat" yaml:"chat" flag:"chat" env:"CHAT" usage:"chat messages"`
+	Play        Rate `json:"play" yaml:"play" flag:"play" env:"PLAY" usage:"play messages"`
+	Pause       Rate `json:"pause" yaml:"pause" flag:"pause" env:"PAUSE" usage:"pause messages"`
+	Seek        Rate `json:"seek" yaml:"seek" flag:"seek" env:"SEEK" usage:"seek messages"`
+	StateUpdate Rate `json:"stateUpdate" yaml:"stateUpdate" flag:"state-update" env:"STATE_UPDATE" usage:"state_update messages"`
+	Join        Rate `json:"join" yaml:"join" flag:"join" env:"JOIN" usage:"join messages"`
+}
+
+type Rate struct {
+	Count int
+	Per   time.Duration
+}
+
+func (r Rate) MarshalText() ([]byte, error) {
+	if r.Count <= 0 {
+		return []byte("off"), nil
+	}
+	per := r.Per.String()
+	switch r.Per {
+	case time.Second:
+		per = "s"
+	case time.Minute:
+		per = "m"
+	case time.Hour:
+		per = "h"
+	}
+	return []byte(strconv.Itoa(r.Count) + "/" + per), nil
+}
+
+func (r *Rate) UnmarshalText(b []byte) error {
+	text := string(b)
+	if text == "off" || text == "0" {
+		*r = Rate{}
+		return nil
+	}
+	count, per, ok := strings.Cut(text, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n < 0 {
+		return fmt.Errorf("rate %q: want COUNT/PERIOD, e.g. 5/s or 30/10s", text)
+	}
+	switch per {
+	case "s", "m", "h":
+		per = "1" + per
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("rate %q: bad period %q", text, per)
+	}
+	*r = Rate{Count: n, Per: d}
+	return nil
+}
+
+func (r Rate) String() string {
+	b, _ := r.MarshalText()
+	return string(b)
+}
+
+type Log struct {
+	Level  string `json:"level" yaml:"level" flag:"level" env:"LEVEL" usage:"log level: debug, info, warn or error"`
+	Format string `json:"format" yaml:"format" flag:"format" env:"FORMAT" usage:"log format: text or json"`
+}
+
+type WebSocket struct {
+	ReadBufferSize  int      `json:"readBufferSize" yaml:"readBufferSize" flag:"read-buffer-size" env:"READ_BUFFER_SIZE" usage:"WebSocket read buffer size in bytes"`
+	WriteBufferSize int      `json:"writeBufferSize" yaml:"writeBufferSize" flag:"write-buffer-size" env:"WRITE_BUFFER_SIZE" usage:"WebSocket write buffer size in bytes"`
+	MaxMessageSize  int64    `json:"maxMessageSize" yaml:"maxMessageSize" flag:"max-message-size" env:"MAX_MESSAGE_SIZE" usage:"largest accepted client message in bytes"`
+	PongWait        Duration `json:"pongWait" yaml:"pongWait" flag:"pong-wait" env:"PONG_WAIT" usage:"how long to wait for a pong before dropping a client"`
+	WriteWait       Duration `json:"writeWait" yaml:"writeWait" flag:"write-wait" env:"WRITE_WAIT" usage:"timeout for a single socket write"`
+	SendQueue       int      `json:"sendQueue" yaml:"sendQueue" flag:"send-queue" env:"SEND_QUEUE" usage:"outgoing messages buffered per client"`
+	MaxConns        int      `json:"maxConns" yaml:"maxConns" flag:"max-conns" env:"MAX_CONNS" usage:"WebSocket connections allowed in total (0: unlimited)"`
+	MaxConnsPerIP   int      `json:"maxConnsPerIp" yaml:"maxConnsPerIp" flag:"max-conns-per-ip" env:"MAX_CONNS_PER_IP" usage:"WebSocket connections allowed per client address (0: unlimited)"`
+}
+
+type Shutdown struct {
+	Timeout        Duration `json:"timeout" yaml:"timeout" flag:"timeout" env:"TIMEOUT" usage:"how long to wait for connections to drain on SIGTERM"`
+	ReconnectDelay Duration `json:"reconnectDelay" yaml:"reconnectDelay" flag:"reconnect-delay" env:"RECONNECT_DELAY" usage:"minimum delay clients are told to wait before reconnecting"`
+}
+
+// Значения по умолчанию
+func Default() Config {
+	return Config{
+		Addr: ":8080",
+		HTTP: HTTP{
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			ReadTimeout:       Duration(30 * time.Second),
+			WriteTimeout:      Duration(30 * time.Second),
+			IdleTimeout:       Duration(120 * time.Second),
+			MaxHeaderBytes:    64 << 10,
+			MaxFormBytes:      16 << 10,
+			MaxJSONBytes:      64 << 10,
+			MaxImportBytes:    10 << 20,
+			MaxSubtitleBytes:  512 << 10,
+		},
+		Cookies: Cookies{
+			SameSite: "lax",
+			Secure:   "auto",
+		},
+		Security: Security{
+			HSTSMaxAge:     Duration(180 * 24 * time.Hour),
+			ReferrerPolicy: "strict-origin-when-cross-origin",
+		},
+		RateLimit: RateLimit{
+			CreateRoom: Rate{10, time.Minute},
+			Client: MessageRates{
+				Chat:        Rate{5, 5 * time.Second},
+				Play:        Rate{5, 5 * time.Second},
+				Pause:       Rate{5, 5 * time.Second},
+				Seek:        Rate{10, 5 * time.Second},
+				StateUpdate: Rate{10, 5 * time.Second},
+				Join:        Rate{5, time.Minute},
+			},
+			Room: MessageRates{
+				Chat:        Rate{30, 5 * time.Second},
+				Play:        Rate{10, 5 * time.Second},
+				Pause:       Rate{10, 5 * time.Second},
+				Seek:        Rate{20, 5 * time.Second},
+				StateUpdate: Rate{20, 5 * time.Second},
+				Join:        Rate{60, time.Minute},
+			},
+			MaxViolations: 20,
+		},
+		Chat: Chat{
+			MaxLength:  500,
+			Normalize:  true,
+			WordAction: "mask",
+		},
+		Media: Media{
+			Rescan: Duration(time.Minute),
+		},
+		Uploads: Uploads{
+			UserQuota: 10 << 30,
+			Expire:    Duration(24 * time.Hour),
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+		WebSocket: WebSocket{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			MaxMessageSize:  1024,
+			PongWait:        Duration(60 * time.Second),
+			WriteWait:       Duration(10 * time.Second),
+			SendQueue:       256,
+			MaxConnsPerIP:   20,
+		},
+		Shutdown: Shutdown{
+			Timeout:        Duration(15 * time.Second),
+			ReconnectDelay: Duration(5 * time.Second),
+		},
+	}
+}
+
+// Длительность, которая в файлах, флагах и окружении пишется как "10s"
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Load регистрирует флаги конфигурации в fs, разбирает args и собирает
+// итоговую конфигурацию. Путь к файлу берётся из -config или $VIDEOPARTY_CONFIG.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := Default()
+
+	configPath := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "YAML or JSON config file")
+	list := fields(&cfg)
+	flags := map[string]string{}
+	for _, f := range list {
+		name, usage := f.flag, f.usage
+		if def := f.text(); def != "" {
+			usage += fmt.Sprintf(" (default %q)", def)
+		}
+		set := func(v string) error {
+			flags[name] = v
+			return nil
+		}
+		// Логический флаг можно задать без значения: -trust-proxy
+		if f.v.Kind() == reflect.Bool {
+			fs.BoolFunc(name, usage, set)
+		} else {
+			fs.Func(name, usage, set)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// $PORT (Heroku, Render) заменяет только адрес по умолчанию: addr из
+	// файла, окружения или флага важнее
+	if port := os.Getenv("PORT"); port != "" {
+		cfg.Addr = ":" + port
+	}
+	if *configPath != "" {
+		if err := loadFile(&cfg, *configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range list {
+		if v, ok := os.LookupEnv(f.env); ok {
+			if err := f.set(v); err != nil {
+				return nil, fmt.Errorf("config: $%s: %w", f.env, err)
+			}
+		}
+	}
+	for _, f := range list {
+		if v, ok := flags[f.flag]; ok {
+			if err := f.set(v); err != nil {
+				return nil, fmt.Errorf("config: -%s: %w", f.flag, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(strings.NewReader(string(data)))
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+	case ".json":
+		dec := json.NewDecoder(strings.NewReader(string(data)))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	default:
+		return fmt.Errorf("config: %s: unknown format, use .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+// Logger строит журнал по секции log
+func (c *Config) Logger(w io.Writer) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(c.Log.Level))
+	opts := &slog.HandlerOptions{Level: level}
+	if c.Log.Format == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// Write выводит конфигурацию в формате "yaml" или "json"
+func (c *Config) Write(w io.Writer, format string) error {
+	switch format {
+	case "yaml", "yml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		defer enc.Close()
+		return enc.Encode(c)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	}
+	return fmt.Errorf("config: unknown format %q", format)
+}
+
+// Validate проверяет согласованность настроек
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr must not be empty"))
+	}
+	if c.BaseURL != "" {
+		u, err := url.Parse(c.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("baseUrl %q must be an absolute http(s) URL", c.BaseURL))
+		}
+	}
+	if c.Prefix != "" && (!strings.HasPrefix(c.Prefix, "/") || strings.HasSuffix(c.Prefix, "/")) {
+		errs = append(errs, fmt.Errorf("prefix %q must start with / and not end with /", c.Prefix))
+	}
+
+	h := c.HTTP
+	if h.ReadHeaderTimeout < 0 || h.ReadTimeout < 0 || h.WriteTimeout < 0 || h.IdleTimeout < 0 {
+		errs = append(errs, errors.New("http timeouts must not be negative"))
+	}
+	if h.MaxHeaderBytes <= 0 || h.MaxFormBytes <= 0 || h.MaxJSONBytes <= 0 || h.MaxImportBytes <= 0 || h.MaxSubtitleBytes <= 0 {
+		errs = append(errs, errors.New("http size limits must be positive"))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls.certFile and tls.keyFile must be set together"))
+	}
+
+	switch c.Cookies.SameSite {
+	case "lax", "strict":
+	case "none":
+		if c.Cookies.Secure != "always" {
+			errs = append(errs, errors.New("cookies.sameSite none requires cookies.secure always"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("cookies.sameSite %q must be lax, strict or none", c.Cookies.SameSite))
+	}
+	if c.Cookies.Secure != "auto" && c.Cookies.Secure != "always" && c.Cookies.Secure != "never" {
+		errs = append(errs, fmt.Errorf("cookies.secure %q must be auto, always or never", c.Cookies.Secure))
+	}
+
+	if c.RateLimit.MaxViolations < 0 {
+		errs = append(errs, errors.New("rateLimit.maxViolations must not be negative"))
+	}
+	if c.Chat.SlowMode < 0 || c.Chat.MaxLength < 0 || c.Chat.MaxLinks < 0 {
+		errs = append(errs, errors.New("chat slowMode, maxLength and maxLinks must not be negative"))
+	}
+	if a := c.Chat.WordAction; a != "mask" && a != "reject" && a != "flag" {
+		errs = append(errs, fmt.Errorf("chat.wordAction %q must be mask, reject or flag", a))
+	}
+	if c.Media.Rescan < 0 {
+		errs = append(errs, errors.New("media.rescan must not be negative"))
+	}
+	if c.Media.Proxy.Bandwidth < 0 {
+		errs = append(errs, errors.New("media.proxy.bandwidth must not be negative"))
+	}
+	if c.Uploads.MaxSize < 0 || c.Uploads.UserQuota < 0 || c.Uploads.TotalQuota < 0 || c.Uploads.Expire < 0 {
+		errs = append(errs, errors.New("uploads.maxSize, uploads.userQuota, uploads.totalQuota and uploads.expire must not be negative"))
+	}
+	if c.Uploads.MaxSize > 0 && c.Media.Dir == "" {
+		errs = append(errs, errors.New("uploads need media.dir"))
+	}
+	if c.Security.HSTSMaxAge < 0 {
+		errs = append(errs, errors.New("security.hstsMaxAge must not be negative"))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("log.level %q must be debug, info, warn or error", c.Log.Level))
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("log.format %q must be text or json", c.Log.Format))
+	}
+
+	ws := c.WebSocket
+	if ws.ReadBufferSize <= 0 || ws.WriteBufferSize <= 0 {
+		errs = append(errs, errors.New("websocket buffer sizes must be positive"))
+	}
+	if ws.MaxMessageSize <= 0 {
+		errs = append(errs, errors.New("websocket.maxMessageSize must be positive"))
+	}
+	if ws.SendQueue <= 0 {
+		errs = append(errs, errors.New("websocket.sendQueue must be positive"))
+	}
+	if ws.MaxConns < 0 || ws.MaxConnsPerIP < 0 {
+		errs = append(errs, errors.New("websocket connection limits must not be negative"))
+	}
+	if ws.WriteWait <= 0 {
+		errs = append(errs, errors.New("websocket.writeWait must be positive"))
+	}
+	if ws.PongWait <= ws.WriteWait {
+		errs = append(errs, errors.New("websocket.pongWait must be longer than websocket.writeWait"))
+	}
+	if c.Shutdown.Timeout <= 0 {
+		errs = append(errs, errors.New("shutdown.timeout must be positive"))
+	}
+	if c.Shutdown.ReconnectDelay < 0 {
+		errs = append(errs, errors.New("shutdown.reconnectDelay must not be negative"))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Поле конфигурации с именами флага и переменной окружения
+type field struct {
+	flag, env, usage string
+	v                reflect.Value
+}
+
+func fields(cfg *Config) []field {
+	var out []field
+	collect(reflect.ValueOf(cfg).Elem(), "", envPrefix, &out)
+	return out
+}
+
+func collect(v reflect.Value, flagPrefix, envPrefix string, out *[]field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, env := sf.Tag.Get("flag"), sf.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		fv := v.Field(i)
+		if sf.Type.Kind() == reflect.Struct && !isText(fv) {
+			collect(fv, flagPrefix+name+"-", envPrefix+env+"_", out)
+			continue
+		}
+		*out = append(*out, field{
+			flag:  flagPrefix + name,
+			env:   envPrefix + env,
+			usage: sf.Tag.Get("usage"),
+			v:     fv,
+		})
+	}
+}
+
+func isText(v reflect.Value) bool {
+	_, ok := v.Addr().Interface().(encoding.TextUnmarshaler)
+	return ok
+}
+
+func (f field) set(s string) error {
+	if u, ok := f.v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch f.v.Kind() {
+	case reflect.String:
+		f.v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		f.v.SetFloat(n)
+	case reflect.Slice:
+		if f.v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", f.v.Type())
+		}
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		f.v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %s", f.v.Type())
+	}
+	return nil
+}
+
+func (f field) text() string {
+	if m, ok := f.v.Interface().(encoding.TextMarshaler); ok {
+		b, _ := m.MarshalText()
+		return string(b)
+	}
+	if f.v.Kind() == reflect.Slice {
+		parts := make([]string, f.v.Len())
+		for i := range parts {
+			parts[i] = fmt.Sprint(f.v.Index(i).Interface())
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(f.v.Interface())
+}
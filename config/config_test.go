@@ -0,0 +1,163 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string // содержимое config.yaml; пусто — без файла
+		env   map[string]string
+		args  []string
+		check func(t *testing.T, c *Config)
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, c *Config) {
+				if c.Addr != ":8080" || c.TrustProxy {
+					t.Errorf("addr %q, trustProxy %v", c.Addr, c.TrustProxy)
+				}
+			},
+		},
+		{
+			name: "port replaces the default addr",
+			env:  map[string]string{"PORT": "9000"},
+			check: func(t *testing.T, c *Config) {
+				if c.Addr != ":9000" {
+					t.Errorf("addr %q, want :9000", c.Addr)
+				}
+			},
+		},
+		{
+			name: "file addr wins over port",
+			file: "addr: :7000\n",
+			env:  map[string]string{"PORT": "9000"},
+			check: func(t *testing.T, c *Config) {
+				if c.Addr != ":7000" {
+					t.Errorf("addr %q, want :7000", c.Addr)
+				}
+			},
+		},
+		{
+			name: "env wins over file",
+			file: "addr: :7000\nwebsocket:\n  pongWait: 30s\n",
+			env:  map[string]string{"VIDEOPARTY_ADDR": ":7001", "VIDEOPARTY_WS_PONG_WAIT": "45s"},
+			check: func(t *testing.T, c *Config) {
+				if c.Addr != ":7001" {
+					t.Errorf("addr %q, want :7001", c.Addr)
+				}
+				if time.Duration(c.WebSocket.PongWait) != 45*time.Second {
+					t.Errorf("pongWait %v, want 45s", c.WebSocket.PongWait)
+				}
+			},
+		},
+		{
+			name: "flag wins over env",
+			env:  map[string]string{"VIDEOPARTY_ADDR": ":7001"},
+			args: []string{"-addr", ":7002"},
+			check: func(t *testing.T, c *Config) {
+				if c.Addr != ":7002" {
+					t.Errorf("addr %q, want :7002", c.Addr)
+				}
+			},
+		},
+		{
+			name: "bool flag without a value",
+			args: []string{"-trust-proxy"},
+			check: func(t *testing.T, c *Config) {
+				if !c.TrustProxy {
+					t.Error("trustProxy is false")
+				}
+			},
+		},
+		{
+			name: "bool flag turns off env",
+			env:  map[string]string{"VIDEOPARTY_TRUST_PROXY": "true"},
+			args: []string{"-trust-proxy=false"},
+			check: func(t *testing.T, c *Config) {
+				if c.TrustProxy {
+					t.Error("trustProxy is true")
+				}
+			},
+		},
+		{
+			name: "nested bool flag without a value",
+			args: []string{"-media-proxy-enabled", "-addr", ":7003"},
+			check: func(t *testing.T, c *Config) {
+				if !c.Media.Proxy.Enabled || c.Addr != ":7003" {
+					t.Errorf("media.proxy.enabled %v, addr %q", c.Media.Proxy.Enabled, c.Addr)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file != "" {
+				path := filepath.Join(t.TempDir(), "config.yaml")
+				if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				args = append([]string{"-config", path}, args...)
+			}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			cfg, err := Load(fs, args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+	}{
+		{"bad duration flag", nil, []string{"-ws-pong-wait", "soon"}},
+		{"bad bool env", map[string]string{"VIDEOPARTY_TRUST_PROXY": "maybe"}, nil},
+		{"unknown flag", nil, []string{"-no-such-flag"}},
+		{"invalid value", nil, []string{"-log-level", "loud"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			if _, err := Load(fs, tt.args); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
+
+// Переменные окружения машины не должны влиять на тест
+func clearEnv(t *testing.T) {
+	t.Helper()
+	names := []string{"PORT", envPrefix + "CONFIG"}
+	for _, f := range fields(&Config{}) {
+		names = append(names, f.env)
+	}
+	for _, name := range names {
+		if _, ok := os.LookupEnv(name); ok {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package mediainfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Сервер отдаёт файл только целиком
+var ErrNoRange = errors.New("mediainfo: server does not support range requests")
+
+const (
+	blockSize = 64 << 10 // заголовки читаются блоками, чтобы не ходить за каждым байтом
+	maxBlocks = 64       // сколько блоков держать; больше одному файлу не нужно
+)
+
+// Файл по HTTP как io.ReaderAt: мелкие чтения идут через кэш блоков,
+// крупные (тело moov) — одним запросом
+type rangeReader struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+	size   int64
+	blocks map[int64][]byte
+}
+
+// Первый блок заодно сообщает размер файла из Content-Range
+func newRangeReader(ctx context.Context, client *http.Client, url string) (*rangeReader, error) {
+	r := &rangeReader{ctx: ctx, client: client, url: url, blocks: make(map[int64][]byte)}
+	data, size, err := r.fetch(0, blockSize)
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, ErrNoRange
+	}
+	r.size = size
+	r.blocks[0] = data
+	return r, nil
+}
+
+// Байты [start, end) и полный размер файла
+func (r *rangeReader) fetch(start, end int64) ([]byte, int64, error) {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	size := resp.ContentLength
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Content-Range: bytes 0-65535/1048576
+		cr := strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes ")
+		span, total, _ := strings.Cut(cr, "/")
+		first, _, _ := strings.Cut(span, "-")
+		if n, err := strconv.ParseInt(first, 10, 64); err != nil || n != start {
+			return nil, 0, ErrNoRange
+		}
+		if size, err = strconv.ParseInt(total, 10, 64); err != nil {
+			// Размер неизвестен ("*"): разбирать нечего
+			return nil, 0, ErrNoRange
+		}
+	case http.StatusOK:
+		// Без Range годится только начало файла
+		if start != 0 {
+			return nil, 0, ErrNoRange
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		return nil, 0, io.EOF
+	default:
+		return nil, 0, fmt.Errorf("mediainfo: %s: HTTP %d", r.url, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, end-start))
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, size, nil
+}
+
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > r.size {
+		end = r.size
+	}
+
+	var n int
+	if len(p) > blockSize {
+		data, _, err := r.fetch(off, end)
+		if err != nil {
+			return 0, err
+		}
+		n = copy(p, data)
+	} else {
+		for b := off / blockSize; b*blockSize < end; b++ {
+			block, err := r.block(b)
+			if err != nil {
+				return n, err
+			}
+			from := off + int64(n) - b*blockSize
+			if from >= int64(len(block)) {
+				return n, io.ErrUnexpectedEOF
+			}
+			n += copy(p[n:], block[from:])
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *rangeReader) block(b int64) ([]byte, error) {
+	if data, ok := r.blocks[b]; ok {
+		return data, nil
+	}
+	end := (b + 1) * blockSize
+	if end > r.size {
+		end = r.size
+	}
+	data, _, err := r.fetch(b*blockSize, end)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.blocks) >= maxBlocks {
+		clear(r.blocks)
+	}
+	r.blocks[b] = data
+	return data, nil
+}
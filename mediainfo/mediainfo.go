@@ -0,0 +1,126 @@
+// Пакет mediainfo узнаёт длительность, размер кадра и кодеки видеофайлов
+// MP4/MOV и WebM/Matroska без ffmpeg: читает только заголовки (moov в MP4,
+// Info и Tracks в EBML), поэтому с HTTP-серверов качаются лишь нужные
+// куски через Range.
+package mediainfo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	// Файл не MP4 и не WebM/Matroska
+	ErrUnknownFormat = errors.New("mediainfo: unknown container format")
+	// Заголовки обрезаны или противоречат сами себе
+	ErrMalformed = errors.New("mediainfo: malformed file")
+)
+
+// Дорожка файла
+type Track struct {
+	Kind   string `json:"kind"`  // video или audio
+	Codec  string `json:"codec"` // в записи RFC 6381: avc1.64001f, mp4a.40.2, vp9, opus
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// Что удалось узнать о файле
+type Info struct {
+	Format   string  `json:"format"`             // mp4, webm или matroska
+	Duration float64 `json:"duration,omitempty"` // секунды; 0 — не записана
+	Tracks   []Track `json:"tracks,omitempty"`
+}
+
+// Размер кадра первой видеодорожки
+func (i *Info) Size() (width, height int) {
+	for _, t := range i.Tracks {
+		if t.Kind == "video" {
+			return t.Width, t.Height
+		}
+	}
+	return 0, 0
+}
+
+// Кодеки всех дорожек по порядку
+func (i *Info) Codecs() []string {
+	var out []string
+	for _, t := range i.Tracks {
+		out = append(out, t.Codec)
+	}
+	return out
+}
+
+// Кодеки, которые браузеры не играют; пусто — файл можно показывать
+func (i *Info) Unplayable() []string {
+	var out []string
+	for _, t := range i.Tracks {
+		if !Playable(t.Codec) {
+			out = append(out, t.Codec)
+		}
+	}
+	return out
+}
+
+// Кодеки, которые играют современные браузеры (HEVC — Safari и Chrome с
+// аппаратным декодером, но отказывать в нём было бы слишком строго)
+var playableCodecs = []string{
+	"avc1", "avc3", "hvc1", "hev1", "av01", "vp8", "vp9", "vp08", "vp09",
+	"mp4a.40", "mp4a.67", "mp4a.69", "mp4a.6b", "opus", "vorbis", "flac", "mp3",
+}
+
+// Играют ли браузеры кодек в записи RFC 6381
+func Playable(codec string) bool {
+	codec = strings.ToLower(codec)
+	for _, c := range playableCodecs {
+		if codec == c || strings.HasPrefix(codec, c+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Разбор файла по сигнатуре в начале
+func Probe(r io.ReaderAt, size int64) (*Info, error) {
+	var head [12]byte
+	if _, err := r.ReadAt(head[:], 0); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, ErrUnknownFormat
+		}
+		return nil, err
+	}
+	switch {
+	case string(head[:4]) == "\x1a\x45\xdf\xa3":
+		return probeEBML(r, size)
+	case string(head[4:8]) == "ftyp" || string(head[4:8]) == "moov" ||
+		string(head[4:8]) == "mdat" || string(head[4:8]) == "free" || string(head[4:8]) == "wide":
+		return probeMP4(r, size)
+	}
+	return nil, ErrUnknownFormat
+}
+
+func ProbeFile(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Probe(f, info.Size())
+}
+
+// Разбор файла по ссылке запросами с Range; сервер, не умеющий Range,
+// даёт ErrNoRange. Время ограничивает ctx.
+func ProbeURL(ctx context.Context, client *http.Client, url string) (*Info, error) {
+	r, err := newRangeReader(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	return Probe(r, r.size)
+}
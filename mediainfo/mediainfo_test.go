@@ -0,0 +1,245 @@
+package mediainfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+// Бокс MP4 с 32-битным размером
+func mp4Box(typ string, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(b)))
+	return append(append(out, typ...), b...)
+}
+
+// Бокс с 64-битным размером, который может и не совпадать с телом
+func mp4LargeBox(typ string, size uint64, body []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, 1)
+	out = append(out, typ...)
+	out = binary.BigEndian.AppendUint64(out, size)
+	return append(out, body...)
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+// Тело mvhd версии 0: шкала 1000, длительность 5 с
+func mvhdBody() []byte {
+	b := make([]byte, 100)
+	binary.BigEndian.PutUint32(b[12:], 1000)
+	binary.BigEndian.PutUint32(b[16:], 5000)
+	return b
+}
+
+func hdlr(handler string) []byte {
+	return mp4Box("hdlr", make([]byte, 8), []byte(handler), make([]byte, 12))
+}
+
+func trak(handler string, entry []byte) []byte {
+	stsd := mp4Box("stsd", make([]byte, 4), u32(1), entry)
+	return mp4Box("trak", mp4Box("mdia", hdlr(handler), mp4Box("minf", mp4Box("stbl", stsd))))
+}
+
+// avc1 1280x720, High@3.1
+func avc1() []byte {
+	b := make([]byte, 78)
+	binary.BigEndian.PutUint16(b[24:], 1280)
+	binary.BigEndian.PutUint16(b[26:], 720)
+	return mp4Box("avc1", b, mp4Box("avcC", []byte{1, 0x64, 0x00, 0x1f, 0xff}))
+}
+
+// esds AAC-LC: ES_Descriptor → DecoderConfigDescriptor → AudioSpecificConfig
+func esdsBody() []byte {
+	dsi := []byte{0x05, 2, 0x12, 0x10}
+	dcd := append([]byte{0x04, byte(13 + len(dsi)), 0x40, 0x15}, make([]byte, 11)...)
+	dcd = append(dcd, dsi...)
+	es := append([]byte{0x03, byte(3 + len(dcd)), 0, 1, 0}, dcd...)
+	return append(make([]byte, 4), es...)
+}
+
+func mp4a(esds []byte) []byte {
+	return mp4Box("mp4a", make([]byte, 28), esds)
+}
+
+func testMP4(audio []byte) []byte {
+	moov := mp4Box("moov", mp4Box("mvhd", mvhdBody()), trak("vide", avc1()), trak("soun", audio))
+	return append(mp4Box("ftyp", []byte("isom"), u32(0), []byte("isomavc1")), moov...)
+}
+
+func TestProbeMP4(t *testing.T) {
+	file := testMP4(mp4a(mp4Box("esds", esdsBody())))
+	info, err := Probe(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Track{
+		{Kind: "video", Codec: "avc1.64001f", Width: 1280, Height: 720},
+		{Kind: "audio", Codec: "mp4a.40.2"},
+	}
+	if info.Format != "mp4" || info.Duration != 5 || len(info.Tracks) != 2 ||
+		info.Tracks[0] != want[0] || info.Tracks[1] != want[1] {
+		t.Errorf("got %+v", info)
+	}
+}
+
+func TestProbeMP4Malformed(t *testing.T) {
+	ftyp := mp4Box("ftyp", []byte("isom"), u32(0))
+	huge := uint64(math.MaxInt64)
+	tests := []struct {
+		name  string
+		file  []byte
+		err   error  // nil — разбор удаётся
+		audio string // кодек звука, если разбор удался
+	}{
+		{"moov with a 64-bit size near MaxInt64", append(ftyp, mp4LargeBox("moov", huge, mvhdBody())...), ErrMalformed, ""},
+		{"moov with a size past MaxInt64", append(ftyp, mp4LargeBox("moov", math.MaxUint64, mvhdBody())...), ErrMalformed, ""},
+		{"box smaller than its header", append(ftyp, u32(4)...), ErrMalformed, ""},
+		{"moov larger than the file", append(ftyp, append(u32(1<<20), "moov"...)...), ErrMalformed, ""},
+		{"no moov", append(ftyp, mp4Box("mdat", make([]byte, 16))...), ErrMalformed, ""},
+		{"esds with a 64-bit size near MaxInt64", testMP4(mp4a(mp4LargeBox("esds", huge, esdsBody()))), nil, "mp4a"},
+		{"esds larger than its sample entry", testMP4(mp4a(append(u32(1<<16), "esds"...))), nil, "mp4a"},
+		{"esds padded past the read limit", testMP4(mp4a(mp4Box("esds", esdsBody(), make([]byte, 4*maxEsdsSize)))), nil, "mp4a.40.2"},
+		{"empty esds", testMP4(mp4a(mp4Box("esds"))), nil, "mp4a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Probe(bytes.NewReader(tt.file), int64(len(tt.file)))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("err %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(info.Tracks) != 2 || info.Tracks[1].Codec != tt.audio {
+				t.Errorf("tracks %+v, want audio %q", info.Tracks, tt.audio)
+			}
+		})
+	}
+}
+
+// Элемент EBML с 8-байтовым размером
+func ebml(id []byte, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	out := append([]byte{}, id...)
+	out = append(out, 0x01)
+	out = append(out, binary.BigEndian.AppendUint64(nil, uint64(len(b)))[1:]...)
+	return append(out, b...)
+}
+
+// Элемент с произвольным 8-байтовым размером, в том числе «неизвестным»
+func ebmlSized(id []byte, size uint64, body []byte) []byte {
+	out := append(append([]byte{}, id...), 0x01)
+	out = append(out, binary.BigEndian.AppendUint64(nil, size)[1:]...)
+	return append(out, body...)
+}
+
+var (
+	ebmlID      = []byte{0x1A, 0x45, 0xDF, 0xA3}
+	segmentID   = []byte{0x18, 0x53, 0x80, 0x67}
+	infoID      = []byte{0x15, 0x49, 0xA9, 0x66}
+	tracksID    = []byte{0x16, 0x54, 0xAE, 0x6B}
+	clusterID   = []byte{0x1F, 0x43, 0xB6, 0x75}
+	unknownSize = uint64(1<<56 - 1)
+)
+
+func ebmlInfo(duration float64) []byte {
+	return ebml(infoID,
+		ebml([]byte{0x2A, 0xD7, 0xB1}, []byte{0x0F, 0x42, 0x40}),
+		ebml([]byte{0x44, 0x89}, binary.BigEndian.AppendUint64(nil, math.Float64bits(duration))))
+}
+
+func ebmlTracksBody() []byte {
+	video := ebml([]byte{0xAE},
+		ebml([]byte{0x83}, []byte{1}),
+		ebml([]byte{0x86}, []byte("V_VP9")),
+		ebml([]byte{0xE0}, ebml([]byte{0xB0}, u16(640)), ebml([]byte{0xBA}, u16(360))))
+	audio := ebml([]byte{0xAE}, ebml([]byte{0x83}, []byte{2}), ebml([]byte{0x86}, []byte("A_OPUS")))
+	subs := ebml([]byte{0xAE}, ebml([]byte{0x83}, []byte{0x11}), ebml([]byte{0x86}, []byte("S_TEXT/WEBVTT")))
+	return bytes.Join([][]byte{video, audio, subs}, nil)
+}
+
+func testWebM(segment func(body []byte) []byte, duration float64) []byte {
+	header := ebml(ebmlID, ebml([]byte{0x42, 0x82}, []byte("webm")))
+	body := bytes.Join([][]byte{ebmlInfo(duration), ebml(tracksID, ebmlTracksBody()), ebml(clusterID, make([]byte, 32))}, nil)
+	return append(header, segment(body)...)
+}
+
+func TestProbeEBML(t *testing.T) {
+	want := []Track{
+		{Kind: "video", Codec: "vp9", Width: 640, Height: 360},
+		{Kind: "audio", Codec: "opus"},
+	}
+	tests := []struct {
+		name     string
+		file     []byte
+		duration float64
+	}{
+		{"sized segment", testWebM(func(b []byte) []byte { return ebml(segmentID, b) }, 5000), 5},
+		{"live segment of unknown size", testWebM(func(b []byte) []byte { return ebmlSized(segmentID, unknownSize, b) }, 5000), 5},
+		{"segment larger than the file", testWebM(func(b []byte) []byte { return ebmlSized(segmentID, 1<<40, b) }, 5000), 5},
+		{"NaN duration", testWebM(func(b []byte) []byte { return ebml(segmentID, b) }, math.NaN()), 0},
+		{"infinite duration", testWebM(func(b []byte) []byte { return ebml(segmentID, b) }, math.Inf(1)), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Probe(bytes.NewReader(tt.file), int64(len(tt.file)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Format != "webm" || info.Duration != tt.duration || len(info.Tracks) != 2 ||
+				info.Tracks[0] != want[0] || info.Tracks[1] != want[1] {
+				t.Errorf("got %+v", info)
+			}
+		})
+	}
+}
+
+func TestProbeEBMLMalformed(t *testing.T) {
+	header := ebml(ebmlID, ebml([]byte{0x42, 0x82}, []byte("webm")))
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{"header only", header},
+		{"no segment", append(header, ebml(clusterID, make([]byte, 8))...)},
+		{"zero byte instead of an ID", append(header, 0, 0, 0, 0)},
+		{"ID longer than four bytes", append(header, 0x08, 1, 2, 3, 4, 5, 6, 7)},
+		{"header of unknown size", append(ebmlSized(ebmlID, unknownSize, nil), 0x42, 0x82)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Probe(bytes.NewReader(tt.file), int64(len(tt.file))); !errors.Is(err, ErrMalformed) {
+				t.Errorf("err %v, want ErrMalformed", err)
+			}
+		})
+	}
+}
+
+// Обрезанный или испорченный файл даёт ошибку или неполные сведения,
+// но не панику: Library.scan разбирает файлы при запуске сервера
+func TestProbeCorrupted(t *testing.T) {
+	files := map[string][]byte{
+		"mp4":  testMP4(mp4a(mp4Box("esds", esdsBody()))),
+		"webm": testWebM(func(b []byte) []byte { return ebml(segmentID, b) }, 5000),
+	}
+	for name, file := range files {
+		t.Run(name, func(t *testing.T) {
+			for n := 0; n < len(file); n++ {
+				Probe(bytes.NewReader(file[:n]), int64(n))
+			}
+			for i := range file {
+				for _, v := range []byte{0x00, 0x01, 0x7F, 0x80, 0xFF} {
+					b := bytes.Clone(file)
+					b[i] = v
+					Probe(bytes.NewReader(b), int64(len(b)))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package mediainfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Больше moov у фильмов не бывает; такой файл скорее испорчен
+const maxMoovSize = 64 << 20
+
+// Дескрипторы esds занимают десятки байт; остальное не нужно
+const maxEsdsSize = 1 << 10
+
+// Бокс MP4: тип и границы тела
+type box struct {
+	typ        string
+	start, end int64
+}
+
+// MP4/MOV: длительность из mvhd (у фрагментированных — из mvex/mehd),
+// дорожки из trak/mdia: тип из hdlr, кодек и размер кадра из stsd
+func probeMP4(r io.ReaderAt, size int64) (*Info, error) {
+	start, end, ok := findBox(r, 0, size, "moov")
+	if !ok {
+		// moov в конце файла, который ещё дописывается, или его нет
+		return nil, ErrMalformed
+	}
+	if end-start > maxMoovSize {
+		return nil, fmt.Errorf("%w: moov box is too large", ErrMalformed)
+	}
+	// moov читается целиком: по HTTP это один запрос вместо сотни
+	buf := make([]byte, end-start)
+	if _, err := r.ReadAt(buf, start); err != nil {
+		return nil, err
+	}
+	moov := bytes.NewReader(buf)
+	n := int64(len(buf))
+
+	info := &Info{Format: "mp4"}
+	timescale, duration := mvhd(moov, n)
+	if duration == 0 {
+		if s, e, ok := findBox(moov, 0, n, "mvex"); ok {
+			duration = mehd(moov, s, e)
+		}
+	}
+	if timescale > 0 {
+		info.Duration = float64(duration) / float64(timescale)
+	}
+
+	traks, err := children(moov, 0, n)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range traks {
+		if b.typ != "trak" {
+			continue
+		}
+		if t, ok := mp4Track(moov, b.start, b.end); ok {
+			info.Tracks = append(info.Tracks, t)
+		}
+	}
+	return info, nil
+}
+
+// Шкала времени и длительность фильма; версия 1 хранит их в 64 битах
+func mvhd(r io.ReaderAt, n int64) (uint32, uint64) {
+	start, end, ok := findBox(r, 0, n, "mvhd")
+	if !ok || end-start < 32 {
+		return 0, 0
+	}
+	var hdr [32]byte
+	if _, err := r.ReadAt(hdr[:], start); err != nil {
+		return 0, 0
+	}
+	if hdr[0] == 1 {
+		return binary.BigEndian.Uint32(hdr[20:24]), binary.BigEndian.Uint64(hdr[24:32])
+	}
+	return binary.BigEndian.Uint32(hdr[12:16]), uint64(binary.BigEndian.Uint32(hdr[16:20]))
+}
+
+// Длительность фрагментированного файла в шкале mvhd
+func mehd(r io.ReaderAt, start, end int64) uint64 {
+	s, e, ok := findBox(r, start, end, "mehd")
+	if !ok || e-s < 8 {
+		return 0
+	}
+	var hdr [12]byte
+	if _, err := r.ReadAt(hdr[:min(e-s, 12)], s); err != nil {
+		return 0
+	}
+	if hdr[0] == 1 && e-s >= 12 {
+		return binary.BigEndian.Uint64(hdr[4:12])
+	}
+	return uint64(binary.BigEndian.Uint32(hdr[4:8]))
+}
+
+// Дорожка из trak; false — не видео и не звук (субтитры, таймкоды)
+func mp4Track(r io.ReaderAt, start, end int64) (Track, bool) {
+	mdiaStart, mdiaEnd, ok := path(r, start, end, "mdia")
+	if !ok {
+		return Track{}, false
+	}
+	var t Track
+	s, e, ok := findBox(r, mdiaStart, mdiaEnd, "hdlr")
+	if !ok || e-s < 12 {
+		return Track{}, false
+	}
+	var handler [4]byte
+	r.ReadAt(handler[:], s+8)
+	switch string(handler[:]) {
+	case "vide":
+		t.Kind = "video"
+	case "soun":
+		t.Kind = "audio"
+	default:
+		return Track{}, false
+	}
+
+	s, e, ok = path(r, mdiaStart, mdiaEnd, "minf", "stbl", "stsd")
+	if !ok || e-s < 16 {
+		return t, true
+	}
+	// Первое описание сэмплов: версия и флаги, число записей, запись
+	entries, err := children(r, s+8, e)
+	if err != nil || len(entries) == 0 {
+		return t, true
+	}
+	entry := entries[0]
+	t.Codec = sampleEntryCodec(entry.typ)
+
+	if t.Kind == "video" {
+		var dims [4]byte
+		if _, err := r.ReadAt(dims[:], entry.start+24); err == nil {
+			t.Width = int(binary.BigEndian.Uint16(dims[0:2]))
+			t.Height = int(binary.BigEndian.Uint16(dims[2:4]))
+		}
+		// avcC: версия, профиль, совместимость, уровень
+		c, ce, ok := findBox(r, entry.start+78, entry.end, "avcC")
+		if ok && ce-c >= 4 && (entry.typ == "avc1" || entry.typ == "avc3") {
+			var cfg [4]byte
+			r.ReadAt(cfg[:], c)
+			t.Codec = fmt.Sprintf("%s.%02x%02x%02x", entry.typ, cfg[1], cfg[2], cfg[3])
+		}
+		return t, true
+	}
+
+	// Звук: поля после заголовка записи зависят от её версии (QuickTime)
+	var ver [2]byte
+	r.ReadAt(ver[:], entry.start+8)
+	skip := int64(28)
+	switch binary.BigEndian.Uint16(ver[:]) {
+	case 1:
+		skip += 16
+	case 2:
+		skip += 36
+	}
+	if c, ce, ok := findBox(r, entry.start+skip, entry.end, "esds"); ok && entry.typ == "mp4a" {
+		body := make([]byte, min(ce-c, maxEsdsSize))
+		if _, err := r.ReadAt(body, c); err == nil {
+			if codec := esdsCodec(body); codec != "" {
+				t.Codec = codec
+			}
+		}
+	}
+	return t, true
+}
+
+// Тип записи stsd в запись RFC 6381
+func sampleEntryCodec(typ string) string {
+	switch typ {
+	case "Opus":
+		return "opus"
+	case "fLaC":
+		return "flac"
+	case ".mp3":
+		return "mp3"
+	}
+	return strings.TrimSpace(typ)
+}
+
+// Кодек AAC и других MPEG-4 аудио из esds: mp4a.40.2 (AAC-LC), mp4a.6b (MP3)
+func esdsCodec(body []byte) string {
+	if len(body) < 4 {
+		return ""
+	}
+	d := body[4:] // версия и флаги
+	tag, d := descriptor(d)
+	if tag != 0x03 || len(d) < 3 {
+		return ""
+	}
+	flags := d[2]
+	d = d[3:]
+	if flags&0x80 != 0 && len(d) >= 2 {
+		d = d[2:]
+	}
+	if flags&0x40 != 0 && len(d) >= 1 {
+		d = d[min(len(d), 1+int(d[0])):]
+	}
+	if flags&0x20 != 0 && len(d) >= 2 {
+		d = d[2:]
+	}
+	tag, d = descriptor(d)
+	if tag != 0x04 || len(d) < 13 {
+		return ""
+	}
+	oti := d[0]
+	if oti != 0x40 {
+		return fmt.Sprintf("mp4a.%02x", oti)
+	}
+	tag, d = descriptor(d[13:])
+	if tag != 0x05 || len(d) < 1 {
+		return "mp4a.40"
+	}
+	aot := int(d[0] >> 3)
+	if aot == 31 && len(d) >= 2 {
+		aot = 32 + (int(d[0]&0x07)<<3 | int(d[1]>>5))
+	}
+	return fmt.Sprintf("mp4a.40.%d", aot)
+}
+
+// Дескриптор MPEG-4: тег и тело; длина записана по 7 бит в байте
+func descriptor(d []byte) (byte, []byte) {
+	if len(d) < 2 {
+		return 0, nil
+	}
+	tag := d[0]
+	size, i := 0, 1
+	for ; i < len(d) && i <= 4; i++ {
+		size = size<<7 | int(d[i]&0x7f)
+		if d[i]&0x80 == 0 {
+			i++
+			break
+		}
+	}
+	d = d[i:]
+	if size < len(d) {
+		d = d[:size]
+	}
+	return tag, d
+}
+
+// Бокс по цепочке вложенности: path(r, s, e, "minf", "stbl", "stsd")
+func path(r io.ReaderAt, start, end int64, types ...string) (int64, int64, bool) {
+	for _, typ := range types {
+		var ok bool
+		if start, end, ok = findBox(r, start, end, typ); !ok {
+			return 0, 0, false
+		}
+	}
+	return start, end, true
+}
+
+// Ищет бокс typ среди боксов в [start, end); возвращает границы его тела
+func findBox(r io.ReaderAt, start, end int64, typ string) (int64, int64, bool) {
+	var found box
+	err := walkBoxes(r, start, end, func(b box) bool {
+		if b.typ == typ {
+			found = b
+			return false
+		}
+		return true
+	})
+	if err != nil || found.typ == "" {
+		return 0, 0, false
+	}
+	return found.start, found.end, true
+}
+
+// Все боксы в [start, end)
+func children(r io.ReaderAt, start, end int64) ([]box, error) {
+	var out []box
+	err := walkBoxes(r, start, end, func(b box) bool {
+		out = append(out, b)
+		return true
+	})
+	return out, err
+}
+
+// Обход боксов одного уровня; fn возвращает false, чтобы остановиться
+func walkBoxes(r io.ReaderAt, start, end int64, fn func(box) bool) error {
+	var hdr [16]byte
+	for pos := start; pos+8 <= end; {
+		if _, err := r.ReadAt(hdr[:8], pos); err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[:4]))
+		body := pos + 8
+		switch size {
+		case 0: // до конца файла
+			size = end - pos
+		case 1: // 64-битный размер после типа
+			if _, err := r.ReadAt(hdr[8:16], pos+8); err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			body = pos + 16
+		}
+		// pos+size переполнится на 64-битном размере вроде 0x7FFF…
+		if size < body-pos || size > end-pos {
+			return ErrMalformed
+		}
+		if !fn(box{typ: string(hdr[4:8]), start: body, end: pos + size}) {
+			return nil
+		}
+		pos += size
+	}
+	return nil
+}
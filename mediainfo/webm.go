@@ -0,0 +1,260 @@
+package mediainfo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// ID элементов EBML/Matroska, которые нужны для описания файла
+const (
+	idEBML        = 0x1A45DFA3
+	idDocType     = 0x4282
+	idSegment     = 0x18538067
+	idInfo        = 0x1549A966
+	idTimescale   = 0x2AD7B1
+	idDuration    = 0x4489
+	idTracks      = 0x1654AE6B
+	idTrackEntry  = 0xAE
+	idTrackType   = 0x83
+	idCodecID     = 0x86
+	idVideo       = 0xE0
+	idPixelWidth  = 0xB0
+	idPixelHeight = 0xBA
+	idCluster     = 0x1F43B675
+)
+
+// Info и Tracks больше не бывают; дальше не читаем
+const maxEBMLElement = 4 << 20
+
+// Кодеки Matroska в записи RFC 6381
+var matroskaCodecs = map[string]string{
+	"V_VP8":              "vp8",
+	"V_VP9":              "vp9",
+	"V_AV1":              "av01",
+	"V_MPEG4/ISO/AVC":    "avc1",
+	"V_MPEGH/ISO/HEVC":   "hvc1",
+	"A_OPUS":             "opus",
+	"A_VORBIS":           "vorbis",
+	"A_FLAC":             "flac",
+	"A_MPEG/L3":          "mp3",
+	"A_AAC":              "mp4a.40",
+	"A_AAC/MPEG4/LC":     "mp4a.40.2",
+	"A_AAC/MPEG4/LC/SBR": "mp4a.40.5",
+}
+
+// WebM/Matroska: DocType из заголовка EBML, длительность из Info,
+// дорожки из Tracks. Оба элемента стоят до первого Cluster, дальше
+// не читаем.
+func probeEBML(r io.ReaderAt, size int64) (*Info, error) {
+	id, start, end, err := ebmlHeader(r, 0, size)
+	if err != nil || id != idEBML {
+		return nil, ErrMalformed
+	}
+	info := &Info{Format: "matroska"}
+	header, err := readElement(r, start, end)
+	if err != nil {
+		return nil, err
+	}
+	ebmlElements(header, func(id uint32, body []byte) {
+		if id == idDocType && string(body) == "webm" {
+			info.Format = "webm"
+		}
+	})
+
+	id, start, end, err = ebmlHeader(r, end, size)
+	if err != nil || id != idSegment {
+		return nil, ErrMalformed
+	}
+	var gotInfo, gotTracks bool
+	for pos := start; pos < end && !(gotInfo && gotTracks); {
+		id, bodyStart, bodyEnd, err := ebmlHeader(r, pos, end)
+		if err != nil {
+			break
+		}
+		switch id {
+		case idCluster:
+			return info, nil
+		case idInfo:
+			body, err := readElement(r, bodyStart, bodyEnd)
+			if err != nil {
+				return nil, err
+			}
+			info.Duration = ebmlDuration(body)
+			gotInfo = true
+		case idTracks:
+			body, err := readElement(r, bodyStart, bodyEnd)
+			if err != nil {
+				return nil, err
+			}
+			info.Tracks = ebmlTracks(body)
+			gotTracks = true
+		}
+		pos = bodyEnd
+	}
+	return info, nil
+}
+
+// Длительность в секундах: Duration в единицах TimestampScale (нс)
+func ebmlDuration(body []byte) float64 {
+	scale := uint64(1000000)
+	var duration float64
+	ebmlElements(body, func(id uint32, v []byte) {
+		switch id {
+		case idTimescale:
+			scale = ebmlUint(v)
+		case idDuration:
+			switch len(v) {
+			case 4:
+				duration = float64(math.Float32frombits(binary.BigEndian.Uint32(v)))
+			case 8:
+				duration = math.Float64frombits(binary.BigEndian.Uint64(v))
+			}
+		}
+	})
+	d := duration * float64(scale) / 1e9
+	// NaN и бесконечность не закодировать в JSON
+	if math.IsNaN(d) || math.IsInf(d, 0) || d < 0 {
+		return 0
+	}
+	return d
+}
+
+func ebmlTracks(body []byte) []Track {
+	var tracks []Track
+	ebmlElements(body, func(id uint32, entry []byte) {
+		if id != idTrackEntry {
+			return
+		}
+		var t Track
+		ebmlElements(entry, func(id uint32, v []byte) {
+			switch id {
+			case idTrackType:
+				switch ebmlUint(v) {
+				case 1:
+					t.Kind = "video"
+				case 2:
+					t.Kind = "audio"
+				}
+			case idCodecID:
+				t.Codec = string(v)
+				if c, ok := matroskaCodecs[t.Codec]; ok {
+					t.Codec = c
+				}
+			case idVideo:
+				ebmlElements(v, func(id uint32, v []byte) {
+					switch id {
+					case idPixelWidth:
+						t.Width = int(ebmlUint(v))
+					case idPixelHeight:
+						t.Height = int(ebmlUint(v))
+					}
+				})
+			}
+		})
+		// Субтитры и прочие дорожки не описываем
+		if t.Kind != "" {
+			tracks = append(tracks, t)
+		}
+	})
+	return tracks
+}
+
+// Тело элемента целиком
+func readElement(r io.ReaderAt, start, end int64) ([]byte, error) {
+	if end-start > maxEBMLElement {
+		return nil, fmt.Errorf("%w: EBML element is too large", ErrMalformed)
+	}
+	buf := make([]byte, end-start)
+	if _, err := r.ReadAt(buf, start); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Заголовок элемента в pos: ID и границы тела. Неизвестный размер
+// (все биты единицы) бывает у Segment и Cluster живых трансляций —
+// тело тогда тянется до limit.
+func ebmlHeader(r io.ReaderAt, pos, limit int64) (uint32, int64, int64, error) {
+	if pos >= limit {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+	var buf [12]byte
+	n, err := r.ReadAt(buf[:min(limit-pos, 12)], pos)
+	if n == 0 {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, 0, 0, err
+	}
+	id, idLen, ok := vint(buf[:n], false)
+	if !ok {
+		return 0, 0, 0, ErrMalformed
+	}
+	size, sizeLen, ok := vint(buf[idLen:n], true)
+	if !ok {
+		return 0, 0, 0, ErrMalformed
+	}
+	start := pos + int64(idLen+sizeLen)
+	end := limit
+	if size != math.MaxUint64 && size < uint64(limit-start) {
+		end = start + int64(size)
+	}
+	return uint32(id), start, end, nil
+}
+
+// Число переменной длины EBML: длину задают ведущие нули первого байта.
+// У ID маркер длины остаётся частью значения, у размера — нет;
+// размер из одних единиц означает «неизвестен» (MaxUint64).
+func vint(b []byte, stripMarker bool) (uint64, int, bool) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, false
+	}
+	n := bits.LeadingZeros8(b[0]) + 1
+	if len(b) < n || (!stripMarker && n > 4) {
+		return 0, 0, false
+	}
+	v := uint64(b[0])
+	if stripMarker {
+		v &= uint64(0xFF >> n)
+	}
+	allOnes := v == uint64(0xFF>>n)
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+		allOnes = allOnes && c == 0xFF
+	}
+	if stripMarker && allOnes {
+		return math.MaxUint64, n, true
+	}
+	return v, n, true
+}
+
+// Обход элементов тела, уже прочитанного в память
+func ebmlElements(data []byte, fn func(id uint32, body []byte)) {
+	for len(data) > 0 {
+		id, idLen, ok := vint(data, false)
+		if !ok {
+			return
+		}
+		size, sizeLen, ok := vint(data[idLen:], true)
+		if !ok {
+			return
+		}
+		data = data[idLen+sizeLen:]
+		if size > uint64(len(data)) {
+			size = uint64(len(data))
+		}
+		fn(uint32(id), data[:size])
+		data = data[size:]
+	}
+}
+
+func ebmlUint(v []byte) uint64 {
+	var n uint64
+	for _, c := range v {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
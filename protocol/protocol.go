@@ -0,0 +1,104 @@
+// Пакет protocol описывает JSON-сообщения, которыми сервер VideoParty
+// и клиенты обмениваются через WebSocket /ws/{roomID}.
+package protocol
+
+// Типы сообщений
+const (
+	TypeChat        = "chat"         // клиент <-> сервер, Data: текст
+	TypeUsers       = "users"        // сервер -> клиент, Data: []string
+	TypePlay        = "play"         // клиент <-> сервер
+	TypePause       = "pause"        // клиент <-> сервер
+	TypeSeek        = "seek"         // клиент <-> сервер, Data: секунды; в эфире отбрасывается
+	TypeState       = "state"        // сервер -> клиент, Data: VideoState; в эфире без позиции
+	TypeStateUpdate = "state_update" // клиент -> сервер, Data: VideoState
+	TypeJoin        = "join"         // клиент -> сервер
+	TypeLeave       = "leave"        // клиент -> сервер
+	TypeRoomClosed  = "room_closed"  // сервер -> клиент, комната удалена
+
+	TypeServerRestarting = "server_restarting" // сервер -> клиент, Data: Restart
+	TypeRateLimited      = "rate_limited"      // сервер -> клиент, Data: RateLimited
+	TypeChatPolicy       = "chat_policy"       // сервер -> клиент, Data: ChatPolicy
+	TypeChatRejected     = "chat_rejected"     // сервер -> клиент, Data: ChatRejected
+	TypeChatFiltered     = "chat_filtered"     // сервер -> отправитель, Data: ChatFiltered
+	TypeChatFlagged      = "chat_flagged"      // сервер -> модераторы, Data: ChatFlagged
+	TypeSubtitles        = "subtitles"         // сервер -> клиент, Data: Subtitles
+)
+
+type Message struct {
+	Type string      `json:"type"`
+	User string      `json:"user,omitempty"`
+	Data interface{} `json:"data,omitempty"`
+	Time int64       `json:"time,omitempty"`
+}
+
+type VideoState struct {
+	Playing      bool    `json:"playing"`
+	CurrentTime  float64 `json:"currentTime"`
+	PlaybackRate float64 `json:"playbackRate,omitempty"`
+}
+
+// Сервер останавливается; переподключаться стоит не раньше чем через ReconnectAfterMs
+type Restart struct {
+	ReconnectAfterMs int64 `json:"reconnectAfterMs"`
+}
+
+// Сообщение отброшено: клиент или комната превысили бюджет для этого типа
+type RateLimited struct {
+	MessageType  string `json:"messageType"`
+	RetryAfterMs int64  `json:"retryAfterMs"`
+}
+
+// Правила чата комнаты. Нули отключают соответствующее правило;
+// на модераторов (владельца комнаты) действует только MaxLength.
+type ChatPolicy struct {
+	SlowModeSeconds     int  `json:"slowModeSeconds"`     // не чаще одного сообщения в N секунд от пользователя
+	RejectDuplicates    bool `json:"rejectDuplicates"`    // отклонять повтор своего предыдущего сообщения
+	MaxLength           int  `json:"maxLength"`           // длина сообщения в символах
+	MaxLinks            int  `json:"maxLinks"`            // ссылок в одном сообщении
+	LinksModeratorsOnly bool `json:"linksModeratorsOnly"` // ссылки только от модераторов
+}
+
+// Причины отказа в chat_rejected
+const (
+	RejectSlowMode       = "slow_mode"
+	RejectDuplicate      = "duplicate"
+	RejectTooLong        = "too_long"
+	RejectTooManyLinks   = "too_many_links"
+	RejectLinksForbidden = "links_forbidden"
+	RejectFiltered       = "filtered" // фильтр содержимого, подробности в Detail
+)
+
+// Сообщение чата не прошло правила комнаты; RetryAfterMs задан для slow_mode
+type ChatRejected struct {
+	Reason       string `json:"reason"`
+	Detail       string `json:"detail,omitempty"`
+	RetryAfterMs int64  `json:"retryAfterMs,omitempty"`
+}
+
+// Сообщение отправлено, но фильтры его изменили; Reasons — что и почему
+type ChatFiltered struct {
+	Text    string   `json:"text"` // текст в том виде, в каком его увидели остальные
+	Reasons []string `json:"reasons"`
+}
+
+// Сообщение помечено фильтром для проверки модератором
+type ChatFlagged struct {
+	User    string   `json:"user"`
+	Text    string   `json:"text"`
+	Reasons []string `json:"reasons"`
+}
+
+// Дорожки субтитров комнаты. Default — ID дорожки, которую владелец
+// включил по умолчанию; пусто — субтитры выключены, пока зритель не
+// выберет дорожку сам.
+type Subtitles struct {
+	Default string          `json:"default"`
+	Tracks  []SubtitleTrack `json:"tracks"`
+}
+
+type SubtitleTrack struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	Lang  string `json:"lang,omitempty"` // BCP 47: en, ru, pt-BR
+	URL   string `json:"url"`            // файл WebVTT
+}
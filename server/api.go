@@ -0,0 +1,646 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"main.go/store"
+)
+
+// Описание маршрута: по этой же таблице регистрируются обработчики
+// и строится OpenAPI-спецификация, поэтому они не расходятся.
+type route struct {
+	Pattern  string // шаблон ServeMux, например "GET /api/rooms/{roomID}"
+	Handler  http.HandlerFunc
+	Summary  string
+	Query    interface{}              // структура с тегами `query`
+	Form     interface{}              // структура с тегами `form` (x-www-form-urlencoded)
+	Request  interface{}              // JSON-тело запроса
+	Response interface{}              // тело успешного JSON-ответа; nil — не JSON
+	Produces string                   // content type успешного ответа, если не JSON
+	Status   int                      // код успешного ответа (по умолчанию 200)
+	Errors   []int                    // возможные коды ошибок
+	MaxBody  int64                    // предел тела запроса в байтах; 0 — без ограничения
+	Security func(h *SecurityHeaders) // поправка заголовков безопасности маршрута
+}
+
+// Таблица маршрутов
+func (s *Server) routes() []route {
+	return []route{
+		{
+			Pattern:  "GET /{$}",
+			Handler:  s.homeHandler,
+			Summary:  "Home page with the create-room form",
+			Query:    homeQuery{},
+			Produces: "text/html",
+		},
+		{
+			Pattern: "POST /create-room",
+			Handler: s.createRoomHandler,
+			Summary: "Create a room and redirect to it",
+			Form:    createRoomForm{},
+			Status:  http.StatusSeeOther,
+			MaxBody: s.limits.MaxFormBytes,
+			Errors:  []int{http.StatusTooManyRequests},
+		},
+		{
+			Pattern:  "GET /room/{roomID}",
+			Handler:  s.roomHandler,
+			Summary:  "Room page with the player and chat",
+			Query:    roomQuery{},
+			Produces: "text/html",
+			Errors:   []int{http.StatusNotFound},
+		},
+		{
+			Pattern:  "GET /ws/{roomID}",
+			Handler:  s.websocketHandler,
+			Summary:  "WebSocket connection to a room; frames are Message objects",
+			Query:    roomQuery{},
+			Response: Message{},
+			Status:   http.StatusSwitchingProtocols,
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusTooManyRequests, http.StatusServiceUnavailable},
+		},
+		{
+			Pattern:  "GET /rooms",
+			Handler:  s.listRoomsHandler,
+			Summary:  "HTML list of active rooms",
+			Produces: "text/html",
+		},
+		{
+			Pattern:  "GET /api/rooms",
+			Handler:  s.apiListRoomsHandler,
+			Summary:  "List active rooms",
+			Response: []Room{},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "POST /api/rooms",
+			Handler:  s.apiCreateRoomHandler,
+			Summary:  "Create a room; the owner secret comes back in the X-Owner-Token header",
+			Request:  CreateRoomRequest{},
+			Response: Room{},
+			Status:   http.StatusCreated,
+			Errors:   []int{http.StatusBadRequest, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable},
+			MaxBody:  s.limits.MaxJSONBytes,
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "GET /api/rooms/{roomID}",
+			Handler:  s.apiGetRoomHandler,
+			Summary:  "Get a room",
+			Response: Room{},
+			Errors:   []int{http.StatusNotFound},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "DELETE /api/rooms/{roomID}",
+			Handler:  s.apiCloseRoomHandler,
+			Summary:  "Close a room and disconnect everyone in it; only the owner or a server admin can",
+			Status:   http.StatusNoContent,
+			Errors:   []int{http.StatusForbidden, http.StatusNotFound},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "GET /api/media",
+			Handler:  s.apiListMediaHandler,
+			Summary:  "List files of the server media library (empty when it is disabled)",
+			Response: []MediaItem{},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "GET /media/{mediaID}",
+			Handler:  s.mediaHandler,
+			Summary:  "Media library file; supports Range, ETag and conditional requests",
+			Produces: "video/*",
+			Errors:   []int{http.StatusNotModified, http.StatusNotFound, http.StatusPreconditionFailed, http.StatusRequestedRangeNotSatisfiable},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "GET /proxy/{roomID}",
+			Handler:  s.proxyHandler,
+			Summary:  "Direct video of a room created with proxy, streamed through the server with Range passthrough",
+			Query:    proxyQuery{},
+			Produces: "video/*",
+			Errors:   []int{http.StatusNotModified, http.StatusForbidden, http.StatusNotFound, http.StatusRequestedRangeNotSatisfiable, http.StatusBadGateway},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "GET /subtitles/{roomID}/{trackID}",
+			Handler:  s.subtitleHandler,
+			Summary:  "WebVTT file of a room subtitle track for <track>",
+			Produces: "text/vtt",
+			Errors:   []int{http.StatusNotFound},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "OPTIONS /api/uploads",
+			Handler:  s.uploadOptionsHandler,
+			Summary:  "tus 1.0 capabilities of the upload endpoint (Tus-Version, Tus-Extension, Tus-Max-Size)",
+			Status:   http.StatusNoContent,
+			Errors:   []int{http.StatusNotFound},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "POST /api/uploads",
+			Handler:  s.createUploadHandler,
+			Summary:  "Start a resumable upload into the media library; Upload-Length and Upload-Metadata (filename, owner, roomName) headers describe the file",
+			Status:   http.StatusCreated,
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusPreconditionFailed, http.StatusRequestEntityTooLarge, http.StatusTooManyRequests, http.StatusServiceUnavailable},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "HEAD /api/uploads/{uploadID}",
+			Handler:  s.uploadStatusHandler,
+			Summary:  "Upload progress in Upload-Offset; Upload-Room holds the room created for a finished upload",
+			Errors:   []int{http.StatusNotFound, http.StatusPreconditionFailed},
+			Security: apiHeaders,
+		},
+		{
+			Pattern: "PATCH /api/uploads/{uploadID}",
+			Handler: s.patchUploadHandler,
+			Summary: "Append an application/offset+octet-stream chunk at Upload-Offset; " +
+				"an optional Upload-Checksum is verified and a mismatch is answered with 460",
+			Status:   http.StatusNoContent,
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "DELETE /api/uploads/{uploadID}",
+			Handler:  s.deleteUploadHandler,
+			Summary:  "Cancel an unfinished upload; finished ones are kept with their file in the media library",
+			Status:   http.StatusNoContent,
+			Errors:   []int{http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "GET /api/rooms/{roomID}/chat-policy",
+			Handler:  s.apiGetChatPolicyHandler,
+			Summary:  "Get the chat policy of a room",
+			Response: ChatPolicy{},
+			Errors:   []int{http.StatusNotFound},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "PUT /api/rooms/{roomID}/chat-policy",
+			Handler:  s.apiSetChatPolicyHandler,
+			Summary:  "Change the chat policy of a room and notify everyone in it (owner only, X-Owner-Token)",
+			Request:  ChatPolicy{},
+			Response: ChatPolicy{},
+			Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			MaxBody:  s.limits.MaxJSONBytes,
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "GET /api/rooms/{roomID}/word-list",
+			Handler:  s.apiGetWordListHandler,
+			Summary:  "Get the chat word list of a room (added to or replacing the server list; owner only)",
+			Response: WordList{},
+			Errors:   []int{http.StatusForbidden, http.StatusNotFound},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "PUT /api/rooms/{roomID}/word-list",
+			Handler:  s.apiSetWordListHandler,
+			Summary:  "Replace the chat word list of a room; an empty list restores the server list (owner only)",
+			Request:  WordList{},
+			Response: WordList{},
+			Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			MaxBody:  s.limits.MaxJSONBytes,
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "GET /api/rooms/{roomID}/subtitles",
+			Handler:  s.apiListSubtitlesHandler,
+			Summary:  "List the subtitle tracks of a room and its default track",
+			Response: Subtitles{},
+			Errors:   []int{http.StatusNotFound},
+			Security: apiHeaders,
+		},
+		{
+			Pattern: "POST /api/rooms/{roomID}/subtitles",
+			Handler: s.apiAddSubtitleHandler,
+			Summary: "Attach a subtitle track; the body is an SRT or WebVTT file, SRT is converted to WebVTT. " +
+				"Everyone in the room is notified. Owner only",
+			Query:    subtitleQuery{},
+			Response: SubtitleTrack{},
+			Status:   http.StatusCreated,
+			Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+			MaxBody:  s.limits.MaxSubtitleBytes,
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "PUT /api/rooms/{roomID}/subtitles/default",
+			Handler:  s.apiSetDefaultSubtitleHandler,
+			Summary:  "Choose the track shown to viewers who have not picked their own; an empty ID turns subtitles off by default (owner only)",
+			Request:  DefaultSubtitle{},
+			Response: Subtitles{},
+			Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			MaxBody:  s.limits.MaxJSONBytes,
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "DELETE /api/rooms/{roomID}/subtitles/{trackID}",
+			Handler:  s.apiDeleteSubtitleHandler,
+			Summary:  "Remove a subtitle track (owner only)",
+			Response: Subtitles{},
+			Errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "GET /api/export",
+			Handler:  s.apiExportHandler,
+			Summary:  "Export all rooms with their chat settings, word lists and subtitles",
+			Response: []store.Room{},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "POST /api/import",
+			Handler:  s.apiImportHandler,
+			Summary:  "Import rooms exported by GET /api/export; rooms with existing IDs are skipped, invalid ones rejected",
+			Request:  []store.Room{},
+			Response: ImportResult{},
+			Errors:   []int{http.StatusBadRequest, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable},
+			MaxBody:  s.limits.MaxImportBytes,
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "GET /static/{path...}",
+			Handler:  s.staticHandler,
+			Summary:  "CSS and JavaScript; content-hashed names are cacheable forever",
+			Produces: "text/css",
+			Errors:   []int{http.StatusNotFound},
+		},
+		{
+			Pattern:  "GET /health",
+			Handler:  s.healthHandler,
+			Summary:  "Liveness check",
+			Response: HealthStatus{},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "GET /ready",
+			Handler:  s.readyHandler,
+			Summary:  "Readiness check: store reachable and not draining",
+			Response: HealthStatus{},
+			Errors:   []int{http.StatusServiceUnavailable},
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "GET /metrics",
+			Handler:  s.metricsHandler,
+			Summary:  "Prometheus metrics",
+			Produces: "text/plain",
+			Security: apiHeaders,
+		},
+		{
+			Pattern:  "GET /api/openapi.json",
+			Handler:  s.openAPIHandler,
+			Summary:  "This OpenAPI document",
+			Produces: "application/json",
+			Security: apiHeaders,
+		},
+	}
+}
+
+// Параметры запросов
+type homeQuery struct {
+	Error string `query:"error"`
+}
+
+type roomQuery struct {
+	Username string `query:"username"`
+}
+
+type createRoomForm struct {
+	VideoURL  string `form:"videoUrl"` // ссылка или mediaId
+	MediaID   string `form:"mediaId"`  // файл медиатеки
+	RoomName  string `form:"roomName"`
+	Sources   string `form:"sources"` // альтернативные файлы, по одному в строке
+	Poster    string `form:"poster"`
+	Proxy     string `form:"proxy"` // непусто — играть файл через сервер
+	Username  string `form:"username" required:"true"`
+	CSRFToken string `form:"csrf_token" required:"true"` // из скрытого поля формы на главной
+}
+
+type CreateRoomRequest struct {
+	VideoURL string        `json:"videoUrl,omitempty"`
+	MediaID  string        `json:"mediaId,omitempty"` // файл медиатеки вместо videoUrl
+	Name     string        `json:"name,omitempty"`
+	Owner    string        `json:"owner"`
+	Sources  []VideoSource `json:"sources,omitempty"` // альтернативные файлы для прямых ссылок
+	Poster   string        `json:"poster,omitempty"`
+	Proxy    bool          `json:"proxy,omitempty"` // отдавать файл через прокси сервера
+}
+
+type ImportResult struct {
+	Imported int           `json:"imported"`
+	Skipped  int           `json:"skipped"`            // ID уже занят
+	Rejected []ImportError `json:"rejected,omitempty"` // запись не прошла проверки
+}
+
+// Почему запись импорта отклонена
+type ImportError struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// Формат ошибки JSON API
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// Заполняет строковые поля структуры из url.Values по тегу
+func decodeValues(values url.Values, tag string, dst interface{}) {
+	v := reflect.ValueOf(dst).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get(tag)
+		if name == "" || t.Field(i).Type.Kind() != reflect.String {
+			continue
+		}
+		v.Field(i).SetString(values.Get(name))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, APIError{Error: msg})
+}
+
+// Список комнат (JSON)
+func (s *Server) apiListRoomsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, ActionListRooms, "") {
+		return
+	}
+
+	s.mu.RLock()
+	list := make([]*Room, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		list = append(list, room)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Комната по ID (JSON)
+func (s *Server) apiGetRoomHandler(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomID")
+	if !s.authorize(w, r, ActionViewRoom, roomID) {
+		return
+	}
+
+	room, exists := s.room(roomID)
+	if !exists {
+		writeError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, room)
+}
+
+// Создание комнаты (JSON)
+func (s *Server) apiCreateRoomHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, ActionCreateRoom, "") {
+		return
+	}
+	if !s.allowCreate(w, r) {
+		return
+	}
+
+	var req CreateRoomRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, bodyStatus(err), "invalid JSON: "+err.Error())
+		return
+	}
+	if (req.VideoURL == "" && req.MediaID == "") || req.Owner == "" {
+		writeError(w, http.StatusBadRequest, "videoUrl or mediaId and owner are required")
+		return
+	}
+
+	token, key := NewOwnerToken()
+	room, err := s.createRoom(r.Context(), store.Room{
+		VideoURL: req.VideoURL,
+		MediaID:  req.MediaID,
+		Name:     req.Name,
+		Owner:    req.Owner,
+		OwnerKey: key,
+		Sources:  req.Sources,
+		Poster:   req.Poster,
+		Proxy:    req.Proxy,
+	})
+	if errors.Is(err, ErrShuttingDown) {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	var mediaErr *MediaError
+	if errors.As(err, &mediaErr) {
+		writeError(w, http.StatusBadRequest, mediaErr.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "could not save room")
+		return
+	}
+	s.giveOwnerToken(w, r, room.ID, token)
+	writeJSON(w, http.StatusCreated, room)
+}
+
+// Закрытие комнаты
+func (s *Server) apiCloseRoomHandler(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomID")
+	if !s.authorize(w, r, ActionCloseRoom, roomID) {
+		return
+	}
+	room, exists := s.room(roomID)
+	if !exists {
+		writeError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	if (s.admin == nil || !s.admin(r)) && !s.requireOwner(w, r, room) {
+		return
+	}
+	if !s.closeRoom(r.Context(), roomID) {
+		writeError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Экспорт комнат
+func (s *Server) apiExportHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, ActionListRooms, "") {
+		return
+	}
+
+	// Записи хранилища целиком: правила чата, слова и субтитры в JSON
+	// комнаты не попадают, а без них импорт теряет настройки
+	s.mu.RLock()
+	list := make([]store.Room, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		list = append(list, room.record())
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	w.Header().Set("Content-Disposition", `attachment; filename="videoparty-rooms.json"`)
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Импорт комнат
+func (s *Server) apiImportHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, ActionImport, "") {
+		return
+	}
+	if !s.allowCreate(w, r) {
+		return
+	}
+	if s.draining.Load() {
+		writeError(w, http.StatusServiceUnavailable, ErrShuttingDown.Error())
+		return
+	}
+
+	var list []store.Room
+	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+		writeError(w, bodyStatus(err), "invalid JSON: "+err.Error())
+		return
+	}
+
+	var res ImportResult
+	for _, rec := range list {
+		if _, exists := s.room(rec.ID); exists {
+			res.Skipped++
+			continue
+		}
+		if err := s.checkImport(r.Context(), &rec); err != nil {
+			res.Rejected = append(res.Rejected, ImportError{ID: rec.ID, Error: err.Error()})
+			continue
+		}
+
+		// Сначала хранилище, потом s.rooms: комната, которую не удалось
+		// сохранить, не должна появиться до перезапуска и пропасть после
+		if err := s.store.Put(rec); err != nil {
+			s.logger.ErrorContext(r.Context(), "saving room failed", "room_id", rec.ID, "err", err)
+			writeError(w, http.StatusInternalServerError, "could not save room")
+			return
+		}
+		s.mu.Lock()
+		existing, exists := s.rooms[rec.ID]
+		if !exists {
+			s.rooms[rec.ID] = s.roomFromRecord(rec)
+		}
+		s.mu.Unlock()
+
+		if exists {
+			// Параллельный импорт успел раньше; возвращаем в хранилище его запись
+			s.store.Put(existing.record())
+			res.Skipped++
+			continue
+		}
+		res.Imported++
+	}
+	if len(res.Rejected) > 0 {
+		s.logger.WarnContext(r.Context(), "import rejected rooms", "rooms", len(res.Rejected))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// ID импортируемой комнаты попадает в пути и имена cookie
+var importIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Запись из файла импорта проходит те же проверки, что и новая комната.
+// Тип файла и разборы потока и заголовков вычисляются заново: им верит
+// CSP страницы комнаты
+func (s *Server) checkImport(ctx context.Context, rec *store.Room) error {
+	if !importIDRe.MatchString(rec.ID) {
+		return errors.New("id must be 1-64 letters, digits, '-' or '_'")
+	}
+	if rec.VideoURL == "" && rec.MediaID == "" {
+		return errors.New("videoUrl or mediaId is required")
+	}
+	if rec.OwnerKey != "" {
+		if _, err := hex.DecodeString(rec.OwnerKey); err != nil || len(rec.OwnerKey) != 2*sha256.Size {
+			return errors.New("ownerKey must be a hex SHA-256")
+		}
+	}
+
+	rec.VideoType, rec.Stream, rec.File = "", nil, nil
+	if err := s.checkMedia(ctx, rec); err != nil {
+		return err
+	}
+
+	if rec.Chat != nil {
+		if err := validateChatPolicy(*rec.Chat); err != nil {
+			return err
+		}
+	}
+	if rec.Words != nil {
+		if !validWordAction(rec.Words.Action) {
+			return errors.New("word list action must be mask, reject or flag")
+		}
+		if rec.Words.Words == nil {
+			rec.Words.Words = []string{}
+		}
+	}
+	if err := checkImportSubtitles(rec); err != nil {
+		return err
+	}
+
+	if rec.Name == "" {
+		rec.Name = "Room " + rec.ID[:min(4, len(rec.ID))]
+	}
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// Дорожки проверяются как при загрузке; текст хранится уже в WebVTT
+func checkImportSubtitles(rec *store.Room) error {
+	if len(rec.Subtitles) > maxSubtitles {
+		return fmt.Errorf("a room can have at most %d subtitle tracks", maxSubtitles)
+	}
+	ids := make(map[string]bool, len(rec.Subtitles))
+	for i := range rec.Subtitles {
+		sub := &rec.Subtitles[i]
+		if sub.ID == "" || ids[sub.ID] {
+			return errors.New("subtitle track ids must be unique and not empty")
+		}
+		ids[sub.ID] = true
+		if sub.Lang != "" && !langRe.MatchString(sub.Lang) {
+			return fmt.Errorf("subtitle track %s: lang must be a language tag like en or pt-BR", sub.ID)
+		}
+		if utf8.RuneCountInString(sub.Label) > 64 {
+			return fmt.Errorf("subtitle track %s: label must be at most 64 characters", sub.ID)
+		}
+		vtt, err := toWebVTT([]byte(sub.VTT))
+		if err != nil {
+			return fmt.Errorf("subtitle track %s: %w", sub.ID, err)
+		}
+		sub.VTT = vtt
+	}
+	if rec.DefaultSubtitle != "" && !ids[rec.DefaultSubtitle] {
+		return errors.New("defaultSubtitle does not name a subtitle track")
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+
+	"main.go/static"
+)
+
+// Статический файл со сжатыми вариантами
+type asset struct {
+	name   string // исходное имя, например "css/style.css"
+	hashed string // имя с хешем: "css/style.3f2a9c1e.css"
+	hash   string
+	ctype  string
+	plain  []byte
+	gzip   []byte // nil, если сжатие не помогает
+	br     []byte // nil, если сжатие не помогает
+}
+
+// Загружает файлы из static, считает хеши и готовит gzip- и brotli-варианты
+func loadAssets() (map[string]*asset, error) {
+	assets := make(map[string]*asset)
+	err := fs.WalkDir(static.FS, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(static.FS, name)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:4])
+		ext := path.Ext(name)
+		a := &asset{
+			name:   name,
+			hashed: strings.TrimSuffix(name, ext) + "." + hash + ext,
+			hash:   hash,
+			ctype:  mime.TypeByExtension(ext),
+			plain:  data,
+		}
+		if a.ctype == "" {
+			a.ctype = "application/octet-stream"
+		}
+
+		var buf bytes.Buffer
+		zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		zw.Write(data)
+		zw.Close()
+		if buf.Len() < len(data) {
+			a.gzip = buf.Bytes()
+		}
+		var brBuf bytes.Buffer
+		bw := brotli.NewWriterLevel(&brBuf, brotli.BestCompression)
+		bw.Write(data)
+		bw.Close()
+		if brBuf.Len() < len(data) {
+			a.br = brBuf.Bytes()
+		}
+
+		// Доступен и по исходному имени, но без долгого кэша
+		assets[a.name] = a
+		assets[a.hashed] = a
+		return nil
+	})
+	return assets, err
+}
+
+// URL файла для шаблонов: с хешем и префиксом монтирования
+func (s *Server) assetURL(name string) (string, error) {
+	a, ok := s.assets[name]
+	if !ok {
+		return "", fs.ErrNotExist
+	}
+	return s.path("/static/" + a.hashed), nil
+}
+
+func (s *Server) staticHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("path")
+	a, ok := s.assets[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", a.ctype)
+	h.Set("Vary", "Accept-Encoding")
+	if name == a.hashed {
+		h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		h.Set("Cache-Control", "no-cache")
+	}
+
+	body, enc := a.plain, ""
+	switch {
+	case a.br != nil && acceptsEncoding(r, "br"):
+		body, enc = a.br, "br"
+	case a.gzip != nil && acceptsEncoding(r, "gzip"):
+		body, enc = a.gzip, "gzip"
+	}
+	if enc != "" {
+		h.Set("Content-Encoding", enc)
+		h.Set("ETag", `"`+a.hash+"-"+enc+`"`)
+	} else {
+		h.Set("ETag", `"`+a.hash+`"`)
+	}
+
+	// ServeContent сам отвечает 304 на If-None-Match
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+}
+
+// Разрешена ли кодировка в Accept-Encoding (q=0 — запрещена)
+func acceptsEncoding(r *http.Request, enc string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		token, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(token), enc) && strings.TrimSpace(token) != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
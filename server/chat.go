@@ -0,0 +1,199 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"main.go/protocol"
+)
+
+type ChatPolicy = protocol.ChatPolicy
+
+// Сколько помнить предыдущее сообщение для проверки повторов
+const duplicateWindow = 30 * time.Second
+
+func DefaultChatPolicy() ChatPolicy {
+	return ChatPolicy{MaxLength: 500}
+}
+
+// Правила чата для комнат, где они не заданы через API
+func WithChatPolicy(p ChatPolicy) Option {
+	return func(s *Server) { s.chat = p }
+}
+
+// Последнее принятое сообщение пользователя в комнате
+type lastChat struct {
+	text string // нормализованный текст
+	at   time.Time
+}
+
+var linkRe = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+func validateChatPolicy(p ChatPolicy) error {
+	if p.SlowModeSeconds < 0 || p.MaxLength < 0 || p.MaxLinks < 0 {
+		return errors.New("chat policy values must not be negative")
+	}
+	return nil
+}
+
+// Действующие правила чата комнаты
+func (s *Server) chatPolicy(r *Room) ChatPolicy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.chat != nil {
+		return *r.chat
+	}
+	return s.chat
+}
+
+// Проверка сообщения по правилам комнаты; пустая причина — сообщение принято
+// и запомнено для slow mode и проверки повторов
+func (c *Client) checkChat(text string) (reason string, retryAfter time.Duration) {
+	policy := c.srv.chatPolicy(c.room)
+	if policy.MaxLength > 0 && utf8.RuneCountInString(text) > policy.MaxLength {
+		return protocol.RejectTooLong, 0
+	}
+
+	moderator := c.owner
+	if !moderator {
+		if links := len(linkRe.FindAllStringIndex(text, -1)); links > 0 {
+			if policy.LinksModeratorsOnly {
+				return protocol.RejectLinksForbidden, 0
+			}
+			if policy.MaxLinks > 0 && links > policy.MaxLinks {
+				return protocol.RejectTooManyLinks, 0
+			}
+		}
+	}
+
+	norm := strings.ToLower(strings.Join(strings.Fields(text), " "))
+	now := time.Now()
+
+	// Имя из ?username= клиент выбирает сам и может сменить, переподключившись,
+	// поэтому slow mode и повторы считаем по адресу
+	c.room.mu.Lock()
+	defer c.room.mu.Unlock()
+	c.room.sweepChat(policy, now)
+	last, seen := c.room.lastChat[c.ip]
+	if seen && !moderator {
+		if slow := time.Duration(policy.SlowModeSeconds) * time.Second; slow > 0 {
+			if wait := last.at.Add(slow).Sub(now); wait > 0 {
+				return protocol.RejectSlowMode, wait
+			}
+		}
+		if policy.RejectDuplicates && last.text == norm && now.Sub(last.at) < duplicateWindow {
+			return protocol.RejectDuplicate, 0
+		}
+	}
+	c.room.lastChat[c.ip] = lastChat{text: norm, at: now}
+	return "", 0
+}
+
+// Раз в минуту выбрасывает записи, которые уже ни на что не влияют,
+// чтобы карта адресов не росла бесконечно; под r.mu
+func (r *Room) sweepChat(policy ChatPolicy, now time.Time) {
+	if now.Sub(r.chatSwept) < time.Minute {
+		return
+	}
+	keep := max(time.Duration(policy.SlowModeSeconds)*time.Second, duplicateWindow)
+	for k, last := range r.lastChat {
+		if now.Sub(last.at) >= keep {
+			delete(r.lastChat, k)
+		}
+	}
+	r.chatSwept = now
+}
+
+func (c *Client) rejectChat(reason, detail string, retryAfter time.Duration) {
+	c.srv.metrics.chatRejected.inc(reason)
+	c.log.Debug("chat message rejected", "reason", reason, "detail", detail)
+	data, _ := json.Marshal(Message{
+		Type: protocol.TypeChatRejected,
+		Data: protocol.ChatRejected{Reason: reason, Detail: detail, RetryAfterMs: retryAfter.Milliseconds()},
+		Time: time.Now().Unix(),
+	})
+	c.trySend(data)
+}
+
+// Текущие правила чата новому участнику
+func (c *Client) sendChatPolicy() {
+	data, _ := json.Marshal(Message{
+		Type: protocol.TypeChatPolicy,
+		Data: c.srv.chatPolicy(c.room),
+		Time: time.Now().Unix(),
+	})
+	c.trySend(data)
+}
+
+// Правила чата комнаты (JSON)
+func (s *Server) apiGetChatPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomID")
+	if !s.authorize(w, r, ActionViewRoom, roomID) {
+		return
+	}
+
+	room, exists := s.room(roomID)
+	if !exists {
+		writeError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.chatPolicy(room))
+}
+
+// Изменение правил чата: сохраняем и рассылаем участникам
+func (s *Server) apiSetChatPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomID")
+	if !s.authorize(w, r, ActionModerate, roomID) {
+		return
+	}
+
+	room, exists := s.room(roomID)
+	if !exists {
+		writeError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	if !s.requireOwner(w, r, room) {
+		return
+	}
+
+	var policy ChatPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		writeError(w, bodyStatus(err), "invalid JSON: "+err.Error())
+		return
+	}
+	if err := validateChatPolicy(policy); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	room.mu.Lock()
+	room.chat = &policy
+	room.mu.Unlock()
+
+	if err := s.store.Put(room.record()); err != nil {
+		s.logger.ErrorContext(r.Context(), "saving room failed", "room_id", roomID, "err", err)
+		writeError(w, http.StatusInternalServerError, "could not save room")
+		return
+	}
+
+	data, _ := json.Marshal(Message{Type: protocol.TypeChatPolicy, Data: policy, Time: time.Now().Unix()})
+	room.mu.RLock()
+	for client := range room.clients {
+		select {
+		case client.send <- data:
+		default:
+		}
+	}
+	room.mu.RUnlock()
+
+	s.logger.InfoContext(r.Context(), "chat policy changed", "room_id", roomID,
+		"slow_mode", policy.SlowModeSeconds, "reject_duplicates", policy.RejectDuplicates,
+		"max_length", policy.MaxLength, "max_links", policy.MaxLinks,
+		"links_moderators_only", policy.LinksModeratorsOnly)
+	writeJSON(w, http.StatusOK, policy)
+}
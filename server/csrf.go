@@ -0,0 +1,141 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Режимы флага Secure у cookie
+const (
+	SecureAuto   = "auto"   // только если запрос пришёл по HTTPS
+	SecureAlways = "always" // всегда
+	SecureNever  = "never"  // никогда (локальная разработка)
+)
+
+// Политика cookie, которые ставит сервер
+type CookiePolicy struct {
+	SameSite http.SameSite // по умолчанию Lax
+	Secure   string        // SecureAuto, SecureAlways или SecureNever
+}
+
+func DefaultCookiePolicy() CookiePolicy {
+	return CookiePolicy{SameSite: http.SameSiteLaxMode, Secure: SecureAuto}
+}
+
+// Страницы, с которых разрешено открывать WebSocket и слать формы и запросы API.
+// Элементы — "https://example.com", "https://*.example.com" или "*".
+// Свой собственный адрес (Host запроса или WithBaseURL) разрешён всегда.
+func WithAllowedOrigins(origins ...string) Option {
+	return func(s *Server) { s.origins = origins }
+}
+
+func WithCookiePolicy(p CookiePolicy) Option {
+	return func(s *Server) { s.cookies = p }
+}
+
+const csrfCookie = "vp_csrf"
+
+// Проверка заголовка Origin. Запросы без него приходят не из браузера
+// (CLI, Go-клиент, curl) и чужих cookie не несут, поэтому пропускаются.
+func (s *Server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	if s.baseURL != "" {
+		if b, err := url.Parse(s.baseURL); err == nil && strings.EqualFold(u.Host, b.Host) {
+			return true
+		}
+	}
+	for _, allowed := range s.origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		// https://*.example.com
+		if scheme, host, ok := strings.Cut(allowed, "://*."); ok &&
+			strings.EqualFold(u.Scheme, scheme) &&
+			strings.HasSuffix(strings.ToLower(u.Host), "."+strings.ToLower(host)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Запросы, меняющие состояние, с чужих страниц отклоняются
+func (s *Server) withOriginCheck(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !s.originAllowed(r) {
+				s.logger.WarnContext(r.Context(), "cross-origin request rejected", "origin", r.Header.Get("Origin"))
+				if strings.HasPrefix(r.URL.Path, "/api/") {
+					writeError(w, http.StatusForbidden, "origin not allowed")
+				} else {
+					http.Error(w, "Origin not allowed", http.StatusForbidden)
+				}
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Пришёл ли запрос по HTTPS (напрямую или через доверенный прокси)
+func (s *Server) isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if s.trustXFF && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		return true
+	}
+	return strings.HasPrefix(s.baseURL, "https://")
+}
+
+// Ставит cookie по политике сервера; путь ограничен префиксом монтирования
+func (s *Server) setCookie(w http.ResponseWriter, r *http.Request, c *http.Cookie) {
+	c.Path = s.path("/")
+	c.SameSite = s.cookies.SameSite
+	switch s.cookies.Secure {
+	case SecureAlways:
+		c.Secure = true
+	case SecureNever:
+		c.Secure = false
+	default:
+		c.Secure = s.isHTTPS(r)
+	}
+	http.SetCookie(w, c)
+}
+
+// CSRF-токен для формы (double-submit cookie): тот же токен лежит
+// в HttpOnly-cookie, чужая страница не может ни прочитать его, ни подставить
+func (s *Server) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(csrfCookie); err == nil && c.Value != "" && len(c.Value) <= 64 {
+		return c.Value
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+	s.setCookie(w, r, &http.Cookie{Name: csrfCookie, Value: token, HttpOnly: true})
+	return token
+}
+
+func (s *Server) validCSRF(r *http.Request, token string) bool {
+	c, err := r.Cookie(csrfCookie)
+	if err != nil || c.Value == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(token)) == 1
+}
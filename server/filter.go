@@ -0,0 +1,448 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+
+	"main.go/protocol"
+	"main.go/store"
+)
+
+// Что делать с сообщением, в котором нашлось слово из списка
+const (
+	WordMask   = "mask"   // заменить слово звёздочками
+	WordReject = "reject" // не отправлять сообщение
+	WordFlag   = "flag"   // отправить и показать модераторам
+)
+
+type WordList = store.WordList
+
+// Сообщение чата на пути через фильтры
+type ChatMessage struct {
+	Room      *Room
+	User      string
+	Moderator bool
+	Text      string
+}
+
+// Итог фильтра. Text возвращается всегда, даже если не изменился;
+// Reasons объясняют отправителю, что произошло с сообщением, а Flags
+// видят только модераторы.
+type FilterResult struct {
+	Text    string
+	Reject  bool
+	Reasons []string
+	Flags   []string
+}
+
+// Фильтр содержимого чата
+type ChatFilter interface {
+	FilterChat(msg ChatMessage) FilterResult
+}
+
+type ChatFilterFunc func(msg ChatMessage) FilterResult
+
+func (f ChatFilterFunc) FilterChat(msg ChatMessage) FilterResult {
+	return f(msg)
+}
+
+// Цепочка фильтров: каждый получает текст после предыдущего,
+// первый отказ останавливает цепочку
+type ChatFilters []ChatFilter
+
+func (fs ChatFilters) FilterChat(msg ChatMessage) FilterResult {
+	res := FilterResult{Text: msg.Text}
+	for _, f := range fs {
+		msg.Text = res.Text
+		r := f.FilterChat(msg)
+		res.Reasons = append(res.Reasons, r.Reasons...)
+		res.Flags = append(res.Flags, r.Flags...)
+		if r.Reject {
+			res.Reject = true
+			return res
+		}
+		res.Text = r.Text
+	}
+	return res
+}
+
+// Нормализация и пустой список слов, который комнаты могут дополнить через API
+func DefaultChatFilters() ChatFilters {
+	return ChatFilters{NormalizeFilter{}, &WordFilter{Action: WordMask}}
+}
+
+// Фильтры содержимого чата вместо DefaultChatFilters
+func WithChatFilters(filters ...ChatFilter) Option {
+	return func(s *Server) { s.filters = ChatFilters(filters) }
+}
+
+// Убирает невидимые и управляющие символы направления текста и приводит
+// полноширинные латинские буквы и цифры к обычным
+type NormalizeFilter struct{}
+
+func (NormalizeFilter) FilterChat(msg ChatMessage) FilterResult {
+	text := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 0xFF01 && r <= 0xFF5E:
+			return r - 0xFEE0
+		case r == 0x3000:
+			return ' '
+		case invisible(r):
+			return -1
+		}
+		return r
+	}, msg.Text)
+
+	res := FilterResult{Text: text}
+	if text != msg.Text {
+		res.Reasons = []string{"hidden and full-width characters were normalized"}
+	}
+	return res
+}
+
+// Символы нулевой ширины и управление направлением; ZWJ не трогаем — на нём
+// держатся составные эмодзи
+func invisible(r rune) bool {
+	switch {
+	case r == 0x00AD, r == 0x034F, r == 0x061C, r == 0x180E, r == 0xFEFF:
+	case r >= 0x200B && r <= 0x200C, r >= 0x200E && r <= 0x200F:
+	case r >= 0x202A && r <= 0x202E, r >= 0x2060 && r <= 0x2069:
+	case unicode.Is(unicode.Cc, r):
+	default:
+		return false
+	}
+	return true
+}
+
+// Похожие на латиницу кириллические и греческие буквы и «leet»-замены
+var confusables = map[rune]rune{
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ї': 'i', 'ј': 'j',
+	'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ӏ': 'l',
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's',
+}
+
+// «Скелет» слова для сравнения: нижний регистр, похожие буквы сведены
+// к латинице, всё кроме букв и цифр отброшено
+func skeleton(word string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(word) {
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func wordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '@' || r == '$'
+}
+
+// Список запрещённых слов. Слова сравниваются по скелету, так что «сlаss»
+// с кириллическими «с» и «а» совпадёт с «class». Комната может дополнить
+// или заменить список через API.
+type WordFilter struct {
+	Action string // WordMask (по умолчанию), WordReject или WordFlag
+	Words  []string
+}
+
+func (f *WordFilter) FilterChat(msg ChatMessage) FilterResult {
+	action, words := f.Action, f.Words
+	if msg.Room != nil {
+		if wl := msg.Room.wordList(); wl != nil {
+			if wl.Action != "" {
+				action = wl.Action
+			}
+			if wl.Replace {
+				words = wl.Words
+			} else {
+				words = append(words[:len(words):len(words)], wl.Words...)
+			}
+		}
+	}
+	if action == "" {
+		action = WordMask
+	}
+
+	res := FilterResult{Text: msg.Text}
+	if len(words) == 0 {
+		return res
+	}
+	blocked := make(map[string]bool, len(words))
+	for _, w := range words {
+		if k := skeleton(w); k != "" {
+			blocked[k] = true
+		}
+	}
+
+	// Проходим по словам исходного текста, заменяя найденные
+	var out strings.Builder
+	found := false
+	text := msg.Text
+	for len(text) > 0 {
+		i := strings.IndexFunc(text, wordRune)
+		if i < 0 {
+			out.WriteString(text)
+			break
+		}
+		out.WriteString(text[:i])
+		text = text[i:]
+		j := strings.IndexFunc(text, func(r rune) bool { return !wordRune(r) })
+		if j < 0 {
+			j = len(text)
+		}
+		word := text[:j]
+		text = text[j:]
+
+		if blocked[skeleton(word)] {
+			found = true
+			word = strings.Repeat("*", utf8.RuneCountInString(word))
+		}
+		out.WriteString(word)
+	}
+	if !found {
+		return res
+	}
+
+	switch action {
+	case WordReject:
+		res.Reject = true
+		res.Reasons = []string{"message contains a blocked word"}
+	case WordFlag:
+		res.Flags = []string{"contains a watched word"}
+	default:
+		res.Text = out.String()
+		res.Reasons = []string{"blocked words were masked"}
+	}
+	return res
+}
+
+// Списки адресов для ссылок. В Deny "example.com" совпадает с доменом и его
+// поддоменами, а похожие буквы и цифры сводятся к латинице. Allow сравнивается
+// точно: "example.com" — только сам домен, "*.example.com" — его поддомены;
+// если Allow не пуст, ссылки на другие адреса отклоняются.
+type URLFilter struct {
+	Allow []string
+	Deny  []string
+}
+
+func (f URLFilter) FilterChat(msg ChatMessage) FilterResult {
+	res := FilterResult{Text: msg.Text}
+	for _, link := range linkRe.FindAllString(msg.Text, -1) {
+		link = strings.TrimRight(link, ".,!?;:)]}'\"")
+		if !strings.Contains(link, "://") {
+			link = "http://" + link
+		}
+		u, err := url.Parse(link)
+		if err != nil || u.Hostname() == "" {
+			res.Reject = true
+			res.Reasons = []string{"message contains a malformed link"}
+			return res
+		}
+
+		denied := matchHost(f.Deny, hostSkeleton(u.Hostname()))
+		if denied || len(f.Allow) > 0 && !matchHostExact(f.Allow, asciiHost(u.Hostname())) {
+			res.Reject = true
+			res.Reasons = []string{"links to " + u.Hostname() + " are not allowed"}
+			return res
+		}
+	}
+	return res
+}
+
+// Скелет каждой метки домена, чтобы похожие буквы не обходили запрет
+func hostSkeleton(host string) string {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(host, ".")), ".")
+	for i, l := range labels {
+		labels[i] = skeleton(l)
+	}
+	return strings.Join(labels, ".")
+}
+
+func matchHost(patterns []string, host string) bool {
+	for _, p := range patterns {
+		p = hostSkeleton(strings.TrimPrefix(p, "*."))
+		if p != "" && (host == p || strings.HasSuffix(host, "."+p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Имя хоста для точного сравнения: нижний регистр, IDNA в ASCII (xn--),
+// без точки в конце; пусто — имя некорректно
+func asciiHost(host string) string {
+	host = strings.TrimSuffix(host, ".")
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return ""
+	}
+	return ascii
+}
+
+// Точное совпадение: "example.com" — только сам домен, "*.example.com" —
+// только его поддомены. Похожие буквы не сводятся: «examp1e.com» не «example.com».
+func matchHostExact(patterns []string, host string) bool {
+	if host == "" {
+		return false
+	}
+	for _, p := range patterns {
+		if suffix, ok := strings.CutPrefix(p, "*."); ok {
+			if suffix = asciiHost(suffix); suffix != "" && strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if asciiHost(p) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// Список слов комнаты; nil — только список сервера
+func (r *Room) wordList() *WordList {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.words
+}
+
+// Прогоняем сообщение через фильтры; false — сообщение отклонено
+func (c *Client) filterChat(text string) (string, FilterResult, bool) {
+	res := c.srv.filters.FilterChat(ChatMessage{
+		Room:      c.room,
+		User:      c.username,
+		Moderator: c.owner,
+		Text:      text,
+	})
+	switch {
+	case res.Reject:
+		c.srv.metrics.chatFiltered.inc("rejected")
+		c.rejectChat(protocol.RejectFiltered, strings.Join(res.Reasons, "; "), 0)
+		return "", res, false
+	case len(res.Flags) > 0:
+		c.srv.metrics.chatFiltered.inc("flagged")
+	case res.Text != text:
+		c.srv.metrics.chatFiltered.inc("altered")
+	}
+	return strings.TrimSpace(res.Text), res, true
+}
+
+// Отправителю — что фильтры сделали с сообщением, модераторам — помеченные
+func (c *Client) reportFiltered(text string, res FilterResult) {
+	if len(res.Reasons) > 0 {
+		data, _ := json.Marshal(Message{
+			Type: protocol.TypeChatFiltered,
+			Data: protocol.ChatFiltered{Text: text, Reasons: res.Reasons},
+			Time: time.Now().Unix(),
+		})
+		c.trySend(data)
+	}
+	if len(res.Flags) == 0 {
+		return
+	}
+
+	c.log.Warn("chat message flagged", "text", text, "reasons", res.Flags)
+	data, _ := json.Marshal(Message{
+		Type: protocol.TypeChatFlagged,
+		Data: protocol.ChatFlagged{User: c.username, Text: text, Reasons: res.Flags},
+		Time: time.Now().Unix(),
+	})
+	c.room.mu.RLock()
+	for client := range c.room.clients {
+		if client.owner {
+			select {
+			case client.send <- data:
+			default:
+			}
+		}
+	}
+	c.room.mu.RUnlock()
+}
+
+func validWordAction(action string) bool {
+	return action == "" || action == WordMask || action == WordReject || action == WordFlag
+}
+
+// Список слов комнаты (JSON)
+func (s *Server) apiGetWordListHandler(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomID")
+	if !s.authorize(w, r, ActionModerate, roomID) {
+		return
+	}
+
+	room, exists := s.room(roomID)
+	if !exists {
+		writeError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	if !s.requireOwner(w, r, room) {
+		return
+	}
+	wl := room.wordList()
+	if wl == nil {
+		wl = &WordList{Words: []string{}}
+	}
+	writeJSON(w, http.StatusOK, wl)
+}
+
+// Замена списка слов комнаты; пустой список без действия возвращает список сервера
+func (s *Server) apiSetWordListHandler(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomID")
+	if !s.authorize(w, r, ActionModerate, roomID) {
+		return
+	}
+
+	room, exists := s.room(roomID)
+	if !exists {
+		writeError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	if !s.requireOwner(w, r, room) {
+		return
+	}
+
+	var wl WordList
+	if err := json.NewDecoder(r.Body).Decode(&wl); err != nil {
+		writeError(w, bodyStatus(err), "invalid JSON: "+err.Error())
+		return
+	}
+	if !validWordAction(wl.Action) {
+		writeError(w, http.StatusBadRequest, "action must be mask, reject or flag")
+		return
+	}
+	if wl.Words == nil {
+		wl.Words = []string{}
+	}
+
+	room.mu.Lock()
+	if len(wl.Words) == 0 && wl.Action == "" && !wl.Replace {
+		room.words = nil
+	} else {
+		room.words = &wl
+	}
+	room.mu.Unlock()
+
+	if err := s.store.Put(room.record()); err != nil {
+		s.logger.ErrorContext(r.Context(), "saving room failed", "room_id", roomID, "err", err)
+		writeError(w, http.StatusInternalServerError, "could not save room")
+		return
+	}
+	s.logger.InfoContext(r.Context(), "word list changed", "room_id", roomID,
+		"words", len(wl.Words), "action", wl.Action, "replace", wl.Replace)
+	writeJSON(w, http.StatusOK, wl)
+}
@@ -0,0 +1,134 @@
+package server
+
+import "testing"
+
+func TestURLFilter(t *testing.T) {
+	f := URLFilter{
+		Allow: []string{"example.com", "*.cdn.example.org", "пример.рф"},
+		Deny:  []string{"bad.com"},
+	}
+	tests := []struct {
+		text   string
+		reject bool
+	}{
+		{"no links here", false},
+		{"see https://example.com/watch", false},
+		{"see https://EXAMPLE.com./watch", false},
+		{"see www.example.com", true}, // поддомен не разрешён
+		{"see https://a.cdn.example.org/v.mp4", false},
+		{"see https://cdn.example.org/v.mp4", true}, // "*." — только поддомены
+		{"see https://x.a.cdn.example.org/", false},
+		{"see https://evilcdn.example.org/", true},
+		{"see https://examp1e.com/", true},  // цифра вместо буквы
+		{"see https://ex-ample.com/", true}, // дефис не отбрасывается
+		{"see https://ехample.com/", true},  // кириллические «е» и «х»
+		{"see https://example.com.evil/", true},
+		{"see https://пример.рф/", false},
+		{"see https://xn--e1afmkfd.xn--p1ai/", false},
+		{"see https://bad.com/", true},
+		{"see https://b4d.com/", true},     // Deny сводит похожие знаки
+		{"see https://www.bаd.com/", true}, // и кириллицу, и поддомены
+		{"see https://example.com/ and https://other.net/", true},
+		{"see http://exa mple.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			res := f.FilterChat(ChatMessage{Text: tt.text})
+			if res.Reject != tt.reject {
+				t.Errorf("reject %v, want %v (%v)", res.Reject, tt.reject, res.Reasons)
+			}
+		})
+	}
+}
+
+func TestURLFilterDenyOnly(t *testing.T) {
+	f := URLFilter{Deny: []string{"*.bad.com"}}
+	tests := []struct {
+		text   string
+		reject bool
+	}{
+		{"https://bad.com", true},
+		{"https://cdn.bad.com", true},
+		{"https://cdn.b-a-d.com", true},
+		{"https://notbad.com", false},
+		{"https://good.org", false},
+	}
+	for _, tt := range tests {
+		if res := f.FilterChat(ChatMessage{Text: tt.text}); res.Reject != tt.reject {
+			t.Errorf("%q: reject %v, want %v", tt.text, res.Reject, tt.reject)
+		}
+	}
+}
+
+func TestHostSkeleton(t *testing.T) {
+	tests := []struct{ host, want string }{
+		{"Example.COM.", "example.com"},
+		{"ex-ample.com", "example.com"},
+		{"examp1e.c0m", "exampie.com"},
+		{"ехаmрlе.com", "example.com"},
+		{"αβ.com", "ab.com"},
+	}
+	for _, tt := range tests {
+		if got := hostSkeleton(tt.host); got != tt.want {
+			t.Errorf("hostSkeleton(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestAsciiHost(t *testing.T) {
+	tests := []struct{ host, want string }{
+		{"Example.COM", "example.com"},
+		{"example.com.", "example.com"},
+		{"пример.рф", "xn--e1afmkfd.xn--p1ai"},
+		{"ｅｘａｍｐｌｅ.com", "example.com"},
+		{"127.0.0.1", "127.0.0.1"},
+		{"::1", "::1"},
+		{"exa mple.com", ""},
+		{"ex_ample.com", ""},
+	}
+	for _, tt := range tests {
+		if got := asciiHost(tt.host); got != tt.want {
+			t.Errorf("asciiHost(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeFilter(t *testing.T) {
+	tests := []struct {
+		text, want string
+		changed    bool
+	}{
+		{"hello", "hello", false},
+		{"he\u200bllo", "hello", true},
+		{"\u202eolleh", "olleh", true},
+		{"ｈｅｌｌｏ\u3000１", "hello 1", true},
+		{"👨\u200d👩", "👨\u200d👩", false}, // ZWJ держит эмодзи
+	}
+	for _, tt := range tests {
+		res := NormalizeFilter{}.FilterChat(ChatMessage{Text: tt.text})
+		if res.Text != tt.want || (len(res.Reasons) > 0) != tt.changed {
+			t.Errorf("%q: got %q %v, want %q", tt.text, res.Text, res.Reasons, tt.want)
+		}
+	}
+}
+
+func TestWordFilter(t *testing.T) {
+	tests := []struct {
+		action, text, want string
+		reject, flagged    bool
+	}{
+		{WordMask, "no spam here", "no **** here", false, false},
+		{WordMask, "SP4M!", "****!", false, false},
+		{WordMask, "ѕраm", "****", false, false},
+		{WordMask, "spammer", "spammer", false, false},
+		{WordReject, "spam", "spam", true, false},
+		{WordFlag, "spam", "spam", false, true},
+	}
+	for _, tt := range tests {
+		f := &WordFilter{Action: tt.action, Words: []string{"spam"}}
+		res := f.FilterChat(ChatMessage{Text: tt.text})
+		if res.Text != tt.want || res.Reject != tt.reject || (len(res.Flags) > 0) != tt.flagged {
+			t.Errorf("%s %q: got %q reject=%v flags=%v", tt.action, tt.text, res.Text, res.Reject, res.Flags)
+		}
+	}
+}
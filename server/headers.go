@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Заголовки безопасности ответа. В CSP подставляются {nonce} — свой для
+// каждого запроса — и {frame-src} из FrameSources.
+type SecurityHeaders struct {
+	CSP               string        // пусто — без Content-Security-Policy
+	FrameSources      []string      // кроме плееров провайдеров видео, что ещё можно встраивать в iframe
+	HSTSMaxAge        time.Duration // Strict-Transport-Security для HTTPS; 0 — не отправлять
+	ReferrerPolicy    string
+	PermissionsPolicy string
+}
+
+// Политика страниц: скрипты только свои и с nonce, стили только свои,
+// iframe — только встроенные плееры поддерживаемых сервисов
+const DefaultCSP = "default-src 'self'; script-src 'self' 'nonce-{nonce}'; style-src 'self'; " +
+	"img-src 'self' data:; media-src * blob:; connect-src 'self'; frame-src {frame-src}; " +
+	"object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'self'"
+
+func DefaultSecurityHeaders() SecurityHeaders {
+	return SecurityHeaders{
+		CSP:               DefaultCSP,
+		HSTSMaxAge:        180 * 24 * time.Hour,
+		ReferrerPolicy:    "strict-origin-when-cross-origin",
+		PermissionsPolicy: "camera=(), microphone=(), geolocation=(), payment=(), usb=()",
+	}
+}
+
+// Заголовки для всех маршрутов
+func WithSecurityHeaders(h SecurityHeaders) Option {
+	return func(s *Server) { s.security = h }
+}
+
+// Поправка заголовков одного маршрута, например
+// WithRouteHeaders("GET /room/{roomID}", func(h *SecurityHeaders) { h.CSP = "" }).
+// Применяется после поправки из таблицы маршрутов.
+func WithRouteHeaders(pattern string, fn func(h *SecurityHeaders)) Option {
+	return func(s *Server) {
+		if s.routeSecurity == nil {
+			s.routeSecurity = make(map[string]func(*SecurityHeaders))
+		}
+		s.routeSecurity[pattern] = fn
+	}
+}
+
+// Ответы без HTML (JSON, метрики): грузить и встраивать нечего
+func apiHeaders(h *SecurityHeaders) {
+	h.CSP = "default-src 'none'; frame-ancestors 'none'"
+}
+
+const cspNonceKey ctxKey = iota + 100
+
+// Nonce CSP текущего запроса для атрибута nonce у <script>
+func CSPNonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(cspNonceKey).(string)
+	return nonce
+}
+
+// Оборачивает обработчик маршрута заголовками его политики
+func (s *Server) withSecurityHeaders(rt route, next http.HandlerFunc) http.HandlerFunc {
+	h := s.security
+	h.FrameSources = append([]string(nil), h.FrameSources...)
+	if rt.Security != nil {
+		rt.Security(&h)
+	}
+	if fn, ok := s.routeSecurity[rt.Pattern]; ok {
+		fn(&h)
+	}
+
+	frameSrc := "'none'"
+	if len(h.FrameSources) > 0 {
+		frameSrc = strings.Join(h.FrameSources, " ")
+	}
+	csp := strings.ReplaceAll(h.CSP, "{frame-src}", frameSrc)
+	needNonce := strings.Contains(csp, "{nonce}")
+	hsts := ""
+	if h.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.FormatInt(int64(h.HSTSMaxAge/time.Second), 10)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		hdr := w.Header()
+		hdr.Set("X-Content-Type-Options", "nosniff")
+		if h.ReferrerPolicy != "" {
+			hdr.Set("Referrer-Policy", h.ReferrerPolicy)
+		}
+		if h.PermissionsPolicy != "" {
+			hdr.Set("Permissions-Policy", h.PermissionsPolicy)
+		}
+		if hsts != "" && s.isHTTPS(r) {
+			hdr.Set("Strict-Transport-Security", hsts)
+		}
+		if csp != "" {
+			policy := csp
+			if needNonce {
+				b := make([]byte, 16)
+				rand.Read(b)
+				nonce := base64.StdEncoding.EncodeToString(b)
+				policy = strings.ReplaceAll(policy, "{nonce}", nonce)
+				r = r.WithContext(context.WithValue(r.Context(), cspNonceKey, nonce))
+			}
+			hdr.Set("Content-Security-Policy", policy)
+		}
+		next(w, r)
+	}
+}
+
+// Дописывает источники в connect-src уже выставленной политики. Нужна
+// страницам, которые узнают адрес только в обработчике: проигрыватель
+// потока качает манифест и сегменты через fetch. Без директивы connect-src
+// политику не трогаем — её задаёт default-src.
+func addConnectSources(w http.ResponseWriter, sources ...string) {
+	policy := w.Header().Get("Content-Security-Policy")
+	if policy == "" || len(sources) == 0 {
+		return
+	}
+	directives := strings.Split(policy, ";")
+	for i, d := range directives {
+		fields := strings.Fields(d)
+		if len(fields) == 0 || fields[0] != "connect-src" {
+			continue
+		}
+		for _, f := range fields[1:] {
+			if f == "*" {
+				return
+			}
+		}
+		if len(fields) == 2 && fields[1] == "'none'" {
+			fields = fields[:1]
+		}
+		directives[i] = " " + strings.Join(append(fields, sources...), " ")
+		if i == 0 {
+			directives[i] = directives[i][1:]
+		}
+		w.Header().Set("Content-Security-Policy", strings.Join(directives, ";"))
+		return
+	}
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"main.go/mediainfo"
+	"main.go/store"
+)
+
+// Файл медиатеки
+type MediaItem struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"` // путь относительно каталога медиатеки
+	Size     int64     `json:"size"`
+	Duration float64   `json:"duration,omitempty"` // секунды; 0 — узнать не удалось
+	Width    int       `json:"width,omitempty"`
+	Height   int       `json:"height,omitempty"`
+	Codecs   []string  `json:"codecs,omitempty"`
+	Type     string    `json:"type"`
+	ModTime  time.Time `json:"modTime"`
+
+	path string
+}
+
+// ETag по размеру и времени изменения: файл заменили — кэш браузера устарел
+func (m *MediaItem) etag() string {
+	return `"` + strconv.FormatInt(m.Size, 36) + "-" + strconv.FormatInt(m.ModTime.UnixNano(), 36) + `"`
+}
+
+// Медиатека: видеофайлы из каталога на сервере. Каталог перечитывается при
+// обращении, если с прошлого раза прошло больше rescan.
+type Library struct {
+	dir    string
+	rescan time.Duration
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	items   map[string]*MediaItem
+	list    []*MediaItem
+	scanned time.Time
+}
+
+// Раздавать видео из каталога dir; rescan — как часто искать новые файлы
+// (0 — только при запуске)
+func WithMediaLibrary(dir string, rescan time.Duration) Option {
+	return func(s *Server) {
+		if dir == "" {
+			s.library = nil
+			return
+		}
+		s.library = &Library{dir: dir, rescan: rescan}
+	}
+}
+
+// ID файла зависит только от пути, чтобы комнаты переживали перезапуск
+func mediaID(rel string) string {
+	sum := sha256.Sum256([]byte(rel))
+	return base64.RawURLEncoding.EncodeToString(sum[:9])
+}
+
+// Обход каталога. Заголовки известных файлов не перечитываются,
+// если не изменились размер и время изменения.
+func (l *Library) scan() error {
+	items := make(map[string]*MediaItem)
+	err := filepath.WalkDir(l.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != l.dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		typ, ok := videoFileTypes[strings.ToLower(path.Ext(d.Name()))]
+		if d.IsDir() || !ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.dir, p)
+		if err != nil {
+			return nil
+		}
+		item := l.item(rel, p, typ, info)
+		items[item.ID] = item
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	list := make([]*MediaItem, 0, len(items))
+	for _, item := range items {
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	l.items, l.list, l.scanned = items, list, time.Now()
+	return nil
+}
+
+// Описание файла; разбор заголовков берётся из прошлого обхода, если файл не менялся
+func (l *Library) item(rel, p, typ string, info fs.FileInfo) *MediaItem {
+	rel = filepath.ToSlash(rel)
+	item := &MediaItem{
+		ID:      mediaID(rel),
+		Name:    rel,
+		Size:    info.Size(),
+		Type:    typ,
+		ModTime: info.ModTime(),
+		path:    p,
+	}
+	if old, ok := l.items[item.ID]; ok && old.Size == item.Size && old.ModTime.Equal(item.ModTime) {
+		item.Duration, item.Width, item.Height, item.Codecs = old.Duration, old.Width, old.Height, old.Codecs
+	} else if mi, err := mediainfo.ProbeFile(p); err == nil {
+		fi := fileInfo(mi)
+		item.Duration, item.Width, item.Height, item.Codecs = fi.Duration, fi.Width, fi.Height, fi.Codecs
+	} else {
+		l.logger.Debug("probing media file failed", "file", rel, "err", err)
+	}
+	return item
+}
+
+// Добавляет в медиатеку новый файл из её каталога, не дожидаясь обхода
+func (l *Library) add(p, typ string) (MediaItem, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return MediaItem{}, err
+	}
+	rel, err := filepath.Rel(l.dir, p)
+	if err != nil {
+		return MediaItem{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	item := l.item(rel, p, typ, info)
+	if _, ok := l.items[item.ID]; !ok {
+		l.list = append(l.list, item)
+	} else {
+		for i, old := range l.list {
+			if old.ID == item.ID {
+				l.list[i] = item
+			}
+		}
+	}
+	l.items[item.ID] = item
+	sort.Slice(l.list, func(i, j int) bool { return l.list[i].Name < l.list[j].Name })
+	return *item, nil
+}
+
+// Перечитывает каталог, если пора; ошибка оставляет прежний список
+func (l *Library) refresh() {
+	if l.rescan <= 0 || time.Since(l.scanned) < l.rescan {
+		return
+	}
+	if err := l.scan(); err != nil {
+		l.logger.Error("scanning media library failed", "dir", l.dir, "err", err)
+		l.scanned = time.Now()
+	}
+}
+
+// Файлы по имени
+func (l *Library) Items() []MediaItem {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refresh()
+	out := make([]MediaItem, len(l.list))
+	for i, item := range l.list {
+		out[i] = *item
+	}
+	return out
+}
+
+func (l *Library) Get(id string) (MediaItem, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refresh()
+	item, ok := l.items[id]
+	if !ok {
+		return MediaItem{}, false
+	}
+	return *item, true
+}
+
+// Файл медиатеки; false — медиатеки нет или файла в ней нет
+func (s *Server) libraryItem(id string) (MediaItem, bool) {
+	if s.library == nil {
+		return MediaItem{}, false
+	}
+	return s.library.Get(id)
+}
+
+// Комната по файлу медиатеки: ссылки и альтернативные источники не нужны
+func (s *Server) checkLibraryMedia(rec *store.Room) error {
+	if rec.VideoURL != "" {
+		return &MediaError{Reason: "give either a video URL or a library file, not both"}
+	}
+	if len(rec.Sources) > 0 {
+		return &MediaError{Reason: "alternate sources are only for direct video links"}
+	}
+	item, ok := s.libraryItem(rec.MediaID)
+	if !ok {
+		return &MediaError{Reason: "no such file in the media library"}
+	}
+	if err := checkCodecs(item.Name, item.Codecs); err != nil {
+		return err
+	}
+	rec.VideoType = item.Type
+	rec.File = &FileInfo{Duration: item.Duration, Width: item.Width, Height: item.Height, Codecs: item.Codecs}
+	return nil
+}
+
+// Адрес файла медиатеки для <video>
+func (s *Server) mediaPath(id string) string {
+	return s.path("/media/" + url.PathEscape(id))
+}
+
+// Список файлов медиатеки (JSON)
+func (s *Server) apiListMediaHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, ActionListMedia, "") {
+		return
+	}
+	items := []MediaItem{}
+	if s.library != nil {
+		items = s.library.Items()
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// Файл медиатеки. http.ServeContent отвечает на Range, If-Range,
+// If-None-Match и If-Modified-Since, так что перемотка в <video> работает.
+func (s *Server) mediaHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("mediaID")
+	if !s.authorize(w, r, ActionViewMedia, "") {
+		return
+	}
+	item, ok := s.libraryItem(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(item.path)
+	if err != nil {
+		s.logger.WarnContext(r.Context(), "opening media file failed", "media_id", id, "err", err)
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	item.Size, item.ModTime = info.Size(), info.ModTime()
+
+	// Фильм отдаётся дольше, чем WriteTimeout сервера
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	h := w.Header()
+	h.Set("ETag", item.etag())
+	h.Set("Content-Type", item.Type)
+	h.Set("Cache-Control", "private, no-cache")
+	http.ServeContent(w, r, item.Name, item.ModTime, f)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Ограничивает размер тела запроса; превышение видно обработчику
+// как *http.MaxBytesError при чтении
+func limitBody(n int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		next(w, r)
+	}
+}
+
+// Код ответа для ошибки чтения тела: 413, если превышен предел маршрута
+func bodyStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// Адрес клиента. За прокси берём последний адрес из X-Forwarded-For —
+// его дописал сам прокси, остальные клиент мог подставить.
+func (s *Server) clientIP(r *http.Request) string {
+	if s.trustXFF {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Занимает место под WebSocket-соединение. Возвращает 0 или код отказа:
+// 503 при общем пределе, 429 при пределе на адрес.
+func (s *Server) acquireConn(ip string) int {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	if s.limits.MaxConns > 0 && s.conns >= s.limits.MaxConns {
+		return http.StatusServiceUnavailable
+	}
+	if s.limits.MaxConnsPerIP > 0 && s.connsByIP[ip] >= s.limits.MaxConnsPerIP {
+		return http.StatusTooManyRequests
+	}
+	s.conns++
+	s.connsByIP[ip]++
+	return 0
+}
+
+func (s *Server) releaseConn(ip string) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	s.conns--
+	if s.connsByIP[ip]--; s.connsByIP[ip] <= 0 {
+		delete(s.connsByIP, ip)
+	}
+}
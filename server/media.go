@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"main.go/mediainfo"
+	"main.go/store"
+)
+
+type (
+	VideoSource = store.VideoSource
+	FileInfo    = store.FileInfo
+)
+
+// Ссылка на файл, который браузеры не проигрывают; комнату с ним не создаём
+var ErrUnplayable = errors.New("video format can't be played in browsers")
+
+// Ошибка в описании видео комнаты; текст можно показать создателю
+type MediaError struct {
+	URL    string
+	Reason string
+	Err    error // ErrUnplayable или nil
+}
+
+func (e *MediaError) Error() string {
+	return e.Reason
+}
+
+func (e *MediaError) Unwrap() error {
+	return e.Err
+}
+
+// Сколько альтернативных источников можно указать у комнаты
+const maxVideoSources = 5
+
+// Форматы, которые есть смысл узнавать, но не встраивать
+var unplayableTypes = map[string]string{
+	".avi":  "video/x-msvideo",
+	".mkv":  "video/x-matroska",
+	".flv":  "video/x-flv",
+	".wmv":  "video/x-ms-wmv",
+	".mpg":  "video/mpeg",
+	".mpeg": "video/mpeg",
+	// QuickTime часто с кодеками, которых браузеры не знают (ProRes, HEVC)
+	".mov": "video/quicktime",
+}
+
+// Проверять Content-Type ссылок без понятного расширения запросом HEAD.
+// client == nil отключает проверку; по умолчанию выключена, потому что
+// сервер ходит по адресу, который прислал пользователь. Клиент не должен
+// ходить во внутреннюю сеть — подойдёт PublicHTTPClient.
+func WithMediaProbe(client *http.Client) Option {
+	return func(s *Server) { s.probe = client }
+}
+
+// Тип файла по расширению в пути ссылки (query и фрагмент не учитываются)
+func mediaTypeByPath(u *url.URL) (typ string, playable bool) {
+	ext := strings.ToLower(path.Ext(u.Path))
+	if t, ok := videoFileTypes[ext]; ok {
+		return t, true
+	}
+	return unplayableTypes[ext], false
+}
+
+func playableType(typ string) bool {
+	for _, t := range videoFileTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// HEAD-запрос за Content-Type; пустая строка — узнать не удалось
+func (s *Server) probeMediaType(ctx context.Context, rawURL string) string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return ""
+	}
+	resp, err := s.probe.Do(req)
+	if err != nil {
+		s.logger.DebugContext(ctx, "media probe failed", "url", rawURL, "err", err)
+		return ""
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return ""
+	}
+	typ, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return typ
+}
+
+// Описание файла для комнаты
+func fileInfo(info *mediainfo.Info) *FileInfo {
+	w, h := info.Size()
+	return &FileInfo{Duration: info.Duration, Width: w, Height: h, Codecs: info.Codecs()}
+}
+
+// Отказ, если в файле есть дорожки, которые браузеры не играют
+func checkCodecs(rawURL string, codecs []string) error {
+	var bad []string
+	for _, c := range codecs {
+		if !mediainfo.Playable(c) {
+			bad = append(bad, c)
+		}
+	}
+	if len(bad) == 0 {
+		return nil
+	}
+	return &MediaError{
+		URL:    rawURL,
+		Reason: fmt.Sprintf("the video uses %s, which browsers can't play; convert it to MP4 (H.264/AAC) or WebM (VP9/Opus)", strings.Join(bad, ", ")),
+		Err:    ErrUnplayable,
+	}
+}
+
+// Заголовки файла по ссылке через Range; nil — файл не скачать или формат
+// не MP4/WebM (тогда о нём просто ничего не известно)
+func (s *Server) probeFile(ctx context.Context, rawURL string) *FileInfo {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	info, err := mediainfo.ProbeURL(ctx, s.probe, rawURL)
+	if err != nil {
+		s.logger.DebugContext(ctx, "probing video file failed", "url", rawURL, "err", err)
+		return nil
+	}
+	return fileInfo(info)
+}
+
+// Тип файла по ссылке: по расширению, иначе, если разрешено, по HEAD.
+// Пустой тип — ссылка не на файл (или его не узнать).
+func (s *Server) mediaType(ctx context.Context, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", &MediaError{URL: rawURL, Reason: "video links must be http or https URLs"}
+	}
+
+	typ, playable := mediaTypeByPath(u)
+	if typ == "" && s.probe != nil {
+		typ = s.probeMediaType(ctx, rawURL)
+		if !strings.HasPrefix(typ, "video/") {
+			return "", nil
+		}
+		playable = playableType(typ)
+	}
+	if typ != "" && !playable {
+		what := strings.ToLower(path.Ext(u.Path))
+		if _, ok := unplayableTypes[what]; !ok {
+			what = typ
+		}
+		return "", &MediaError{
+			URL:    rawURL,
+			Reason: fmt.Sprintf("%s files can't be played in browsers; convert the video to MP4 (H.264/AAC) or WebM", what),
+			Err:    ErrUnplayable,
+		}
+	}
+	return typ, nil
+}
+
+// Проверка видео новой комнаты: тип и кодеки основного файла,
+// альтернативные источники и постер; у потоков HLS/DASH — манифест. Ссылки на
+// видеосервисы не трогаем.
+func (s *Server) checkMedia(ctx context.Context, rec *store.Room) error {
+	if rec.MediaID != "" {
+		if rec.Proxy {
+			return &MediaError{Reason: "library files are already served by this server"}
+		}
+		if err := s.checkLibraryMedia(rec); err != nil {
+			return err
+		}
+	}
+	if rec.Poster != "" {
+		u, err := url.Parse(rec.Poster)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return &MediaError{URL: rec.Poster, Reason: "poster must be an http or https URL"}
+		}
+	}
+	if len(rec.Sources) > maxVideoSources {
+		return &MediaError{Reason: fmt.Sprintf("at most %d alternate sources are allowed", maxVideoSources)}
+	}
+	if rec.MediaID != "" {
+		return nil
+	}
+
+	_, p := s.videos.Resolve(rec.VideoURL)
+	direct := p == nil || p.Name() == (VideoFile{}).Name()
+	if rec.Proxy && !direct {
+		return &MediaError{Reason: "only direct video files can be played through the server"}
+	}
+	switch {
+	case direct:
+	case p.Name() == (HLS{}).Name() || p.Name() == (DASH{}).Name():
+		// У потока свои варианты качества; постер показывается до начала
+		if len(rec.Sources) > 0 {
+			return &MediaError{Reason: "alternate sources are only for direct video files"}
+		}
+		if s.probe == nil {
+			return nil
+		}
+		info, err := s.probeStream(ctx, p.Name(), rec.VideoURL)
+		if err != nil {
+			return err
+		}
+		rec.Stream = info
+		return nil
+	default:
+		if len(rec.Sources) > 0 || rec.Poster != "" {
+			return &MediaError{Reason: "alternate sources and posters are only for direct video files"}
+		}
+		return nil
+	}
+
+	typ, err := s.mediaType(ctx, rec.VideoURL)
+	if err != nil {
+		return err
+	}
+	rec.VideoType = typ
+	if rec.Proxy {
+		if typ == "" {
+			return &MediaError{URL: rec.VideoURL, Reason: "only direct video files can be played through the server"}
+		}
+		if err := s.checkProxy(rec); err != nil {
+			return err
+		}
+	}
+	if typ != "" && s.probe != nil {
+		if rec.File = s.probeFile(ctx, rec.VideoURL); rec.File != nil {
+			if err := checkCodecs(rec.VideoURL, rec.File.Codecs); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, src := range rec.Sources {
+		typ, err := s.mediaType(ctx, src.URL)
+		if err != nil {
+			return err
+		}
+		if src.Type == "" {
+			rec.Sources[i].Type = typ
+		}
+	}
+	return nil
+}
+
+// Встраивание видео комнаты: файл медиатеки или провайдер по ссылке, плюс
+// тип, постер и альтернативные источники, если это файл, или разбор
+// манифеста потока
+func (s *Server) roomVideo(r *http.Request, room *Room) VideoEmbed {
+	if room.MediaID != "" {
+		link := s.mediaPath(room.MediaID)
+		return VideoEmbed{
+			Kind:     "video",
+			Provider: "library",
+			URL:      s.absURL(r, "/media/"+url.PathEscape(room.MediaID)),
+			EmbedURL: link,
+			MIME:     room.VideoType,
+			Poster:   room.Poster,
+			Player:   "html5",
+			Caps:     VideoCaps{Seekable: true},
+		}
+	}
+
+	e := s.videos.Embed(room.VideoURL, EmbedOptions{Host: s.pageHost(r), Origin: s.pageOrigin(r)})
+
+	// Ссылка без расширения, но HEAD показал видео
+	if e.Kind == "link" && room.VideoType != "" {
+		e = VideoEmbed{Kind: "video", URL: room.VideoURL, EmbedURL: room.VideoURL, Player: "html5", Caps: VideoCaps{Seekable: true}}
+	}
+	if e.Kind == "stream" {
+		e.Poster = room.Poster
+		e.Stream = room.Stream
+		e.Caps = streamCaps(e.Caps, room.Stream)
+		return e
+	}
+	if e.Kind != "video" {
+		return e
+	}
+	if room.VideoType != "" {
+		e.MIME = room.VideoType
+	}
+	e.Sources = room.Sources
+	e.Poster = room.Poster
+	// Через прокси файлы идут с нашего origin; «открыть оригинал» ведёт на исходную ссылку
+	if room.Proxy && s.proxy != nil {
+		e.EmbedURL = s.proxyPath(room.ID, 0)
+		e.Sources = make([]VideoSource, len(room.Sources))
+		for i, src := range room.Sources {
+			e.Sources[i] = VideoSource{URL: s.proxyPath(room.ID, i+1), Type: src.Type}
+		}
+	}
+	return e
+}
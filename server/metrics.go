@@ -0,0 +1,207 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"main.go/protocol"
+)
+
+// Метрики в текстовом формате Prometheus. Счётчики принадлежат
+// экземпляру Server, поэтому несколько серверов в процессе не мешают друг другу.
+type metrics struct {
+	messages       counterVec // входящие сообщения по типу
+	rateLimited    counterVec // отказы по бюджету: http, client, room
+	chatRejected   counterVec // сообщения чата, не прошедшие правила комнаты
+	chatFiltered   counterVec // срабатывания фильтров: altered, flagged, rejected
+	queueDrops     atomic.Uint64
+	upgradeFails   atomic.Uint64
+	broadcastTimes *histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		messages:     counterVec{m: make(map[string]uint64)},
+		rateLimited:  counterVec{m: make(map[string]uint64)},
+		chatRejected: counterVec{m: make(map[string]uint64)},
+		chatFiltered: counterVec{m: make(map[string]uint64)},
+		// От 50 мкс до ~100 мс
+		broadcastTimes: newHistogram(0.00005, 2, 12),
+	}
+}
+
+// Известные типы сообщений; остальные считаются как "unknown",
+// чтобы клиент не мог раздуть число серий
+var knownMessageTypes = map[string]bool{
+	protocol.TypeChat:        true,
+	protocol.TypePlay:        true,
+	protocol.TypePause:       true,
+	protocol.TypeSeek:        true,
+	protocol.TypeStateUpdate: true,
+	protocol.TypeJoin:        true,
+	protocol.TypeLeave:       true,
+}
+
+func (m *metrics) countMessage(msgType string) {
+	if !knownMessageTypes[msgType] {
+		msgType = "unknown"
+	}
+	m.messages.inc(msgType)
+}
+
+type counterVec struct {
+	mu sync.Mutex
+	m  map[string]uint64
+}
+
+func (c *counterVec) inc(label string) {
+	c.mu.Lock()
+	c.m[label]++
+	c.mu.Unlock()
+}
+
+// Серии счётчика по порядку меток, чтобы вывод не прыгал между запросами
+func (c *counterVec) write(w io.Writer, name, label string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.m))
+	for k := range c.m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, k, c.m[k])
+	}
+}
+
+type histogram struct {
+	bounds []float64
+	mu     sync.Mutex
+	counts []uint64 // последний элемент — +Inf
+	sum    float64
+	count  uint64
+}
+
+// Экспоненциальные границы: start, start*factor, ...
+func newHistogram(start, factor float64, n int) *histogram {
+	bounds := make([]float64, n)
+	for i := range bounds {
+		bounds[i] = start * math.Pow(factor, float64(i))
+	}
+	return &histogram{bounds: bounds, counts: make([]uint64, n+1)}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	v := d.Seconds()
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+func (h *histogram) write(w io.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var cum uint64
+	for i, b := range h.bounds {
+		cum += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(b, 'g', -1, 64), cum)
+	}
+	cum += h.counts[len(h.bounds)]
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, cum)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+// Ответ health/ready
+type HealthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Liveness: процесс жив и обслуживает HTTP
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthStatus{Status: "ok"})
+}
+
+// Readiness: хранилище доступно и сервер не останавливается
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{"store": "ok", "draining": "no"}
+	ready := true
+
+	if err := s.store.Ping(); err != nil {
+		checks["store"] = err.Error()
+		ready = false
+	}
+	if s.draining.Load() {
+		checks["draining"] = "yes"
+		ready = false
+	}
+
+	if !ready {
+		writeJSON(w, http.StatusServiceUnavailable, HealthStatus{Status: "unavailable", Checks: checks})
+		return
+	}
+	writeJSON(w, http.StatusOK, HealthStatus{Status: "ready", Checks: checks})
+}
+
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	roomCount := len(s.rooms)
+	clientCount := 0
+	for _, room := range s.rooms {
+		room.mu.RLock()
+		clientCount += len(room.clients)
+		room.mu.RUnlock()
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	fmt.Fprintln(w, "# HELP videoparty_rooms_active Rooms currently open.")
+	fmt.Fprintln(w, "# TYPE videoparty_rooms_active gauge")
+	fmt.Fprintf(w, "videoparty_rooms_active %d\n", roomCount)
+
+	fmt.Fprintln(w, "# HELP videoparty_clients_connected WebSocket clients currently connected.")
+	fmt.Fprintln(w, "# TYPE videoparty_clients_connected gauge")
+	fmt.Fprintf(w, "videoparty_clients_connected %d\n", clientCount)
+
+	fmt.Fprintln(w, "# HELP videoparty_messages_total WebSocket messages received, by type.")
+	fmt.Fprintln(w, "# TYPE videoparty_messages_total counter")
+	s.metrics.messages.write(w, "videoparty_messages_total", "type")
+
+	fmt.Fprintln(w, "# HELP videoparty_rate_limited_total Requests and messages rejected by rate limits, by scope.")
+	fmt.Fprintln(w, "# TYPE videoparty_rate_limited_total counter")
+	s.metrics.rateLimited.write(w, "videoparty_rate_limited_total", "scope")
+
+	fmt.Fprintln(w, "# HELP videoparty_chat_rejected_total Chat messages rejected by room chat policy, by reason.")
+	fmt.Fprintln(w, "# TYPE videoparty_chat_rejected_total counter")
+	s.metrics.chatRejected.write(w, "videoparty_chat_rejected_total", "reason")
+
+	fmt.Fprintln(w, "# HELP videoparty_chat_filtered_total Chat messages changed, flagged or rejected by content filters, by outcome.")
+	fmt.Fprintln(w, "# TYPE videoparty_chat_filtered_total counter")
+	s.metrics.chatFiltered.write(w, "videoparty_chat_filtered_total", "outcome")
+
+	fmt.Fprintln(w, "# HELP videoparty_send_queue_drops_total Clients dropped because their send queue was full.")
+	fmt.Fprintln(w, "# TYPE videoparty_send_queue_drops_total counter")
+	fmt.Fprintf(w, "videoparty_send_queue_drops_total %d\n", s.metrics.queueDrops.Load())
+
+	fmt.Fprintln(w, "# HELP videoparty_broadcast_duration_seconds Time to fan a message out to a room.")
+	fmt.Fprintln(w, "# TYPE videoparty_broadcast_duration_seconds histogram")
+	s.metrics.broadcastTimes.write(w, "videoparty_broadcast_duration_seconds")
+
+	fmt.Fprintln(w, "# HELP videoparty_ws_upgrade_failures_total Failed WebSocket upgrades.")
+	fmt.Fprintln(w, "# TYPE videoparty_ws_upgrade_failures_total counter")
+	fmt.Fprintf(w, "videoparty_ws_upgrade_failures_total %d\n", s.metrics.upgradeFails.Load())
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenAPI-спецификация строится по таблице routes() и Go-типам,
+// поэтому схемы Room, Message и VideoState не расходятся с кодом.
+
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	s.openAPIOnce.Do(func() {
+		s.openAPISpec = buildOpenAPI(s.routes())
+		if s.prefix != "" {
+			s.openAPISpec["servers"] = []interface{}{
+				map[string]interface{}{"url": s.prefix},
+			}
+		}
+	})
+	writeJSON(w, http.StatusOK, s.openAPISpec)
+}
+
+// Параметр пути ServeMux: {roomID} или {path...}; у OpenAPI многоточия нет
+var pathParamRe = regexp.MustCompile(`\{([^}$.]+)(\.\.\.)?\}`)
+
+func buildOpenAPI(rts []route) map[string]interface{} {
+	sg := newSchemaGen()
+	// Типы протокола описываются даже если ни один маршрут их не возвращает
+	sg.schema(reflect.TypeOf(VideoState{}))
+	errRef := sg.schema(reflect.TypeOf(APIError{}))
+
+	paths := map[string]interface{}{}
+	for _, rt := range rts {
+		method, path, _ := strings.Cut(rt.Pattern, " ")
+		path = strings.TrimSuffix(path, "{$}")
+		pathParams := pathParamRe.FindAllStringSubmatch(path, -1)
+		path = pathParamRe.ReplaceAllString(path, "{$1}")
+
+		op := map[string]interface{}{
+			"summary":     rt.Summary,
+			"operationId": operationID(rt.Handler),
+		}
+
+		var params []interface{}
+		for _, m := range pathParams {
+			param := map[string]interface{}{
+				"name": m[1], "in": "path", "required": true,
+				"schema": map[string]interface{}{"type": "string"},
+			}
+			if m[2] != "" {
+				param["description"] = "rest of the path, may contain slashes"
+			}
+			params = append(params, param)
+		}
+		if rt.Query != nil {
+			t := reflect.TypeOf(rt.Query)
+			for i := 0; i < t.NumField(); i++ {
+				f := t.Field(i)
+				if name := f.Tag.Get("query"); name != "" {
+					params = append(params, map[string]interface{}{
+						"name": name, "in": "query", "required": f.Tag.Get("required") == "true",
+						"schema": map[string]interface{}{"type": "string"},
+					})
+				}
+			}
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if rt.Form != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/x-www-form-urlencoded": map[string]interface{}{
+						"schema": formSchema(reflect.TypeOf(rt.Form)),
+					},
+				},
+			}
+		}
+
+		if rt.Request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": sg.schema(reflect.TypeOf(rt.Request)),
+					},
+				},
+			}
+		}
+
+		status := rt.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		ok := map[string]interface{}{"description": http.StatusText(status)}
+		switch {
+		case rt.Response != nil:
+			ok["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": sg.schema(reflect.TypeOf(rt.Response)),
+				},
+			}
+		case rt.Produces != "":
+			typ := "string"
+			if rt.Produces == "application/json" {
+				typ = "object"
+			}
+			ok["content"] = map[string]interface{}{
+				rt.Produces: map[string]interface{}{
+					"schema": map[string]interface{}{"type": typ},
+				},
+			}
+		}
+		responses := map[string]interface{}{strconv.Itoa(status): ok}
+		codes := append([]int(nil), rt.Errors...)
+		if rt.MaxBody > 0 {
+			codes = append(codes, http.StatusRequestEntityTooLarge)
+		}
+		for _, code := range codes {
+			resp := map[string]interface{}{"description": http.StatusText(code)}
+			if strings.HasPrefix(path, "/api/") {
+				resp["content"] = map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": errRef},
+				}
+			}
+			responses[strconv.Itoa(code)] = resp
+		}
+		op["responses"] = responses
+
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "VideoParty API",
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": sg.defs},
+	}
+}
+
+// Имя обработчика без пакета:
+// "main.go/server.(*Server).apiGetRoomHandler-fm" -> "apiGetRoom"
+func operationID(h http.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, "Handler")
+}
+
+func formSchema(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("form")
+		if name == "" {
+			continue
+		}
+		props[name] = map[string]interface{}{"type": "string"}
+		if f.Tag.Get("required") == "true" {
+			required = append(required, name)
+		}
+	}
+	s := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// Генератор JSON-схем по reflect-типам; именованные структуры
+// попадают в components/schemas и подставляются через $ref.
+type schemaGen struct {
+	defs  map[string]interface{}
+	names map[reflect.Type]string
+}
+
+func newSchemaGen() *schemaGen {
+	return &schemaGen{defs: map[string]interface{}{}, names: map[reflect.Type]string{}}
+}
+
+// Имя схемы; одноимённые типы разных пакетов (server.Room и store.Room)
+// различаются префиксом пакета: StoreRoom
+func (g *schemaGen) name(t reflect.Type) string {
+	if n, ok := g.names[t]; ok {
+		return n
+	}
+	n := t.Name()
+	if _, taken := g.defs[n]; taken {
+		pkg := path.Base(t.PkgPath())
+		n = strings.ToUpper(pkg[:1]) + pkg[1:] + n
+	}
+	g.names[t] = n
+	return n
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGen) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		name := g.name(t)
+		if _, ok := g.defs[name]; !ok {
+			g.defs[name] = nil // защита от рекурсии
+			g.defs[name] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return g.structSchema(t)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	}
+	// interface{} и прочее — произвольное значение
+	return map[string]interface{}{}
+}
+
+func (g *schemaGen) structSchema(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	s := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+)
+
+// Владельца комнаты подтверждает секрет, который сервер выдаёт при её
+// создании: браузеру — в HttpOnly-cookie, клиентам API — в заголовке
+// X-Owner-Token ответа. Имя из ?username= может взять кто угодно,
+// поэтому правами оно не наделяет. В записи комнаты хранится только
+// SHA-256 секрета.
+
+const (
+	ownerCookiePrefix = "vp_owner_" // + ID комнаты
+	ownerTokenHeader  = "X-Owner-Token"
+	ownerCookieMaxAge = 365 * 24 * 60 * 60
+)
+
+// Новый секрет владельца и хеш для записи комнаты; нужен и CLI
+func NewOwnerToken() (token, key string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, ownerKey(token)
+}
+
+func ownerKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Отдаёт секрет создателю комнаты
+func (s *Server) giveOwnerToken(w http.ResponseWriter, r *http.Request, roomID, token string) {
+	w.Header().Set(ownerTokenHeader, token)
+	s.setCookie(w, r, &http.Cookie{
+		Name:     ownerCookiePrefix + roomID,
+		Value:    token,
+		MaxAge:   ownerCookieMaxAge,
+		HttpOnly: true,
+	})
+}
+
+// Предъявил ли запрос секрет владельца: в заголовке или в cookie.
+// У комнат, созданных до появления секрета, владельца нет.
+func (s *Server) isOwner(r *http.Request, room *Room) bool {
+	if room.ownerKey == "" {
+		return false
+	}
+	token := r.Header.Get(ownerTokenHeader)
+	if token == "" {
+		if c, err := r.Cookie(ownerCookiePrefix + room.ID); err == nil {
+			token = c.Value
+		}
+	}
+	if token == "" || len(token) > 64 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(ownerKey(token)), []byte(room.ownerKey)) == 1
+}
+
+// Менять настройки комнаты может только владелец
+func (s *Server) requireOwner(w http.ResponseWriter, r *http.Request, room *Room) bool {
+	if s.isOwner(r, room) {
+		return true
+	}
+	writeError(w, http.StatusForbidden, "only the room owner can do this")
+	return false
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"main.go/store"
+)
+
+// Главная страница
+func (s *Server) homeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var q homeQuery
+	decodeValues(r.URL.Query(), "query", &q)
+
+	page := &homePage{
+		Error:     q.Error,
+		CSRFToken: s.csrfToken(w, r),
+	}
+	// Медиатеку показываем только тем, кому её можно смотреть
+	if s.library != nil && (s.auth == nil || s.auth(r, ActionListMedia, "") == nil) {
+		page.Media = s.library.Items()
+	}
+	page.Proxy = s.proxy != nil
+	if s.uploads != nil && (s.auth == nil || s.auth(r, ActionUpload, "") == nil) {
+		page.UploadMax = s.uploads.limits.MaxSize
+	}
+	s.render(w, r, "index", page)
+}
+
+// Создание комнаты
+func (s *Server) createRoomHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), bodyStatus(err))
+		return
+	}
+	var form createRoomForm
+	decodeValues(r.PostForm, "form", &form)
+	videoURL := strings.TrimSpace(form.VideoURL)
+	roomName := form.RoomName
+	username := form.Username
+
+	if !s.authorize(w, r, ActionCreateRoom, "") {
+		return
+	}
+	if !s.allowCreate(w, r) {
+		return
+	}
+	if !s.validCSRF(r, form.CSRFToken) {
+		s.logger.WarnContext(r.Context(), "invalid CSRF token on create-room")
+		http.Redirect(w, r, s.path("/?error=Form+expired,+please+try+again"), http.StatusSeeOther)
+		return
+	}
+	if (videoURL == "" && form.MediaID == "") || username == "" {
+		http.Redirect(w, r, s.path("/?error=Video+URL+or+library+file+and+username+are+required"), http.StatusSeeOther)
+		return
+	}
+
+	var sources []VideoSource
+	for _, line := range strings.Split(form.Sources, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			sources = append(sources, VideoSource{URL: line})
+		}
+	}
+
+	token, key := NewOwnerToken()
+	room, err := s.createRoom(r.Context(), store.Room{
+		VideoURL: videoURL,
+		MediaID:  form.MediaID,
+		Name:     roomName,
+		Owner:    username,
+		OwnerKey: key,
+		Sources:  sources,
+		Poster:   strings.TrimSpace(form.Poster),
+		Proxy:    form.Proxy != "",
+	})
+	if errors.Is(err, ErrShuttingDown) {
+		http.Redirect(w, r, s.path("/?error=Server+is+restarting,+try+again+in+a+moment"), http.StatusSeeOther)
+		return
+	}
+	var mediaErr *MediaError
+	if errors.As(err, &mediaErr) {
+		http.Redirect(w, r, s.path("/?error="+url.QueryEscape(mediaErr.Error())), http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, s.path("/?error=Could+not+save+room"), http.StatusSeeOther)
+		return
+	}
+	s.giveOwnerToken(w, r, room.ID, token)
+	http.Redirect(w, r, s.path("/room/"+room.ID+"?username="+url.QueryEscape(username)), http.StatusSeeOther)
+}
+
+// Страница комнаты
+func (s *Server) roomHandler(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomID")
+
+	room, exists := s.room(roomID)
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorize(w, r, ActionViewRoom, roomID) {
+		return
+	}
+
+	var q roomQuery
+	decodeValues(r.URL.Query(), "query", &q)
+	username := q.Username
+	if username == "" {
+		username = "Guest_" + NewRoomID()[:4]
+	}
+
+	// Список пользователей
+	room.mu.RLock()
+	userCount := len(room.clients)
+	room.mu.RUnlock()
+
+	video := s.roomVideo(r, room)
+	var subs *Subtitles
+	if video.Kind == "video" || video.Kind == "stream" {
+		video.Subtitles = s.subtitles(room)
+		subs = &video.Subtitles
+	}
+	if video.Kind == "stream" {
+		var origins []string
+		if u, err := url.Parse(video.EmbedURL); err == nil {
+			origins = originOf(u)
+		}
+		if video.Stream != nil {
+			origins = mergeOrigins(origins, video.Stream.Origins)
+		}
+		addConnectSources(w, origins...)
+	}
+	s.render(w, r, "room", &roomPage{
+		Room:      room,
+		UserCount: userCount,
+		InviteURL: s.absURL(r, "/room/"+roomID),
+		Video:     video,
+		Data: roomData{
+			RoomID:    roomID,
+			Username:  username,
+			VideoURL:  video.URL,
+			OwnerName: room.Owner,
+			IsOwner:   s.isOwner(r, room),
+			BasePath:  s.prefix,
+			Video: videoData{
+				Provider: video.Provider,
+				Kind:     video.Kind,
+				URL:      video.EmbedURL,
+				Player:   video.Player,
+				Caps:     video.Caps,
+			},
+			Subtitles: subs,
+		},
+	})
+}
+
+// Список комнат
+func (s *Server) listRoomsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, ActionListRooms, "") {
+		return
+	}
+
+	var page roomsPage
+	s.mu.RLock()
+	for _, room := range s.rooms {
+		room.mu.RLock()
+		page.Rooms = append(page.Rooms, roomListItem{Room: room, Users: len(room.clients)})
+		room.mu.RUnlock()
+	}
+	s.mu.RUnlock()
+	sort.Slice(page.Rooms, func(i, j int) bool {
+		return page.Rooms[i].CreatedAt.Before(page.Rooms[j].CreatedAt)
+	})
+
+	s.render(w, r, "rooms", &page)
+}
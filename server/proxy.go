@@ -0,0 +1,323 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"main.go/store"
+)
+
+// Прокси прямых ссылок на видео: файл идёт браузеру с нашего origin.
+// Нужен для хостов без CORS (дорожки субтитров, разбор в браузере) и
+// для тех, что не дают встраивать файл на чужие страницы. Проксируются
+// только ссылки комнат, созданных с флагом proxy, — это не открытый прокси.
+
+// Настройки прокси
+type MediaProxy struct {
+	Hosts     []string // какие хосты можно проксировать: "cdn.example.com" или поддомены "*.example.com"; пусто — любые
+	Bandwidth int64    // байт в секунду на комнату (на всех её зрителей); 0 — без ограничения
+}
+
+// Включает прокси; nil — выключен
+func WithMediaProxy(p *MediaProxy) Option {
+	return func(s *Server) {
+		if p == nil {
+			s.proxy = nil
+			return
+		}
+		s.proxy = &mediaProxy{MediaProxy: *p}
+	}
+}
+
+type mediaProxy struct {
+	MediaProxy
+	client  *http.Client
+	limiter *limiter // байты по комнатам
+}
+
+// Соединение с внутренним адресом; ссылка или её редирект ведёт в
+// локальную сеть
+var errPrivateAddress = errors.New("video host resolves to a private address")
+
+// Диапазоны, которые не видны из интернета, кроме тех, что проверяют
+// методы netip.Addr
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // «этот» сетевой сегмент
+	netip.MustParsePrefix("100.64.0.0/10"),   // CGNAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // служебные IETF
+	netip.MustParsePrefix("198.18.0.0/15"),   // стенды для замеров
+	netip.MustParsePrefix("240.0.0.0/4"),     // зарезервированные и broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64: за ним может быть любой IPv4
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // локальный NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // документация
+	netip.MustParsePrefix("2002::/16"),       // 6to4 со встроенным IPv4
+	netip.MustParsePrefix("2001::/32"),       // Teredo со встроенным IPv4
+	netip.MustParsePrefix("100::/64"),        // discard
+	netip.MustParsePrefix("fec0::/10"),       // устаревшие site-local
+	netip.MustParsePrefix("192.88.99.0/24"),  // 6to4 relay
+	netip.MustParsePrefix("192.0.2.0/24"),    // документация
+	netip.MustParsePrefix("198.51.100.0/24"), // документация
+	netip.MustParsePrefix("203.0.113.0/24"),  // документация
+}
+
+// Адрес из интернета, а не из локальной или служебной сети
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, p := range reservedPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Проверка уже разрешённого адреса перед соединением: так не обойти
+// защиту ни DNS-записью на 127.0.0.1, ни редиректом, ни сменой записи
+// между проверкой и запросом
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !publicAddr(ip) {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// Ссылка http или https с именем хоста
+func webURL(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Hostname() != ""
+}
+
+// Можно ли проксировать ссылку
+func (p *mediaProxy) allowed(u *url.URL) bool {
+	if !webURL(u) {
+		return false
+	}
+	// Хост сравнивается точно: скелет из filter.go свёл бы «cdn-1.example.com»
+	// к «cdni.example.com» и пропустил чужой домен
+	return len(p.Hosts) == 0 || matchHostExact(p.Hosts, asciiHost(u.Hostname()))
+}
+
+// Клиент для ссылок, которые прислали пользователи: соединяется только
+// с публичными адресами, а каждый редирект проверяет allowed
+func publicClient(allowed func(*url.URL) bool, maxRedirects int) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second, Control: publicOnly}
+	return &http.Client{
+		Transport: &http.Transport{
+			// Переменные HTTP_PROXY не учитываем: проверять надо адрес хоста видео
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 15 * time.Second,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConnsPerHost:   8,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if !allowed(req.URL) {
+				return fmt.Errorf("redirect to %s is not allowed", req.URL.Host)
+			}
+			return nil
+		},
+	}
+}
+
+// Клиент для WithMediaProbe с той же защитой от запросов во внутреннюю
+// сеть, что у прокси
+func PublicHTTPClient(timeout time.Duration) *http.Client {
+	c := publicClient(webURL, 3)
+	c.Timeout = timeout
+	return c
+}
+
+func (p *mediaProxy) prepare() {
+	p.client = publicClient(p.allowed, 5)
+	bw := RateLimit{Rate: float64(p.Bandwidth), Burst: int(p.Bandwidth)}
+	p.limiter = newLimiter(func(string) RateLimit { return bw })
+}
+
+// Можно ли комнате с такой ссылкой играть через прокси
+func (s *Server) checkProxy(rec *store.Room) error {
+	if s.proxy == nil {
+		return &MediaError{Reason: "this server does not proxy videos"}
+	}
+	links := []string{rec.VideoURL}
+	for _, src := range rec.Sources {
+		links = append(links, src.URL)
+	}
+	for _, link := range links {
+		u, err := url.Parse(link)
+		if err != nil || !s.proxy.allowed(u) {
+			return &MediaError{URL: link, Reason: "videos from this host can't be played through the server"}
+		}
+	}
+	return nil
+}
+
+// Адрес файла комнаты через прокси; source — номер альтернативного источника с 1
+func (s *Server) proxyPath(roomID string, source int) string {
+	p := s.path("/proxy/" + url.PathEscape(roomID))
+	if source > 0 {
+		p += "?source=" + strconv.Itoa(source)
+	}
+	return p
+}
+
+// Заголовки запроса, которые передаются хосту видео: перемотка и кэш браузера
+var proxyRequestHeaders = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"}
+
+// Заголовки ответа, которые возвращаются браузеру
+var proxyResponseHeaders = []string{"Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified"}
+
+type proxyQuery struct {
+	Source string `query:"source"` // альтернативный источник с 1; пусто — основной файл
+}
+
+// Файл комнаты через сервер
+func (s *Server) proxyHandler(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomID")
+	if !s.authorize(w, r, ActionViewRoom, roomID) {
+		return
+	}
+	room, ok := s.room(roomID)
+	if !ok || !room.Proxy || s.proxy == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var q proxyQuery
+	decodeValues(r.URL.Query(), "query", &q)
+	link, typ := room.VideoURL, room.VideoType
+	if q.Source != "" {
+		n, err := strconv.Atoi(q.Source)
+		if err != nil || n < 1 || n > len(room.Sources) {
+			http.NotFound(w, r)
+			return
+		}
+		link, typ = room.Sources[n-1].URL, room.Sources[n-1].Type
+	}
+	u, err := url.Parse(link)
+	if err != nil || !s.proxy.allowed(u) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	method := http.MethodGet
+	if r.Method == http.MethodHead {
+		method = http.MethodHead
+	}
+	req, err := http.NewRequestWithContext(r.Context(), method, link, nil)
+	if err != nil {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	for _, h := range proxyRequestHeaders {
+		if v := r.Header.Get(h); v != "" {
+			req.Header.Set(h, v)
+		}
+	}
+	req.Header.Set("User-Agent", "VideoParty")
+	// Сжатие сломало бы Range и Content-Length
+	req.Header.Set("Accept-Encoding", "identity")
+
+	resp, err := s.proxy.client.Do(req)
+	if err != nil {
+		if r.Context().Err() == nil {
+			s.logger.WarnContext(r.Context(), "proxying video failed", "room_id", roomID, "url", link, "err", err)
+		}
+		if errors.Is(err, errPrivateAddress) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		// Отдаём с нашего origin только видео: HTML со ссылки стал бы нашей страницей
+		ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		switch {
+		case strings.HasPrefix(ct, "video/") || strings.HasPrefix(ct, "audio/"):
+		case ct == "" || ct == "application/octet-stream" || ct == "binary/octet-stream":
+			ct = typ
+		default:
+			s.logger.WarnContext(r.Context(), "proxied link is not a video", "room_id", roomID, "url", link, "type", ct)
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			return
+		}
+		if ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+	case http.StatusNotModified, http.StatusRequestedRangeNotSatisfiable, http.StatusNotFound:
+	default:
+		s.logger.WarnContext(r.Context(), "proxied video host returned an error", "room_id", roomID, "url", link, "status", resp.StatusCode)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+
+	for _, h := range proxyResponseHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	// Фильм отдаётся дольше, чем WriteTimeout сервера
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.WriteHeader(resp.StatusCode)
+	if method == http.MethodHead || resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return
+	}
+	s.proxyCopy(r.Context(), w, resp.Body, roomID)
+}
+
+// Копирование тела с ограничением скорости комнаты
+func (s *Server) proxyCopy(ctx context.Context, w io.Writer, body io.Reader, roomID string) {
+	buf := make([]byte, 32<<10)
+	if s.proxy.Bandwidth > 0 && int64(len(buf)) > s.proxy.Bandwidth {
+		buf = buf[:s.proxy.Bandwidth]
+	}
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if wait := s.proxy.limiter.reserve(roomID, n); wait > 0 {
+				t := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					t.Stop()
+					return
+				case <-t.C:
+				}
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
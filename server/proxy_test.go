@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestMediaProxyAllowed(t *testing.T) {
+	p := &mediaProxy{MediaProxy: MediaProxy{Hosts: []string{"cdn.example.com", "*.media.example.org"}}}
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://cdn.example.com/v.mp4", true},
+		{"http://CDN.Example.COM./v.mp4", true},
+		{"https://cdn.example.com:8443/v.mp4", true},
+		{"https://a.cdn.example.com/v.mp4", false},
+		{"https://cdn-example.com/v.mp4", false},
+		{"https://cdnexample.com/v.mp4", false},
+		{"https://cdn.examp1e.com/v.mp4", false},
+		{"https://cdn.ехample.com/v.mp4", false}, // кириллические «е» и «х»
+		{"https://eu.media.example.org/v.mp4", true},
+		{"https://media.example.org/v.mp4", false},
+		{"https://eu.media-example.org/v.mp4", false},
+		{"ftp://cdn.example.com/v.mp4", false},
+		{"https:///v.mp4", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.allowed(u); got != tt.allowed {
+			t.Errorf("allowed(%q) = %v, want %v", tt.url, got, tt.allowed)
+		}
+	}
+}
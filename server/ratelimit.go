@@ -0,0 +1,225 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"main.go/protocol"
+)
+
+// Бюджет токен-бакета: до Burst событий сразу, дальше Rate в секунду.
+// Rate <= 0 — без ограничения.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Ограничения частоты
+type RateLimits struct {
+	CreateRoom RateLimit            // создание и импорт комнат, на IP
+	Client     map[string]RateLimit // сообщения одного клиента, по типу
+	Room       map[string]RateLimit // сообщения всей комнаты, по типу
+
+	// Сколько отказов в минуту клиент может получить, прежде чем его
+	// отключат; 0 — не отключать
+	MaxViolations int
+}
+
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		CreateRoom: RateLimit{Rate: 10.0 / 60, Burst: 10},
+		Client: map[string]RateLimit{
+			protocol.TypeChat:        {Rate: 1, Burst: 5},
+			protocol.TypePlay:        {Rate: 1, Burst: 5},
+			protocol.TypePause:       {Rate: 1, Burst: 5},
+			protocol.TypeSeek:        {Rate: 2, Burst: 10},
+			protocol.TypeStateUpdate: {Rate: 2, Burst: 10},
+			protocol.TypeJoin:        {Rate: 5.0 / 60, Burst: 5},
+		},
+		Room: map[string]RateLimit{
+			protocol.TypeChat:        {Rate: 6, Burst: 30},
+			protocol.TypePlay:        {Rate: 2, Burst: 10},
+			protocol.TypePause:       {Rate: 2, Burst: 10},
+			protocol.TypeSeek:        {Rate: 4, Burst: 20},
+			protocol.TypeStateUpdate: {Rate: 4, Burst: 20},
+			protocol.TypeJoin:        {Rate: 1, Burst: 60},
+		},
+		MaxViolations: 20,
+	}
+}
+
+func WithRateLimits(l RateLimits) Option {
+	return func(s *Server) { s.rates = l }
+}
+
+// Токен-бакет; без собственной блокировки
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(l RateLimit) *tokenBucket {
+	return &tokenBucket{limit: l, tokens: float64(l.Burst), last: time.Now()}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+}
+
+// Берёт токен; при отказе возвращает, через сколько он появится
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+// Берёт n токенов, уходя в минус; возвращает, через сколько долг погасится
+func (b *tokenBucket) reserve(now time.Time, n float64) time.Duration {
+	b.refill(now)
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.limit.Rate * float64(time.Second))
+}
+
+// Набор бакетов по ключу (IP или тип сообщения)
+type limiter struct {
+	mu        sync.Mutex
+	limits    func(key string) RateLimit
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newLimiter(limits func(key string) RateLimit) *limiter {
+	return &limiter{limits: limits, buckets: make(map[string]*tokenBucket), lastSweep: time.Now()}
+}
+
+func (l *limiter) allow(key string) (bool, time.Duration) {
+	limit := l.limits(key)
+	if !limit.enabled() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	return l.bucket(key, limit, now).take(now)
+}
+
+// Берёт n токенов в долг (байты прокси); возвращает, сколько подождать,
+// прежде чем тратить их
+func (l *limiter) reserve(key string, n int) time.Duration {
+	limit := l.limits(key)
+	if !limit.enabled() {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	return l.bucket(key, limit, now).reserve(now, float64(n))
+}
+
+// Бакет ключа; под l.mu
+func (l *limiter) bucket(key string, limit RateLimit, now time.Time) *tokenBucket {
+	// Полные бакеты ничем не отличаются от новых — выбрасываем их,
+	// чтобы карта адресов не росла бесконечно
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			if b.refill(now); b.tokens >= float64(b.limit.Burst) {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newBucket(limit)
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// Ограничение создания комнат по адресу; при отказе ответ уже отправлен
+func (s *Server) allowCreate(w http.ResponseWriter, r *http.Request) bool {
+	ok, wait := s.createLimiter.allow(s.clientIP(r))
+	if ok {
+		return true
+	}
+	s.metrics.rateLimited.inc("http")
+	s.logger.WarnContext(r.Context(), "rate limited", "ip", s.clientIP(r), "path", r.URL.Path)
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeError(w, http.StatusTooManyRequests, "rate limited, try again later")
+	} else {
+		http.Error(w, "Too many requests, try again later", http.StatusTooManyRequests)
+	}
+	return false
+}
+
+// Проверка сообщения клиента по его бюджету и бюджету комнаты.
+// На отказ клиент получает rate_limited; слишком частые отказы
+// заканчиваются отключением.
+func (c *Client) allow(msgType string) bool {
+	ok, wait := c.limiter.allow(msgType)
+	scope := "client"
+	if ok {
+		ok, wait = c.room.limiter.allow(msgType)
+		scope = "room"
+	}
+	if ok {
+		return true
+	}
+	c.srv.metrics.rateLimited.inc(scope)
+
+	if c.violations != nil {
+		if allowed, _ := c.violations.take(time.Now()); !allowed {
+			// readPump выйдет, а writePump допишет очередь и закроет соединение
+			c.log.Warn("disconnecting client for flooding", "msg_type", msgType)
+			c.closeMsg = websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded")
+			c.kicked = true
+			return false
+		}
+	}
+
+	c.log.Debug("rate limited", "msg_type", msgType, "scope", scope)
+	data, _ := json.Marshal(Message{
+		Type: protocol.TypeRateLimited,
+		Data: protocol.RateLimited{MessageType: msgType, RetryAfterMs: wait.Milliseconds()},
+		Time: time.Now().Unix(),
+	})
+	c.trySend(data)
+	return false
+}
+
+// Отправка одному клиенту, если он ещё в комнате и очередь не полна
+func (c *Client) trySend(data []byte) {
+	c.room.mu.RLock()
+	defer c.room.mu.RUnlock()
+	if c.room.clients[c] {
+		select {
+		case c.send <- data:
+		default:
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"main.go/templates"
+)
+
+// Данные страниц. Всё выводится через html/template, который сам
+// экранирует значения по контексту: HTML, атрибут, URL или JavaScript.
+type page interface {
+	base() *pageBase
+}
+
+// Общие поля всех страниц
+type pageBase struct {
+	Nonce string // nonce CSP для тегов <script>
+}
+
+func (p *pageBase) base() *pageBase { return p }
+
+type homePage struct {
+	pageBase
+	Error     string
+	CSRFToken string
+	Media     []MediaItem // файлы медиатеки; пусто — её нет
+	UploadMax int64       // самый большой загружаемый файл; 0 — загрузок нет
+	Proxy     bool        // можно играть прямые ссылки через сервер
+}
+
+type roomPage struct {
+	pageBase
+	Room      *Room
+	UserCount int
+	InviteURL string
+	Video     VideoEmbed
+	Data      roomData // для room.js
+}
+
+type roomData struct {
+	RoomID    string `json:"roomId"`
+	Username  string `json:"username"`
+	VideoURL  string `json:"videoUrl"` // исходная ссылка или адрес файла медиатеки
+	OwnerName string `json:"ownerName"`
+	IsOwner   bool   `json:"isOwner"` // предъявлен секрет владельца
+	BasePath  string `json:"basePath"`
+
+	Video     videoData  `json:"video"`
+	Subtitles *Subtitles `json:"subtitles,omitempty"` // nil — плеер без <track>
+}
+
+// Что room.js нужно знать о плеере
+type videoData struct {
+	Provider string    `json:"provider,omitempty"` // пусто — ссылка без плеера
+	Kind     string    `json:"kind"`               // iframe, video или link
+	URL      string    `json:"url,omitempty"`      // адрес iframe или файла
+	Player   string    `json:"player,omitempty"`   // адаптер из players.js
+	Caps     VideoCaps `json:"caps"`
+}
+
+type roomsPage struct {
+	pageBase
+	Rooms []roomListItem
+}
+
+type roomListItem struct {
+	*Room
+	Users int
+}
+
+// Каждая страница разбирается вместе с макетом base.html отдельно,
+// потому что все они определяют одни и те же блоки
+func (s *Server) parsePages() error {
+	funcs := template.FuncMap{
+		// Путь с учётом префикса монтирования
+		"path": s.path,
+		// Адрес файла из static с хешем содержимого
+		"asset": s.assetURL,
+		// Размер файла и длительность для людей
+		"filesize": formatSize,
+		"clock":    formatClock,
+		"join":     strings.Join,
+	}
+	s.pages = make(map[string]*template.Template)
+	for _, name := range []string{"index", "room", "rooms"} {
+		t, err := template.New(name).Funcs(funcs).ParseFS(templates.FS, "base.html", name+".html")
+		if err != nil {
+			return err
+		}
+		s.pages[name] = t
+	}
+	return nil
+}
+
+// Страница рендерится в буфер, чтобы при ошибке не отдать половину HTML
+func (s *Server) render(w http.ResponseWriter, r *http.Request, name string, data page) {
+	data.base().Nonce = CSPNonce(r.Context())
+
+	var buf bytes.Buffer
+	if err := s.pages[name].ExecuteTemplate(&buf, "base", data); err != nil {
+		s.logger.ErrorContext(r.Context(), "rendering page failed", "page", name, "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// 1536 -> "1.5 KB"
+func formatSize(n int64) string {
+	const units = "KMGT"
+	if n < 1024 {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	f := float64(n)
+	i := -1
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	return strconv.FormatFloat(f, 'f', 1, 64) + " " + string(units[i]) + "B"
+}
+
+// 3725.4 -> "1:02:05"
+func formatClock(seconds float64) string {
+	t := int64(seconds)
+	h, m, sec := t/3600, t/60%60, t%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, sec)
+	}
+	return fmt.Sprintf("%d:%02d", m, sec)
+}
@@ -0,0 +1,365 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"main.go/protocol"
+	"main.go/store"
+)
+
+// Структуры
+type Room struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	VideoURL  string    `json:"videoUrl"`
+	MediaID   string    `json:"mediaId,omitempty"`
+	Owner     string    `json:"owner"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	VideoType string        `json:"videoType,omitempty"`
+	Sources   []VideoSource `json:"sources,omitempty"`
+	Poster    string        `json:"poster,omitempty"`
+	Proxy     bool          `json:"proxy,omitempty"`
+	Stream    *StreamInfo   `json:"stream,omitempty"`
+	File      *FileInfo     `json:"file,omitempty"`
+
+	ownerKey string // SHA-256 секрета владельца; пусто — владельца не подтвердить
+	live     bool   // прямой эфир: перемотки нет, все смотрят с края
+	clients  map[*Client]bool
+	mu       sync.RWMutex
+	limiter  *limiter // бюджеты сообщений всей комнаты
+
+	chat      *ChatPolicy         // правила чата из API; nil — по умолчанию
+	words     *WordList           // список слов из API; nil — только серверный
+	lastChat  map[string]lastChat // последнее сообщение по адресу клиента
+	chatSwept time.Time           // когда из lastChat последний раз убирали старое
+
+	subtitles  []store.Subtitle // дорожки в порядке загрузки; срез заменяется целиком
+	defaultSub string           // ID дорожки по умолчанию; пусто — выключены
+}
+
+type Client struct {
+	srv      *Server
+	log      *slog.Logger // с полями conn_id, room_id, user
+	conn     *websocket.Conn
+	room     *Room
+	username string
+	owner    bool // предъявил секрет владельца комнаты
+	ip       string
+	send     chan []byte
+
+	limiter    *limiter     // бюджеты сообщений клиента
+	violations *tokenBucket // отказы по бюджету; nil — не отключать
+	kicked     bool         // клиент отключается сервером; только в readPump
+	closeMsg   []byte       // кадр закрытия для writePump; пишется до close(send)
+}
+
+type (
+	Message    = protocol.Message
+	VideoState = protocol.VideoState
+)
+
+// WebSocket handler
+func (s *Server) websocketHandler(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomID")
+
+	var q roomQuery
+	decodeValues(r.URL.Query(), "query", &q)
+	username := q.Username
+	if username == "" {
+		username = "Guest_" + NewRoomID()[:4]
+	}
+
+	room, exists := s.room(roomID)
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorize(w, r, ActionJoinRoom, roomID) {
+		return
+	}
+	if s.draining.Load() {
+		s.rejectDraining(w)
+		return
+	}
+	ip := s.clientIP(r)
+	if status := s.acquireConn(ip); status != 0 {
+		s.logger.WarnContext(r.Context(), "websocket connection limit reached", "room_id", roomID, "ip", ip)
+		http.Error(w, "Too many connections", status)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.releaseConn(ip)
+		s.metrics.upgradeFails.Add(1)
+		s.logger.WarnContext(r.Context(), "websocket upgrade failed", "room_id", roomID, "user", username, "err", err)
+		return
+	}
+
+	client := &Client{
+		srv: s,
+		log: s.logger.With(
+			"request_id", RequestID(r.Context()),
+			"conn_id", newID(),
+			"room_id", roomID,
+			"user", username,
+		),
+		conn:     conn,
+		room:     room,
+		username: username,
+		owner:    s.isOwner(r, room),
+		ip:       ip,
+		send:     make(chan []byte, s.limits.SendQueue),
+		limiter:  newLimiter(func(t string) RateLimit { return s.rates.Client[t] }),
+	}
+	if n := s.rates.MaxViolations; n > 0 {
+		client.violations = newBucket(RateLimit{Rate: float64(n) / 60, Burst: n})
+	}
+
+	// Shutdown мог начаться, пока шёл апгрейд
+	s.mu.RLock()
+	if s.draining.Load() {
+		s.mu.RUnlock()
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseServiceRestart, ErrShuttingDown.Error()),
+			time.Now().Add(s.limits.WriteWait))
+		conn.Close()
+		s.releaseConn(ip)
+		return
+	}
+	s.pumps.Add(1)
+	s.mu.RUnlock()
+
+	room.mu.Lock()
+	room.clients[client] = true
+	room.mu.Unlock()
+
+	client.log.Info("user joined", "remote", r.RemoteAddr)
+
+	go client.writePump()
+	go client.readPump()
+
+	client.sendChatPolicy()
+	client.sendSubtitles()
+	// Отправляем список пользователей всем
+	client.broadcastUsers()
+}
+
+func (c *Client) readPump() {
+	defer c.disconnect()
+
+	limits := c.srv.limits
+	c.conn.SetReadLimit(limits.MaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(limits.PongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(limits.PongWait))
+		return nil
+	})
+
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				c.log.Warn("websocket read failed", "err", err)
+			}
+			break
+		}
+
+		var msg Message
+		if err := json.Unmarshal(message, &msg); err != nil {
+			c.log.Warn("invalid message", "err", err)
+			continue
+		}
+
+		c.handleMessage(msg)
+		if c.kicked {
+			break
+		}
+	}
+}
+
+func (c *Client) handleMessage(msg Message) {
+	c.srv.metrics.countMessage(msg.Type)
+	c.log.Debug("message received", "msg_type", msg.Type)
+
+	if !c.allow(msg.Type) {
+		return
+	}
+
+	switch msg.Type {
+	case protocol.TypeChat:
+		text, _ := msg.Data.(string)
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return
+		}
+		text, filtered, ok := c.filterChat(text)
+		if !ok || text == "" {
+			return
+		}
+		if reason, wait := c.checkChat(text); reason != "" {
+			c.rejectChat(reason, "", wait)
+			return
+		}
+		c.broadcastMessage(Message{
+			Type: protocol.TypeChat,
+			User: c.username,
+			Data: text,
+			Time: time.Now().Unix(),
+		})
+		c.reportFiltered(text, filtered)
+
+	case protocol.TypePlay:
+		c.broadcastMessage(Message{
+			Type: protocol.TypePlay,
+			User: c.username,
+			Time: time.Now().Unix(),
+		})
+
+	case protocol.TypePause:
+		c.broadcastMessage(Message{
+			Type: protocol.TypePause,
+			User: c.username,
+			Time: time.Now().Unix(),
+		})
+
+	case protocol.TypeSeek:
+		if c.room.live {
+			return
+		}
+		c.broadcastMessage(Message{
+			Type: protocol.TypeSeek,
+			User: c.username,
+			Data: msg.Data,
+			Time: time.Now().Unix(),
+		})
+
+	case protocol.TypeStateUpdate:
+		data := msg.Data
+		if c.room.live {
+			// Позиция в эфире у каждого своя; передаём только play/pause
+			var state VideoState
+			raw, _ := json.Marshal(msg.Data)
+			json.Unmarshal(raw, &state)
+			data = VideoState{Playing: state.Playing}
+		}
+		c.broadcastMessage(Message{
+			Type: protocol.TypeState,
+			Data: data,
+			Time: time.Now().Unix(),
+		})
+
+	case protocol.TypeJoin:
+		c.broadcastUsers()
+
+	case protocol.TypeLeave:
+		c.disconnect()
+	}
+}
+
+func (c *Client) broadcastMessage(msg Message) {
+	data, _ := json.Marshal(msg)
+
+	start := time.Now()
+	defer func() { c.srv.metrics.broadcastTimes.observe(time.Since(start)) }()
+
+	c.room.mu.RLock()
+	defer c.room.mu.RUnlock()
+
+	for client := range c.room.clients {
+		if client != c {
+			select {
+			case client.send <- data:
+			default:
+				c.srv.metrics.queueDrops.Add(1)
+				close(client.send)
+				delete(c.room.clients, client)
+			}
+		}
+	}
+}
+
+func (c *Client) broadcastUsers() {
+	users := c.getUsersList()
+	msg := Message{
+		Type: protocol.TypeUsers,
+		Data: users,
+		Time: time.Now().Unix(),
+	}
+	c.broadcastMessage(msg)
+	// И самому клиенту, иначе вошедший не видит списка до следующего входа.
+	// Ушедшего trySend пропустит: его уже нет в комнате
+	data, _ := json.Marshal(msg)
+	c.trySend(data)
+}
+
+func (c *Client) getUsersList() []string {
+	c.room.mu.RLock()
+	defer c.room.mu.RUnlock()
+
+	users := make([]string, 0, len(c.room.clients))
+	for client := range c.room.clients {
+		users = append(users, client.username)
+	}
+	return users
+}
+
+func (c *Client) writePump() {
+	limits := c.srv.limits
+	ticker := time.NewTicker(limits.pingPeriod())
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+		c.srv.releaseConn(c.ip)
+		c.srv.pumps.Done()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(limits.WriteWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, c.closeMsg)
+				return
+			}
+
+			// Каждое сообщение — отдельный кадр: room.js разбирает кадр
+			// одним JSON.parse, склеенные сообщения он бы потерял
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				c.log.Debug("websocket write failed", "err", err)
+				return
+			}
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(limits.WriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.log.Debug("websocket ping failed", "err", err)
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) disconnect() {
+	c.room.mu.Lock()
+	if _, ok := c.room.clients[c]; ok {
+		delete(c.room.clients, c)
+		close(c.send)
+		c.log.Info("user left")
+	}
+	c.room.mu.Unlock()
+
+	// выгнанного клиента закроет writePump, отправив кадр закрытия
+	if !c.kicked {
+		c.conn.Close()
+	}
+	c.broadcastUsers()
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"main.go/protocol"
+	"main.go/store"
+)
+
+// Сервер с одной комнатой
+func testRoom(t *testing.T) (*Room, *httptest.Server) {
+	s, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, err := s.createRoom(context.Background(), store.Room{VideoURL: "https://cdn.example.com/movie.mp4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return room, ts
+}
+
+func dialRoom(t *testing.T, ts *httptest.Server, roomID, username string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws/" + roomID + "?username=" + username
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// Следующий кадр: одно сообщение JSON
+func readMessage(t *testing.T, conn *websocket.Conn) protocol.Message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	kind, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind != websocket.TextMessage {
+		t.Fatalf("frame kind %d, want text", kind)
+	}
+	var msg protocol.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("frame %q: %v", data, err)
+	}
+	return msg
+}
+
+// Пропускает сообщения других типов
+func waitMessage(t *testing.T, conn *websocket.Conn, typ string) protocol.Message {
+	t.Helper()
+	for {
+		if msg := readMessage(t, conn); msg.Type == typ {
+			return msg
+		}
+	}
+}
+
+// При входе сервер шлёт три сообщения подряд; каждое должно прийти
+// отдельным кадром, который разбирается одним JSON.parse
+func TestJoinFrames(t *testing.T) {
+	room, ts := testRoom(t)
+	conn := dialRoom(t, ts, room.ID, "alice")
+
+	for _, typ := range []string{protocol.TypeChatPolicy, protocol.TypeSubtitles, protocol.TypeUsers} {
+		if msg := readMessage(t, conn); msg.Type != typ {
+			t.Errorf("type %q, want %q", msg.Type, typ)
+		}
+	}
+}
+
+// Slow mode не сбросить, переподключившись под другим именем
+func TestSlowModeSurvivesRename(t *testing.T) {
+	room, ts := testRoom(t)
+	room.chat = &ChatPolicy{SlowModeSeconds: 60}
+
+	chat := func(conn *websocket.Conn, text string) string {
+		if err := conn.WriteJSON(protocol.Message{Type: protocol.TypeChat, Data: text}); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal(waitMessage(t, conn, protocol.TypeChatRejected).Data)
+		var rej protocol.ChatRejected
+		json.Unmarshal(data, &rej)
+		return rej.Reason
+	}
+
+	alice := dialRoom(t, ts, room.ID, "alice")
+	alice.WriteJSON(protocol.Message{Type: protocol.TypeChat, Data: "hello"})
+	if reason := chat(alice, "again"); reason != protocol.RejectSlowMode {
+		t.Fatalf("second message: reason %q, want %q", reason, protocol.RejectSlowMode)
+	}
+	alice.Close()
+
+	bob := dialRoom(t, ts, room.ID, "bob")
+	if reason := chat(bob, "hello from bob"); reason != protocol.RejectSlowMode {
+		t.Errorf("after rename: reason %q, want %q", reason, protocol.RejectSlowMode)
+	}
+}
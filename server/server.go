@@ -0,0 +1,473 @@
+// Пакет server — сервер VideoParty в виде http.Handler, который можно
+// встроить в своё приложение:
+//
+//	vp, err := server.New(
+//		server.WithPrefix("/party"),
+//		server.WithStore(st),
+//		server.WithBaseURL("https://example.com"),
+//	)
+//	mux.Handle("/party/", vp)
+//
+// Всё состояние живёт внутри Server, так что в одном процессе можно
+// запустить несколько независимых экземпляров.
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"main.go/protocol"
+	"main.go/store"
+)
+
+// Ограничения соединений
+type Limits struct {
+	MaxMessageSize  int64         // максимальный размер входящего сообщения
+	PongWait        time.Duration // сколько ждать pong от клиента
+	WriteWait       time.Duration // таймаут записи в сокет
+	ReadBufferSize  int
+	WriteBufferSize int
+	SendQueue       int // длина очереди исходящих сообщений клиента
+
+	MaxConns      int // WebSocket-соединений всего; 0 — без ограничения
+	MaxConnsPerIP int // WebSocket-соединений с одного адреса; 0 — без ограничения
+
+	MaxFormBytes   int64 // тело формы создания комнаты
+	MaxJSONBytes   int64 // тело JSON-запросов API
+	MaxImportBytes int64 // тело импорта комнат
+
+	MaxSubtitleBytes int64 // файл субтитров SRT или WebVTT
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MaxMessageSize:  1024,
+		PongWait:        60 * time.Second,
+		WriteWait:       10 * time.Second,
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		SendQueue:       256,
+		MaxFormBytes:    16 << 10,
+		MaxJSONBytes:    64 << 10,
+		MaxImportBytes:  10 << 20,
+
+		MaxSubtitleBytes: 512 << 10,
+	}
+}
+
+func (l Limits) pingPeriod() time.Duration {
+	return (l.PongWait * 9) / 10
+}
+
+// Действия, которые проверяет хук авторизации
+const (
+	ActionCreateRoom = "create_room"
+	ActionViewRoom   = "view_room"
+	ActionJoinRoom   = "join_room"
+	ActionListRooms  = "list_rooms"
+	ActionCloseRoom  = "close_room"
+	ActionImport     = "import"
+	ActionModerate   = "moderate_room"
+	ActionListMedia  = "list_media"
+	ActionViewMedia  = "view_media"
+	ActionUpload     = "upload"
+)
+
+// Хук авторизации: ошибка запрещает действие (403).
+// roomID пуст для действий, не относящихся к комнате.
+type AuthFunc func(r *http.Request, action, roomID string) error
+
+type Server struct {
+	store    store.Store
+	baseURL  string
+	prefix   string
+	logger   *slog.Logger
+	auth     AuthFunc
+	admin    func(r *http.Request) bool
+	limits   Limits
+	trustXFF bool
+	origins  []string
+	cookies  CookiePolicy
+	upgrader websocket.Upgrader
+	handler  http.Handler
+	pages    map[string]*template.Template
+	assets   map[string]*asset
+
+	chat          ChatPolicy  // правила чата по умолчанию
+	filters       ChatFilters // фильтры содержимого чата
+	videos        VideoProviders
+	probe         *http.Client // HEAD-запросы за типом видео; nil — не проверять
+	library       *Library     // видеофайлы на сервере; nil — медиатеки нет
+	proxy         *mediaProxy  // прокси прямых ссылок; nil — выключен
+	uploadLimits  UploadLimits
+	uploads       *uploads // загрузки в медиатеку; nil — выключены
+	rates         RateLimits
+	createLimiter *limiter // создание комнат по IP
+
+	security      SecurityHeaders
+	routeSecurity map[string]func(*SecurityHeaders) // поправки из WithRouteHeaders
+
+	mu    sync.RWMutex
+	rooms map[string]*Room
+
+	connMu    sync.Mutex
+	conns     int            // открытые WebSocket-соединения
+	connsByIP map[string]int // они же по адресам клиентов
+
+	metrics  *metrics
+	draining atomic.Bool    // меняется под mu, чтобы не разойтись с pumps
+	pumps    sync.WaitGroup // запущенные writePump
+	retryIn  atomic.Int64   // секунды для Retry-After во время остановки
+
+	openAPIOnce sync.Once
+	openAPISpec map[string]interface{}
+}
+
+type Option func(*Server)
+
+// Хранилище комнат (по умолчанию — в памяти)
+func WithStore(st store.Store) Option {
+	return func(s *Server) { s.store = st }
+}
+
+// Внешний адрес для ссылок-приглашений, например "https://example.com".
+// По умолчанию берётся из запроса.
+func WithBaseURL(u string) Option {
+	return func(s *Server) { s.baseURL = strings.TrimSuffix(u, "/") }
+}
+
+// Путь, под которым сервер смонтирован, например "/party"
+func WithPrefix(p string) Option {
+	return func(s *Server) { s.prefix = strings.TrimSuffix(p, "/") }
+}
+
+// Журнал; записи дополняются request_id из контекста запроса
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Server) { s.logger = l }
+}
+
+func WithAuth(fn AuthFunc) Option {
+	return func(s *Server) { s.auth = fn }
+}
+
+// Администраторы сервера: запросам, для которых fn вернула true, не нужен
+// секрет владельца, чтобы закрыть комнату
+func WithAdmin(fn func(r *http.Request) bool) Option {
+	return func(s *Server) { s.admin = fn }
+}
+
+func WithLimits(l Limits) Option {
+	return func(s *Server) { s.limits = l }
+}
+
+// Брать адрес клиента из X-Forwarded-For; включайте только за
+// обратным прокси, который этот заголовок перезаписывает
+func WithTrustProxy(trust bool) Option {
+	return func(s *Server) { s.trustXFF = trust }
+}
+
+// New создаёт сервер и восстанавливает комнаты из хранилища
+func New(opts ...Option) (*Server, error) {
+	s := &Server{
+		store:        store.NewMemory(),
+		logger:       slog.Default(),
+		limits:       DefaultLimits(),
+		cookies:      DefaultCookiePolicy(),
+		security:     DefaultSecurityHeaders(),
+		rates:        DefaultRateLimits(),
+		chat:         DefaultChatPolicy(),
+		filters:      DefaultChatFilters(),
+		videos:       DefaultVideoProviders(),
+		uploadLimits: DefaultUploadLimits(),
+		rooms:        make(map[string]*Room),
+		connsByIP:    make(map[string]int),
+		metrics:      newMetrics(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.logger = slog.New(contextHandler{s.logger.Handler()})
+	// Плееры провайдеров встраиваются в iframe
+	s.security.FrameSources = append(s.videos.FrameSources(), s.security.FrameSources...)
+	s.createLimiter = newLimiter(func(string) RateLimit { return s.rates.CreateRoom })
+	if s.library != nil {
+		s.library.logger = s.logger
+		if err := s.library.scan(); err != nil {
+			return nil, fmt.Errorf("media library: %w", err)
+		}
+		s.logger.Info("media library scanned", "dir", s.library.dir, "files", len(s.library.list))
+	}
+	if s.proxy != nil {
+		s.proxy.prepare()
+	}
+	if s.uploadLimits.MaxSize > 0 {
+		if s.library == nil {
+			return nil, errors.New("uploads need a media library")
+		}
+		// Каталог с точкой медиатека при обходе пропускает
+		u, err := openUploads(filepath.Join(s.library.dir, ".uploads"), s.library.dir, s.uploadLimits)
+		if err != nil {
+			return nil, fmt.Errorf("uploads: %w", err)
+		}
+		s.uploads = u
+	}
+
+	s.upgrader = websocket.Upgrader{
+		ReadBufferSize:  s.limits.ReadBufferSize,
+		WriteBufferSize: s.limits.WriteBufferSize,
+		CheckOrigin:     s.originAllowed,
+	}
+
+	assets, err := loadAssets()
+	if err != nil {
+		return nil, err
+	}
+	s.assets = assets
+	if err := s.parsePages(); err != nil {
+		return nil, err
+	}
+
+	saved, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range saved {
+		s.rooms[rec.ID] = s.roomFromRecord(rec)
+	}
+
+	// Маршруты
+	mux := http.NewServeMux()
+	for _, rt := range s.routes() {
+		h := s.withSecurityHeaders(rt, rt.Handler)
+		if rt.MaxBody > 0 {
+			h = limitBody(rt.MaxBody, h)
+		}
+		mux.HandleFunc(rt.Pattern, h)
+	}
+	s.handler = s.withRequestLog(s.withOriginCheck(mux))
+	if s.prefix != "" {
+		s.handler = http.StripPrefix(s.prefix, s.handler)
+	}
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Количество комнат
+func (s *Server) RoomCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.rooms)
+}
+
+// Путь с учётом префикса монтирования
+func (s *Server) path(p string) string {
+	return s.prefix + p
+}
+
+// Домен, под которым открыта страница (без порта)
+func (s *Server) pageHost(r *http.Request) string {
+	if s.baseURL != "" {
+		if u, err := url.Parse(s.baseURL); err == nil && u.Hostname() != "" {
+			return u.Hostname()
+		}
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.Trim(host, "[]")
+}
+
+// Origin страницы: схема и хост, как их видит браузер
+func (s *Server) pageOrigin(r *http.Request) string {
+	if s.baseURL != "" {
+		if u, err := url.Parse(s.baseURL); err == nil && u.Host != "" {
+			return u.Scheme + "://" + u.Host
+		}
+	}
+	scheme := "http"
+	if s.isHTTPS(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// Абсолютный адрес для ссылок-приглашений
+func (s *Server) absURL(r *http.Request, p string) string {
+	if s.baseURL != "" {
+		return s.baseURL + s.path(p)
+	}
+	// За TLS-терминирующим прокси r.TLS пуст — схему знает isHTTPS
+	scheme := "http"
+	if s.isHTTPS(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + s.path(p)
+}
+
+// Проверка хука авторизации; при отказе ответ уже отправлен
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, action, roomID string) bool {
+	if s.auth == nil {
+		return true
+	}
+	if err := s.auth(r, action, roomID); err != nil {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			writeError(w, http.StatusForbidden, err.Error())
+		} else {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		}
+		return false
+	}
+	return true
+}
+
+func (s *Server) room(roomID string) (*Room, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	room, ok := s.rooms[roomID]
+	return room, ok
+}
+
+// Создание комнаты по описанию rec: ID и время создания заполняются здесь.
+// Ошибка *MediaError означает, что с видео что-то не так.
+func (s *Server) createRoom(ctx context.Context, rec store.Room) (*Room, error) {
+	if s.draining.Load() {
+		return nil, ErrShuttingDown
+	}
+	if err := s.checkMedia(ctx, &rec); err != nil {
+		return nil, err
+	}
+
+	rec.ID = NewRoomID()
+	if rec.Name == "" {
+		rec.Name = "Room " + rec.ID[:4]
+	}
+	rec.CreatedAt = time.Now()
+
+	room := s.roomFromRecord(rec)
+	if err := s.store.Put(room.record()); err != nil {
+		s.logger.ErrorContext(ctx, "saving room failed", "room_id", rec.ID, "err", err)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.rooms[rec.ID] = room
+	s.mu.Unlock()
+
+	s.logger.InfoContext(ctx, "room created", "room_id", rec.ID, "room_name", rec.Name, "user", rec.Owner)
+	return room, nil
+}
+
+// Закрытие комнаты: отключаем всех и удаляем из хранилища
+func (s *Server) closeRoom(ctx context.Context, roomID string) bool {
+	s.mu.Lock()
+	room, exists := s.rooms[roomID]
+	delete(s.rooms, roomID)
+	s.mu.Unlock()
+
+	if !exists {
+		return false
+	}
+	if err := s.store.Delete(roomID); err != nil && !errors.Is(err, store.ErrNotFound) {
+		s.logger.ErrorContext(ctx, "deleting room failed", "room_id", roomID, "err", err)
+	}
+
+	data, _ := json.Marshal(Message{Type: protocol.TypeRoomClosed, Time: time.Now().Unix()})
+	room.mu.Lock()
+	for client := range room.clients {
+		select {
+		case client.send <- data:
+		default:
+		}
+		close(client.send)
+		delete(room.clients, client)
+	}
+	room.mu.Unlock()
+
+	s.logger.InfoContext(ctx, "room closed", "room_id", roomID)
+	return true
+}
+
+func (s *Server) roomFromRecord(rec store.Room) *Room {
+	var caps VideoCaps
+	if v, p := s.videos.Resolve(rec.VideoURL); p != nil {
+		caps = p.Caps(v)
+	}
+	return &Room{
+		ID:        rec.ID,
+		Name:      rec.Name,
+		VideoURL:  rec.VideoURL,
+		MediaID:   rec.MediaID,
+		Owner:     rec.Owner,
+		CreatedAt: rec.CreatedAt,
+		VideoType: rec.VideoType,
+		Sources:   rec.Sources,
+		Poster:    rec.Poster,
+		Proxy:     rec.Proxy,
+		Stream:    rec.Stream,
+		File:      rec.File,
+		ownerKey:  rec.OwnerKey,
+		live:      streamCaps(caps, rec.Stream).Live,
+		clients:   make(map[*Client]bool),
+		limiter:   newLimiter(func(t string) RateLimit { return s.rates.Room[t] }),
+		chat:      rec.Chat,
+		words:     rec.Words,
+		lastChat:  make(map[string]lastChat),
+
+		subtitles:  rec.Subtitles,
+		defaultSub: rec.DefaultSubtitle,
+	}
+}
+
+func (r *Room) record() store.Room {
+	r.mu.RLock()
+	chat, words := r.chat, r.words
+	subs, defaultSub := r.subtitles, r.defaultSub
+	r.mu.RUnlock()
+	return store.Room{
+		ID:        r.ID,
+		Name:      r.Name,
+		VideoURL:  r.VideoURL,
+		MediaID:   r.MediaID,
+		Owner:     r.Owner,
+		OwnerKey:  r.ownerKey,
+		CreatedAt: r.CreatedAt,
+		VideoType: r.VideoType,
+		Sources:   r.Sources,
+		Poster:    r.Poster,
+		Proxy:     r.Proxy,
+		Stream:    r.Stream,
+		File:      r.File,
+		Chat:      chat,
+		Words:     words,
+
+		Subtitles:       subs,
+		DefaultSubtitle: defaultSub,
+	}
+}
+
+// Генерация ID комнаты
+func NewRoomID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return base64.URLEncoding.EncodeToString(b)[:8]
+}
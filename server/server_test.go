@@ -0,0 +1,42 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAbsURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []Option
+		tls   bool
+		proto string // X-Forwarded-Proto
+		want  string
+	}{
+		{"plain HTTP", nil, false, "", "http://party.example.com/room/abc"},
+		{"direct TLS", nil, true, "", "https://party.example.com/room/abc"},
+		{"trusted proxy with HTTPS", []Option{WithTrustProxy(true)}, false, "https", "https://party.example.com/room/abc"},
+		{"untrusted X-Forwarded-Proto", nil, false, "https", "http://party.example.com/room/abc"},
+		{"base URL", []Option{WithBaseURL("https://watch.example.com")}, false, "", "https://watch.example.com/room/abc"},
+		{"prefix", []Option{WithPrefix("/party"), WithTrustProxy(true)}, false, "https", "https://party.example.com/party/room/abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest("GET", "http://party.example.com/", nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if got := s.absURL(r, "/room/abc"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"main.go/protocol"
+)
+
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// Ответ 503 на подключение во время остановки
+func (s *Server) rejectDraining(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.FormatInt(s.retryIn.Load(), 10))
+	http.Error(w, ErrShuttingDown.Error(), http.StatusServiceUnavailable)
+}
+
+// Shutdown останавливает сервер: новые комнаты и подключения отклоняются
+// (503), клиентам уходит server_restarting с задержкой переподключения,
+// комнаты ещё раз сохраняются в хранилище. Затем ждёт, пока writePump
+// отправят свои очереди; по истечении ctx оставшиеся соединения
+// закрываются принудительно.
+//
+// HTTP-сервер останавливается отдельно: захваченные WebSocket-соединения
+// http.Server.Shutdown не ждёт.
+func (s *Server) Shutdown(ctx context.Context, reconnectAfter time.Duration) error {
+	s.mu.Lock()
+	if s.draining.Load() {
+		s.mu.Unlock()
+		return nil
+	}
+	s.retryIn.Store(int64((reconnectAfter + time.Second - 1) / time.Second))
+	s.draining.Store(true)
+	rooms := make([]*Room, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		rooms = append(rooms, room)
+	}
+	s.mu.Unlock()
+
+	s.logger.Info("draining connections", "rooms", len(rooms), "reconnect_after", reconnectAfter)
+
+	var errs []error
+	var clients []*Client
+	for _, room := range rooms {
+		if err := s.store.Put(room.record()); err != nil {
+			errs = append(errs, fmt.Errorf("saving room %s: %w", room.ID, err))
+		}
+
+		room.mu.Lock()
+		for client := range room.clients {
+			// Разносим переподключения во времени, чтобы не получить всплеск
+			// на только что запущенном сервере
+			delay := reconnectAfter + time.Duration(rand.Int63n(int64(reconnectAfter)+1))
+			data, _ := json.Marshal(Message{
+				Type: protocol.TypeServerRestarting,
+				Data: protocol.Restart{ReconnectAfterMs: delay.Milliseconds()},
+				Time: time.Now().Unix(),
+			})
+			select {
+			case client.send <- data:
+			default:
+			}
+			close(client.send)
+			delete(room.clients, client)
+			clients = append(clients, client)
+		}
+		room.mu.Unlock()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.pumps.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.logger.Info("connections drained", "clients", len(clients))
+	case <-ctx.Done():
+		for _, client := range clients {
+			client.conn.Close()
+		}
+		s.logger.Warn("drain deadline exceeded, connections closed", "clients", len(clients))
+		errs = append(errs, ctx.Err())
+	}
+	return errors.Join(errs...)
+}
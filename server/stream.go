@@ -0,0 +1,384 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"main.go/store"
+)
+
+type (
+	StreamInfo = store.StreamInfo
+	Rendition  = store.Rendition
+)
+
+// Сколько читать манифеста; настоящие плейлисты намного меньше
+const maxManifestSize = 2 << 20
+
+// Разбор манифеста потока по ссылке. nil без ошибки — манифест не удалось
+// скачать (сервер недоступен, 404): о потоке ничего не знаем, но и не
+// отказываем. Ошибка — манифест скачан, но это не HLS/DASH.
+func (s *Server) probeStream(ctx context.Context, format, rawURL string) (*StreamInfo, error) {
+	data, base := s.fetchManifest(ctx, rawURL)
+	if data == nil {
+		return nil, nil
+	}
+
+	var info *StreamInfo
+	var err error
+	switch format {
+	case "hls":
+		info, err = s.parseHLS(ctx, data, base)
+	case "dash":
+		info, err = parseDASH(data, base)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &MediaError{URL: rawURL, Reason: err.Error()}
+	}
+	return info, nil
+}
+
+// Манифест и его итоговый адрес после редиректов (от него считаются
+// относительные ссылки); nil — скачать не удалось
+func (s *Server) fetchManifest(ctx context.Context, rawURL string) ([]byte, *url.URL) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil
+	}
+	resp, err := s.probe.Do(req)
+	if err != nil {
+		s.logger.DebugContext(ctx, "fetching manifest failed", "url", rawURL, "err", err)
+		return nil, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		s.logger.DebugContext(ctx, "fetching manifest failed", "url", rawURL, "status", resp.StatusCode)
+		return nil, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, nil
+	}
+	return data, resp.Request.URL
+}
+
+// Плейлист HLS: мастер со списком вариантов или медиаплейлист с сегментами
+type hlsPlaylist struct {
+	variants []hlsVariant
+	duration float64 // сумма #EXTINF
+	segments int
+	ended    bool // #EXT-X-ENDLIST или #EXT-X-PLAYLIST-TYPE:VOD
+	origins  []string
+}
+
+type hlsVariant struct {
+	uri string
+	Rendition
+}
+
+func parseM3U8(data []byte, base *url.URL) (*hlsPlaylist, error) {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64<<10), maxManifestSize)
+	if !sc.Scan() || strings.TrimSpace(strings.TrimPrefix(sc.Text(), "\ufeff")) != "#EXTM3U" {
+		return nil, fmt.Errorf("the link is not an HLS playlist")
+	}
+
+	p := &hlsPlaylist{}
+	addOrigin := func(uri string) {
+		if u, err := base.Parse(uri); err == nil {
+			p.origins = mergeOrigins(p.origins, originOf(u))
+		}
+	}
+
+	var pending *hlsVariant // #EXT-X-STREAM-INF ждёт строку с адресом
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		tag, value, _ := strings.Cut(line, ":")
+		switch {
+		case line == "":
+		case tag == "#EXT-X-STREAM-INF":
+			attrs := parseM3U8Attrs(value)
+			v := hlsVariant{}
+			v.Bandwidth, _ = strconv.Atoi(attrs["BANDWIDTH"])
+			v.Codecs = attrs["CODECS"]
+			if w, h, ok := strings.Cut(attrs["RESOLUTION"], "x"); ok {
+				v.Width, _ = strconv.Atoi(w)
+				v.Height, _ = strconv.Atoi(h)
+			}
+			pending = &v
+		case tag == "#EXT-X-MEDIA" || tag == "#EXT-X-MAP":
+			if uri := parseM3U8Attrs(value)["URI"]; uri != "" {
+				addOrigin(uri)
+			}
+		case tag == "#EXTINF":
+			d, _, _ := strings.Cut(value, ",")
+			if f, err := strconv.ParseFloat(strings.TrimSpace(d), 64); err == nil && f > 0 {
+				p.duration += f
+			}
+			p.segments++
+		case tag == "#EXT-X-ENDLIST":
+			p.ended = true
+		case tag == "#EXT-X-PLAYLIST-TYPE" && value == "VOD":
+			p.ended = true
+		case strings.HasPrefix(line, "#"):
+			// Остальные теги и комментарии не нужны
+		default:
+			addOrigin(line)
+			if pending != nil {
+				pending.uri = line
+				p.variants = append(p.variants, *pending)
+				pending = nil
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("the HLS playlist is too large")
+	}
+	if len(p.variants) == 0 && p.segments == 0 {
+		return nil, fmt.Errorf("the HLS playlist has no variants or segments")
+	}
+	return p, nil
+}
+
+// Атрибуты тега: BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2"
+func parseM3U8Attrs(s string) map[string]string {
+	attrs := make(map[string]string)
+	for s != "" {
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+			rest = strings.TrimPrefix(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[strings.TrimSpace(name)] = value
+		s = rest
+	}
+	return attrs
+}
+
+// HLS: варианты берём из мастер-плейлиста, длительность и эфир — из
+// медиаплейлиста первого варианта
+func (s *Server) parseHLS(ctx context.Context, data []byte, base *url.URL) (*StreamInfo, error) {
+	p, err := parseM3U8(data, base)
+	if err != nil {
+		return nil, err
+	}
+	info := &StreamInfo{Format: "hls", Origins: p.origins}
+
+	if len(p.variants) > 0 {
+		for _, v := range p.variants {
+			info.Renditions = append(info.Renditions, v.Rendition)
+		}
+		u, err := base.Parse(p.variants[0].uri)
+		if err != nil {
+			return info, nil
+		}
+		data, base = s.fetchManifest(ctx, u.String())
+		if data == nil {
+			return info, nil
+		}
+		if p, err = parseM3U8(data, base); err != nil {
+			return info, nil
+		}
+		info.Origins = mergeOrigins(info.Origins, p.origins)
+	}
+
+	info.Live = !p.ended
+	if !info.Live {
+		info.Duration = p.duration
+	}
+	return info, nil
+}
+
+// MPD: только то, что нужно для описания потока
+type mpd struct {
+	Type     string `xml:"type,attr"`
+	Duration string `xml:"mediaPresentationDuration,attr"`
+	BaseURL  string `xml:"BaseURL"`
+	Periods  []struct {
+		BaseURL string `xml:"BaseURL"`
+		Sets    []struct {
+			MimeType    string `xml:"mimeType,attr"`
+			ContentType string `xml:"contentType,attr"`
+			Codecs      string `xml:"codecs,attr"`
+			BaseURL     string `xml:"BaseURL"`
+			Reps        []struct {
+				Bandwidth int    `xml:"bandwidth,attr"`
+				Width     int    `xml:"width,attr"`
+				Height    int    `xml:"height,attr"`
+				MimeType  string `xml:"mimeType,attr"`
+				Codecs    string `xml:"codecs,attr"`
+				BaseURL   string `xml:"BaseURL"`
+			} `xml:"Representation"`
+		} `xml:"AdaptationSet"`
+	} `xml:"Period"`
+}
+
+func parseDASH(data []byte, base *url.URL) (*StreamInfo, error) {
+	var m mpd
+	if err := xml.Unmarshal(data, &m); err != nil || len(m.Periods) == 0 {
+		return nil, fmt.Errorf("the link is not a DASH manifest")
+	}
+
+	info := &StreamInfo{Format: "dash", Live: m.Type == "dynamic"}
+	if !info.Live {
+		info.Duration = parseISODuration(m.Duration).Seconds()
+	}
+
+	var origins []string
+	addOrigin := func(refs ...string) {
+		u := base
+		for _, ref := range refs {
+			if ref = strings.TrimSpace(ref); ref == "" {
+				continue
+			}
+			next, err := u.Parse(ref)
+			if err != nil {
+				return
+			}
+			u = next
+		}
+		origins = mergeOrigins(origins, originOf(u))
+	}
+
+	addOrigin(m.BaseURL)
+	for _, p := range m.Periods {
+		addOrigin(m.BaseURL, p.BaseURL)
+		for _, set := range p.Sets {
+			addOrigin(m.BaseURL, p.BaseURL, set.BaseURL)
+			for _, r := range set.Reps {
+				addOrigin(m.BaseURL, p.BaseURL, set.BaseURL, r.BaseURL)
+				mime := r.MimeType
+				if mime == "" {
+					mime = set.MimeType
+				}
+				// Качество описывают только видеодорожки
+				if !strings.HasPrefix(mime, "video/") && set.ContentType != "video" && r.Width == 0 {
+					continue
+				}
+				codecs := r.Codecs
+				if codecs == "" {
+					codecs = set.Codecs
+				}
+				info.Renditions = append(info.Renditions, Rendition{
+					Bandwidth: r.Bandwidth,
+					Width:     r.Width,
+					Height:    r.Height,
+					Codecs:    codecs,
+				})
+			}
+		}
+	}
+	info.Origins = origins
+	return info, nil
+}
+
+// Длительность ISO 8601 из MPD: PT1H2M3.5S, P1DT2H. Годы и месяцы без
+// даты отсчёта не измерить, берём номинальные 365 и 30 дней.
+// Ошибка разбора и переполнение дают 0.
+func parseISODuration(s string) time.Duration {
+	s, ok := strings.CutPrefix(strings.TrimSpace(s), "P")
+	if !ok {
+		return 0
+	}
+	var total time.Duration
+	inTime := false
+	num := ""
+	for _, r := range s {
+		switch {
+		case r == 'T':
+			inTime = true
+		case r >= '0' && r <= '9' || r == '.':
+			num += string(r)
+		default:
+			f, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				return 0
+			}
+			num = ""
+			var unit time.Duration
+			switch {
+			case r == 'Y' && !inTime:
+				unit = 365 * 24 * time.Hour
+			case r == 'M' && !inTime:
+				unit = 30 * 24 * time.Hour
+			case r == 'W' && !inTime:
+				unit = 7 * 24 * time.Hour
+			case r == 'D' && !inTime:
+				unit = 24 * time.Hour
+			case r == 'H' && inTime:
+				unit = time.Hour
+			case r == 'M' && inTime:
+				unit = time.Minute
+			case r == 'S' && inTime:
+				unit = time.Second
+			default:
+				return 0
+			}
+			d := f * float64(unit)
+			if d >= float64(math.MaxInt64-total) {
+				return 0
+			}
+			total += time.Duration(d)
+		}
+	}
+	// Число без единицы в конце
+	if num != "" {
+		return 0
+	}
+	return total
+}
+
+// Origin ссылки для CSP; у не-http(s) ссылок его нет
+func originOf(u *url.URL) []string {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil
+	}
+	return []string{u.Scheme + "://" + u.Host}
+}
+
+// Объединение списков origin без повторов
+func mergeOrigins(a, b []string) []string {
+	for _, o := range b {
+		found := false
+		for _, x := range a {
+			if x == o {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, o)
+		}
+	}
+	return a
+}
+
+// Поправка возможностей плеера по манифесту: эфир не перематывают
+func streamCaps(caps VideoCaps, info *StreamInfo) VideoCaps {
+	if info != nil && info.Live {
+		caps.Live = true
+		caps.Seekable = false
+	}
+	return caps
+}
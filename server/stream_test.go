@@ -0,0 +1,271 @@
+package server
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseM3U8(t *testing.T) {
+	base, _ := url.Parse("https://cdn.example.com/show/master.m3u8")
+	tests := []struct {
+		name     string
+		data     string
+		err      bool
+		variants []hlsVariant
+		duration float64
+		segments int
+		ended    bool
+		origins  []string
+	}{
+		{
+			name: "master playlist",
+			data: "#EXTM3U\n" +
+				"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aud\",NAME=\"English\",URI=\"https://audio.example.net/en.m3u8\"\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=1280000,RESOLUTION=1280x720,CODECS=\"avc1.4d401f,mp4a.40.2\"\n" +
+				"720p/index.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=640000,RESOLUTION=640x360\n" +
+				"https://cdn2.example.org/360p.m3u8\n",
+			variants: []hlsVariant{
+				{"720p/index.m3u8", Rendition{Bandwidth: 1280000, Width: 1280, Height: 720, Codecs: "avc1.4d401f,mp4a.40.2"}},
+				{"https://cdn2.example.org/360p.m3u8", Rendition{Bandwidth: 640000, Width: 640, Height: 360}},
+			},
+			origins: []string{"https://audio.example.net", "https://cdn.example.com", "https://cdn2.example.org"},
+		},
+		{
+			name: "VOD media playlist",
+			data: "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXT-X-MAP:URI=\"init.mp4\"\n" +
+				"#EXTINF:4.0,\nseg0.m4s\n#EXTINF:4.0,\nseg1.m4s\n#EXTINF:2.5,title\nseg2.m4s\n#EXT-X-ENDLIST\n",
+			duration: 10.5,
+			segments: 3,
+			ended:    true,
+			origins:  []string{"https://cdn.example.com"},
+		},
+		{
+			name:     "VOD by playlist type, with BOM and CRLF",
+			data:     "\ufeff#EXTM3U\r\n#EXT-X-PLAYLIST-TYPE:VOD\r\n#EXTINF:6,\r\nseg0.ts\r\n",
+			duration: 6,
+			segments: 1,
+			ended:    true,
+			origins:  []string{"https://cdn.example.com"},
+		},
+		{
+			name: "live media playlist",
+			data: "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:120\n" +
+				"#EXTINF:2.000,\nhttps://edge.example.net/seg120.ts\n#EXTINF:2.000,\nhttps://edge.example.net/seg121.ts\n",
+			duration: 4,
+			segments: 2,
+			origins:  []string{"https://edge.example.net"},
+		},
+		{
+			name:     "non-http segments have no origin",
+			data:     "#EXTM3U\n#EXTINF:1,\ndata:video/mp2t;base64,AAAA\n#EXT-X-ENDLIST\n",
+			duration: 1,
+			segments: 1,
+			ended:    true,
+		},
+		{name: "not a playlist", data: "<html></html>", err: true},
+		{name: "no variants or segments", data: "#EXTM3U\n#EXT-X-VERSION:3\n", err: true},
+		{name: "empty", data: "", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseM3U8([]byte(tt.data), base)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parsed as %+v", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(p.variants, tt.variants) {
+				t.Errorf("variants %+v, want %+v", p.variants, tt.variants)
+			}
+			if p.duration != tt.duration || p.segments != tt.segments || p.ended != tt.ended {
+				t.Errorf("duration %v, segments %d, ended %v", p.duration, p.segments, p.ended)
+			}
+			if !reflect.DeepEqual(p.origins, tt.origins) {
+				t.Errorf("origins %q, want %q", p.origins, tt.origins)
+			}
+		})
+	}
+}
+
+func TestParseM3U8Attrs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want map[string]string
+	}{
+		{`BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2",RESOLUTION=1280x720`,
+			map[string]string{"BANDWIDTH": "1280000", "CODECS": "avc1.4d401f,mp4a.40.2", "RESOLUTION": "1280x720"}},
+		{`URI="a,b=c.m3u8",TYPE=AUDIO`, map[string]string{"URI": "a,b=c.m3u8", "TYPE": "AUDIO"}},
+		{`A=1, B=2`, map[string]string{"A": "1", "B": "2"}},
+		{`URI="unterminated`, map[string]string{"URI": "unterminated"}},
+		{`NAME=""`, map[string]string{"NAME": ""}},
+		{`NOVALUE`, map[string]string{}},
+		{``, map[string]string{}},
+	}
+	for _, tt := range tests {
+		if got := parseM3U8Attrs(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseM3U8Attrs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseDASH(t *testing.T) {
+	base, _ := url.Parse("https://live.example.com/show/manifest.mpd")
+	tests := []struct {
+		name       string
+		data       string
+		err        bool
+		live       bool
+		duration   float64
+		renditions []Rendition
+		origins    []string
+	}{
+		{
+			name: "static",
+			data: `<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT1H2M3.5S">
+  <BaseURL>https://cdn.example.com/dash/</BaseURL>
+  <Period>
+    <AdaptationSet mimeType="video/mp4" codecs="avc1.64001f">
+      <Representation id="1080" bandwidth="5000000" width="1920" height="1080"/>
+      <Representation id="720" bandwidth="2500000" width="1280" height="720" codecs="avc1.4d401f">
+        <BaseURL>https://cdn2.example.org/720/</BaseURL>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet mimeType="audio/mp4" codecs="mp4a.40.2">
+      <Representation id="audio" bandwidth="128000"/>
+    </AdaptationSet>
+  </Period>
+</MPD>`,
+			duration: 3723.5,
+			renditions: []Rendition{
+				{Bandwidth: 5000000, Width: 1920, Height: 1080, Codecs: "avc1.64001f"},
+				{Bandwidth: 2500000, Width: 1280, Height: 720, Codecs: "avc1.4d401f"},
+			},
+			origins: []string{"https://cdn.example.com", "https://cdn2.example.org"},
+		},
+		{
+			name: "dynamic",
+			data: `<MPD type="dynamic" mediaPresentationDuration="PT10S">
+  <Period>
+    <AdaptationSet contentType="video">
+      <Representation bandwidth="800000" codecs="vp09.00.10.08"/>
+    </AdaptationSet>
+    <AdaptationSet contentType="audio">
+      <Representation bandwidth="64000" codecs="opus"/>
+    </AdaptationSet>
+  </Period>
+</MPD>`,
+			live:       true,
+			renditions: []Rendition{{Bandwidth: 800000, Codecs: "vp09.00.10.08"}},
+			origins:    []string{"https://live.example.com"},
+		},
+		{
+			name: "relative base URLs",
+			data: `<MPD type="static" mediaPresentationDuration="P1DT2H">
+  <Period><BaseURL>period/</BaseURL>
+    <AdaptationSet mimeType="video/webm"><BaseURL>https://video.example.net/</BaseURL>
+      <Representation bandwidth="1" width="2" height="3"><BaseURL>r/</BaseURL></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`,
+			duration:   26 * 3600,
+			renditions: []Rendition{{Bandwidth: 1, Width: 2, Height: 3}},
+			origins:    []string{"https://live.example.com", "https://video.example.net"},
+		},
+		{name: "no periods", data: `<MPD type="static"></MPD>`, err: true},
+		{name: "not XML", data: "#EXTM3U\n", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parseDASH([]byte(tt.data), base)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parsed as %+v", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Format != "dash" || info.Live != tt.live || info.Duration != tt.duration {
+				t.Errorf("format %q, live %v, duration %v", info.Format, info.Live, info.Duration)
+			}
+			if !reflect.DeepEqual(info.Renditions, tt.renditions) {
+				t.Errorf("renditions %+v, want %+v", info.Renditions, tt.renditions)
+			}
+			if !reflect.DeepEqual(info.Origins, tt.origins) {
+				t.Errorf("origins %q, want %q", info.Origins, tt.origins)
+			}
+		})
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"PT1H2M3.5S", time.Hour + 2*time.Minute + 3500*time.Millisecond},
+		{"PT0S", 0},
+		{"PT90M", 90 * time.Minute},
+		{" PT0.25S ", 250 * time.Millisecond},
+		{"P1DT2H", 26 * time.Hour},
+		{"P2W", 14 * day},
+		{"P1Y2M", 365*day + 60*day}, // номинальные год и месяцы
+		{"P1MT1M", 30*day + time.Minute},
+
+		// Ошибки
+		{"", 0},
+		{"1H", 0},
+		{"PT", 0},
+		{"PT5", 0},
+		{"PTS", 0},
+		{"P1H", 0},  // часы только после T
+		{"PT1D", 0}, // дни только до T
+		{"PT1e3S", 0},
+		{"-PT5S", 0},
+		{"P999999999999D", 0}, // переполнение
+	}
+	for _, tt := range tests {
+		if got := parseISODuration(tt.in); got != tt.want {
+			t.Errorf("parseISODuration(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMergeOrigins(t *testing.T) {
+	tests := []struct {
+		a, b, want []string
+	}{
+		{nil, nil, nil},
+		{nil, []string{"https://a.com"}, []string{"https://a.com"}},
+		{[]string{"https://a.com"}, nil, []string{"https://a.com"}},
+		{[]string{"https://a.com"}, []string{"https://a.com", "https://b.com"}, []string{"https://a.com", "https://b.com"}},
+		{[]string{"https://b.com", "https://a.com"}, []string{"https://a.com", "http://a.com"}, []string{"https://b.com", "https://a.com", "http://a.com"}},
+	}
+	for _, tt := range tests {
+		if got := mergeOrigins(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("mergeOrigins(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	for raw, want := range map[string][]string{
+		"https://cdn.example.com:8443/a/b.m3u8": {"https://cdn.example.com:8443"},
+		"http://cdn.example.com/":               {"http://cdn.example.com"},
+		"ftp://cdn.example.com/x":               nil,
+		"data:video/mp4;base64,AAAA":            nil,
+	} {
+		u, _ := url.Parse(raw)
+		if got := originOf(u); !reflect.DeepEqual(got, want) {
+			t.Errorf("originOf(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
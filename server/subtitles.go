@@ -0,0 +1,444 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"main.go/protocol"
+	"main.go/store"
+)
+
+type (
+	Subtitles     = protocol.Subtitles
+	SubtitleTrack = protocol.SubtitleTrack
+)
+
+// Дорожек на комнату: они хранятся в записи комнаты целиком
+const maxSubtitles = 8
+
+// Файл не SRT и не WebVTT
+var errNotSubtitles = errors.New("file is not SRT or WebVTT subtitles")
+
+// Строка времени SRT: 00:01:02,500 --> 00:01:04,000 и необязательные
+// координаты X1:… Y2:…, которые WebVTT не понимает
+var srtTiming = regexp.MustCompile(`^\s*(\d+):(\d{1,2}):(\d{1,2})[,.](\d{1,3})\s*-->\s*(\d+):(\d{1,2}):(\d{1,2})[,.](\d{1,3})`)
+
+// Теги SRT и вставки ASS вроде {\an8}
+var srtMarkup = regexp.MustCompile(`</?([a-zA-Z]+)[^>]*>|\{\\[^}]*\}`)
+
+// Язык дорожки в записи BCP 47: en, ru, pt-BR, zh-Hant
+var langRe = regexp.MustCompile(`^[A-Za-z]{2,8}(-[A-Za-z0-9]{1,8})*$`)
+
+var cueEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Текст файла субтитров в WebVTT: WebVTT проверяется и остаётся как
+// есть, SRT переводится
+func toWebVTT(data []byte) (string, error) {
+	text, err := subtitleText(data)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(text, "WEBVTT") {
+		// После сигнатуры — конец строки, пробел или таб
+		if rest := text[len("WEBVTT"):]; rest != "" && rest[0] != '\n' && rest[0] != ' ' && rest[0] != '\t' {
+			return "", errNotSubtitles
+		}
+		if !strings.Contains(text, "-->") {
+			return "", errors.New("no cues found in the file")
+		}
+		return text, nil
+	}
+	return srtToVTT(text)
+}
+
+// Текст в UTF-8 без BOM и с переводами строк \n. UTF-16 с BOM пишут
+// некоторые редакторы субтитров под Windows; его переводим, остальные
+// однобайтовые кодировки не угадать — такие файлы отклоняются.
+func subtitleText(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		be := data[0] == 0xFE
+		data = data[2:]
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			if be {
+				units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+			} else {
+				units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+			}
+		}
+		data = []byte(string(utf16.Decode(units)))
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		data = data[3:]
+	}
+	if !utf8.Valid(data) {
+		return "", errors.New("subtitles must be UTF-8 or UTF-16 text")
+	}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n"), nil
+}
+
+// SRT в WebVTT: номера субтитров и координаты отбрасываются, в
+// таймкодах запятая меняется на точку, из тегов остаются <i>, <b> и <u>
+func srtToVTT(text string) (string, error) {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	cues := 0
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		m := srtTiming.FindStringSubmatch(lines[i])
+		if m == nil {
+			// Номера субтитров и мусор между ними
+			continue
+		}
+		var cue []string
+		for i++; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+			if srtTiming.MatchString(lines[i]) {
+				// Пропущена пустая строка: номер следующего субтитра
+				// остался в тексте этого
+				if n := len(cue); n > 0 && isDigits(strings.TrimSpace(cue[n-1])) {
+					cue = cue[:n-1]
+				}
+				i--
+				break
+			}
+			if line := strings.TrimRight(cueText(lines[i]), " \t"); line != "" {
+				cue = append(cue, line)
+			}
+		}
+		if len(cue) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s --> %s\n%s\n", vttTime(m[1:5]), vttTime(m[5:9]), strings.Join(cue, "\n"))
+		cues++
+	}
+	if cues == 0 {
+		return "", errNotSubtitles
+	}
+	return b.String(), nil
+}
+
+// Часы, минуты, секунды и миллисекунды в таймкод WebVTT;
+// "5" в миллисекундах SRT означает 500
+func vttTime(p []string) string {
+	ms := (p[3] + "00")[:3]
+	return fmt.Sprintf("%02s:%02s:%02s.%s", p[0], p[1], p[2], ms)
+}
+
+// Строка текста SRT в текст реплики WebVTT: &, < и > экранируются,
+// <font> и вставки ASS убираются
+func cueText(line string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range srtMarkup.FindAllStringSubmatchIndex(line, -1) {
+		b.WriteString(cueEscaper.Replace(line[last:m[0]]))
+		last = m[1]
+		if m[2] < 0 {
+			continue
+		}
+		switch tag := strings.ToLower(line[m[2]:m[3]]); tag {
+		case "i", "b", "u":
+			if line[m[0]+1] == '/' {
+				b.WriteString("</" + tag + ">")
+			} else {
+				b.WriteString("<" + tag + ">")
+			}
+		}
+	}
+	b.WriteString(cueEscaper.Replace(line[last:]))
+	return b.String()
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Адрес файла дорожки
+func (s *Server) subtitlePath(roomID, trackID string) string {
+	return s.path("/subtitles/" + url.PathEscape(roomID) + "/" + url.PathEscape(trackID))
+}
+
+// Дорожки комнаты без текста, с адресами файлов
+func (s *Server) subtitles(room *Room) Subtitles {
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	list := Subtitles{Default: room.defaultSub, Tracks: make([]SubtitleTrack, 0, len(room.subtitles))}
+	for _, sub := range room.subtitles {
+		list.Tracks = append(list.Tracks, SubtitleTrack{
+			ID:    sub.ID,
+			Label: sub.Label,
+			Lang:  sub.Lang,
+			URL:   s.subtitlePath(room.ID, sub.ID),
+		})
+	}
+	return list
+}
+
+// Дорожки новому участнику
+func (c *Client) sendSubtitles() {
+	data, _ := json.Marshal(Message{
+		Type: protocol.TypeSubtitles,
+		Data: c.srv.subtitles(c.room),
+		Time: time.Now().Unix(),
+	})
+	c.trySend(data)
+}
+
+// Сохраняем изменённые дорожки и рассылаем их участникам
+func (s *Server) saveSubtitles(r *http.Request, room *Room) (Subtitles, bool) {
+	if err := s.store.Put(room.record()); err != nil {
+		s.logger.ErrorContext(r.Context(), "saving room failed", "room_id", room.ID, "err", err)
+		return Subtitles{}, false
+	}
+
+	list := s.subtitles(room)
+	data, _ := json.Marshal(Message{Type: protocol.TypeSubtitles, Data: list, Time: time.Now().Unix()})
+	room.mu.RLock()
+	for client := range room.clients {
+		select {
+		case client.send <- data:
+		default:
+		}
+	}
+	room.mu.RUnlock()
+	return list, true
+}
+
+type subtitleQuery struct {
+	Label   string `query:"label"`   // название в списке; пусто — язык или «Subtitles N»
+	Lang    string `query:"lang"`    // BCP 47: en, ru, pt-BR
+	Default string `query:"default"` // непусто — сделать дорожкой по умолчанию
+}
+
+// Дорожка по умолчанию; пустой ID выключает субтитры по умолчанию
+type DefaultSubtitle struct {
+	ID string `json:"id"`
+}
+
+// Дорожки субтитров комнаты (JSON)
+func (s *Server) apiListSubtitlesHandler(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomID")
+	if !s.authorize(w, r, ActionViewRoom, roomID) {
+		return
+	}
+
+	room, exists := s.room(roomID)
+	if !exists {
+		writeError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.subtitles(room))
+}
+
+// Загрузка дорожки: тело запроса — файл SRT или WebVTT
+func (s *Server) apiAddSubtitleHandler(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomID")
+	if !s.authorize(w, r, ActionModerate, roomID) {
+		return
+	}
+
+	room, exists := s.room(roomID)
+	if !exists {
+		writeError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	if !s.requireOwner(w, r, room) {
+		return
+	}
+
+	var q subtitleQuery
+	decodeValues(r.URL.Query(), "query", &q)
+	q.Label = strings.TrimSpace(q.Label)
+	if q.Lang != "" && !langRe.MatchString(q.Lang) {
+		writeError(w, http.StatusBadRequest, "lang must be a language tag like en or pt-BR")
+		return
+	}
+	if utf8.RuneCountInString(q.Label) > 64 {
+		writeError(w, http.StatusBadRequest, "label must be at most 64 characters")
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, bodyStatus(err), "reading subtitles failed: "+err.Error())
+		return
+	}
+	vtt, err := toWebVTT(data)
+	if err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+
+	sub := store.Subtitle{ID: newID()[:8], Label: q.Label, Lang: q.Lang, VTT: vtt}
+	room.mu.Lock()
+	if len(room.subtitles) >= maxSubtitles {
+		room.mu.Unlock()
+		writeError(w, http.StatusConflict, fmt.Sprintf("a room can have at most %d subtitle tracks", maxSubtitles))
+		return
+	}
+	if sub.Label == "" {
+		sub.Label = sub.Lang
+	}
+	if sub.Label == "" {
+		sub.Label = fmt.Sprintf("Subtitles %d", len(room.subtitles)+1)
+	}
+	// Новый срез, а не append на месте: record() отдаёт его хранилищу без копии
+	room.subtitles = append(room.subtitles[:len(room.subtitles):len(room.subtitles)], sub)
+	if q.Default != "" {
+		room.defaultSub = sub.ID
+	}
+	room.mu.Unlock()
+
+	if _, ok := s.saveSubtitles(r, room); !ok {
+		writeError(w, http.StatusInternalServerError, "could not save room")
+		return
+	}
+	s.logger.InfoContext(r.Context(), "subtitles added", "room_id", roomID,
+		"track_id", sub.ID, "label", sub.Label, "lang", sub.Lang, "bytes", len(vtt))
+	writeJSON(w, http.StatusCreated, SubtitleTrack{
+		ID:    sub.ID,
+		Label: sub.Label,
+		Lang:  sub.Lang,
+		URL:   s.subtitlePath(roomID, sub.ID),
+	})
+}
+
+// Удаление дорожки; если она была по умолчанию, субтитры выключаются
+func (s *Server) apiDeleteSubtitleHandler(w http.ResponseWriter, r *http.Request) {
+	roomID, trackID := r.PathValue("roomID"), r.PathValue("trackID")
+	if !s.authorize(w, r, ActionModerate, roomID) {
+		return
+	}
+
+	room, exists := s.room(roomID)
+	if !exists {
+		writeError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	if !s.requireOwner(w, r, room) {
+		return
+	}
+
+	room.mu.Lock()
+	subs := make([]store.Subtitle, 0, len(room.subtitles))
+	for _, sub := range room.subtitles {
+		if sub.ID != trackID {
+			subs = append(subs, sub)
+		}
+	}
+	found := len(subs) < len(room.subtitles)
+	if found {
+		room.subtitles = subs
+		if room.defaultSub == trackID {
+			room.defaultSub = ""
+		}
+	}
+	room.mu.Unlock()
+	if !found {
+		writeError(w, http.StatusNotFound, "subtitle track not found")
+		return
+	}
+
+	list, ok := s.saveSubtitles(r, room)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "could not save room")
+		return
+	}
+	s.logger.InfoContext(r.Context(), "subtitles deleted", "room_id", roomID, "track_id", trackID)
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Дорожка по умолчанию для зрителей, которые не выбрали свою
+func (s *Server) apiSetDefaultSubtitleHandler(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomID")
+	if !s.authorize(w, r, ActionModerate, roomID) {
+		return
+	}
+
+	room, exists := s.room(roomID)
+	if !exists {
+		writeError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	if !s.requireOwner(w, r, room) {
+		return
+	}
+
+	var req DefaultSubtitle
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, bodyStatus(err), "invalid JSON: "+err.Error())
+		return
+	}
+
+	room.mu.Lock()
+	found := req.ID == ""
+	for _, sub := range room.subtitles {
+		found = found || sub.ID == req.ID
+	}
+	if found {
+		room.defaultSub = req.ID
+	}
+	room.mu.Unlock()
+	if !found {
+		writeError(w, http.StatusNotFound, "subtitle track not found")
+		return
+	}
+
+	list, ok := s.saveSubtitles(r, room)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "could not save room")
+		return
+	}
+	s.logger.InfoContext(r.Context(), "default subtitles changed", "room_id", roomID, "track_id", req.ID)
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Файл WebVTT для <track>
+func (s *Server) subtitleHandler(w http.ResponseWriter, r *http.Request) {
+	roomID, trackID := r.PathValue("roomID"), r.PathValue("trackID")
+	if !s.authorize(w, r, ActionViewRoom, roomID) {
+		return
+	}
+	room, ok := s.room(roomID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var vtt string
+	room.mu.RLock()
+	for _, sub := range room.subtitles {
+		if sub.ID == trackID {
+			vtt = sub.VTT
+			break
+		}
+	}
+	room.mu.RUnlock()
+	if vtt == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	// Загруженная дорожка не меняется: у новой другой ID
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, "", time.Time{}, strings.NewReader(vtt))
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestVTTTime(t *testing.T) {
+	tests := []struct {
+		srt  string
+		want string
+	}{
+		{"00:01:02,500 --> 00:01:04,000", "00:01:02.500 --> 00:01:04.000"},
+		{"00:01:02.500 --> 00:01:04.000", "00:01:02.500 --> 00:01:04.000"},
+		{"0:1:2,5 --> 0:1:4,25", "00:01:02.500 --> 00:01:04.250"},
+		{"1:02:03,040 --> 1:02:04,004", "01:02:03.040 --> 01:02:04.004"},
+		{"123:00:00,000 --> 123:00:01,000", "123:00:00.000 --> 123:00:01.000"},
+		{"  00:00:01,000  -->  00:00:02,000  X1:100 X2:600 Y1:20 Y2:50", "00:00:01.000 --> 00:00:02.000"},
+	}
+	for _, tt := range tests {
+		m := srtTiming.FindStringSubmatch(tt.srt)
+		if m == nil {
+			t.Errorf("%q: not a timing line", tt.srt)
+			continue
+		}
+		if got := vttTime(m[1:5]) + " --> " + vttTime(m[5:9]); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.srt, got, tt.want)
+		}
+	}
+}
+
+func TestSRTToVTT(t *testing.T) {
+	tests := []struct {
+		name, srt, want string
+	}{
+		{
+			"two cues",
+			"1\n00:00:01,000 --> 00:00:02,500\nHello\n\n2\n00:00:03,000 --> 00:00:04,000\nTwo\nlines\n",
+			"WEBVTT\n\n00:00:01.000 --> 00:00:02.500\nHello\n\n00:00:03.000 --> 00:00:04.000\nTwo\nlines\n",
+		},
+		{
+			"CRLF line endings",
+			"1\r\n00:00:01,000 --> 00:00:02,000\r\nHello\r\n\r\n",
+			"WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\n",
+		},
+		{
+			"missing blank line between cues",
+			"1\n00:00:01,000 --> 00:00:02,000\nOne\n2\n00:00:03,000 --> 00:00:04,000\nTwo\n",
+			"WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nOne\n\n00:00:03.000 --> 00:00:04.000\nTwo\n",
+		},
+		{
+			"number in the text stays when a blank line follows",
+			"1\n00:00:01,000 --> 00:00:02,000\n42\n\n",
+			"WEBVTT\n\n00:00:01.000 --> 00:00:02.000\n42\n",
+		},
+		{
+			"empty cue is dropped",
+			"1\n00:00:01,000 --> 00:00:02,000\n\n2\n00:00:03,000 --> 00:00:04,000\nTwo\n",
+			"WEBVTT\n\n00:00:03.000 --> 00:00:04.000\nTwo\n",
+		},
+		{
+			"tags and escaping",
+			"1\n00:00:01,000 --> 00:00:02,000\n<i>Hi</i> <B>there</B> <font color=\"red\">red</font>\n{\\an8}Tom & Jerry <3 >_<\n",
+			"WEBVTT\n\n00:00:01.000 --> 00:00:02.000\n<i>Hi</i> <b>there</b> red\nTom &amp; Jerry &lt;3 &gt;_&lt;\n",
+		},
+		{
+			"script tags do not survive",
+			"1\n00:00:01,000 --> 00:00:02,000\n<script>alert(1)</script>\n",
+			"WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nalert(1)\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toWebVTT([]byte(tt.srt))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubtitleEncodings(t *testing.T) {
+	srt := "1\n00:00:01,000 --> 00:00:02,000\nПривет\n"
+	want := "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nПривет\n"
+
+	utf16LE := []byte{0xFF, 0xFE}
+	utf16BE := []byte{0xFE, 0xFF}
+	for _, u := range utf16.Encode([]rune(srt)) {
+		utf16LE = append(utf16LE, byte(u), byte(u>>8))
+		utf16BE = append(utf16BE, byte(u>>8), byte(u))
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"UTF-8", []byte(srt)},
+		{"UTF-8 with BOM", append([]byte{0xEF, 0xBB, 0xBF}, srt...)},
+		{"UTF-16LE", utf16LE},
+		{"UTF-16BE", utf16BE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toWebVTT(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("got %q", got)
+			}
+		})
+	}
+
+	// Windows-1251 не угадать
+	if _, err := toWebVTT([]byte("1\n00:00:01,000 --> 00:00:02,000\n\xcf\xf0\xe8\xe2\xe5\xf2\n")); err == nil {
+		t.Error("single-byte encoding accepted")
+	}
+}
+
+func TestWebVTTValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		ok   bool
+	}{
+		{"plain", "WEBVTT\n\n00:01.000 --> 00:02.000\nHi\n", true},
+		{"header text", "WEBVTT - Movie\n\n00:01.000 --> 00:02.000\nHi\n", true},
+		{"BOM", "\ufeffWEBVTT\n\n00:01.000 --> 00:02.000\nHi\n", true},
+		{"glued signature", "WEBVTTX\n\n00:01.000 --> 00:02.000\nHi\n", false},
+		{"no cues", "WEBVTT\n\nNOTE nothing here\n", false},
+		{"not subtitles", "hello world\n", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toWebVTT([]byte(tt.data))
+			if (err == nil) != tt.ok {
+				t.Fatalf("err %v, want ok=%v", err, tt.ok)
+			}
+			if tt.ok && got[:6] != "WEBVTT" {
+				t.Errorf("got %q", got)
+			}
+		})
+	}
+	if _, err := toWebVTT([]byte("hello")); !errors.Is(err, errNotSubtitles) {
+		t.Errorf("err %v, want errNotSubtitles", err)
+	}
+}
@@ -0,0 +1,608 @@
+package server
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"main.go/mediainfo"
+	"main.go/store"
+)
+
+// Загрузка видео в медиатеку по протоколу tus 1.0
+// (https://tus.io/protocols/resumable-upload): POST создаёт загрузку,
+// PATCH дописывает кусок с заявленного смещения, HEAD говорит, сколько уже
+// принято, DELETE отменяет. Поддерживаются расширения creation,
+// expiration, checksum и termination. Готовый файл попадает в медиатеку,
+// и для него сразу создаётся комната; её ID приходит в заголовке Upload-Room.
+
+const tusVersion = "1.0.0"
+
+// Сколько можно передавать один кусок: больше ReadTimeout сервера
+const uploadChunkTimeout = 10 * time.Minute
+
+// Код tus для куска, не совпавшего с Upload-Checksum
+const statusChecksumMismatch = 460
+
+// Пределы загрузок
+type UploadLimits struct {
+	MaxSize    int64         // самый большой файл; 0 — загрузки выключены
+	UserQuota  int64         // байт с одного адреса клиента; 0 — без предела
+	TotalQuota int64         // байт на всех; 0 — без предела
+	Expire     time.Duration // через сколько удалять незаконченные загрузки
+}
+
+func DefaultUploadLimits() UploadLimits {
+	return UploadLimits{
+		UserQuota: 10 << 30,
+		Expire:    24 * time.Hour,
+	}
+}
+
+// Загрузки видео в медиатеку; нужна WithMediaLibrary
+func WithUploads(l UploadLimits) Option {
+	return func(s *Server) { s.uploadLimits = l }
+}
+
+// Загрузка: описание лежит рядом с недокачанным файлом в <медиатека>/.uploads
+type upload struct {
+	ID       string    `json:"id"`
+	Owner    string    `json:"owner"`
+	Client   string    `json:"client,omitempty"` // адрес создателя: по нему считается квота
+	Filename string    `json:"filename,omitempty"`
+	RoomName string    `json:"roomName,omitempty"`
+	Length   int64     `json:"length"`
+	Created  time.Time `json:"created"`
+	File     string    `json:"file,omitempty"`   // готовый файл в медиатеке
+	RoomID   string    `json:"roomId,omitempty"` // комната готового файла
+
+	mu     sync.Mutex // один PATCH за раз
+	offset int64
+}
+
+func (u *upload) done() bool { return u.File != "" }
+
+type uploads struct {
+	limits UploadLimits
+	dir    string
+
+	mu   sync.Mutex
+	list map[string]*upload
+}
+
+// Загрузки из каталога dir: незаконченные продолжаются с размера
+// их .part-файла, готовые без файла в медиатеке забываются
+func openUploads(dir, libDir string, limits UploadLimits) (*uploads, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	u := &uploads{limits: limits, dir: dir, list: make(map[string]*upload)}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		up := &upload{}
+		if err := json.Unmarshal(data, up); err != nil || up.ID == "" {
+			continue
+		}
+		if up.done() {
+			if _, err := os.Stat(filepath.Join(libDir, filepath.FromSlash(up.File))); err != nil {
+				u.remove(up)
+				continue
+			}
+			up.offset = up.Length
+		} else if info, err := os.Stat(u.part(up.ID)); err == nil {
+			up.offset = info.Size()
+		} else {
+			u.remove(up)
+			continue
+		}
+		u.list[up.ID] = up
+	}
+	return u, nil
+}
+
+func (u *uploads) part(id string) string { return filepath.Join(u.dir, id+".part") }
+func (u *uploads) meta(id string) string { return filepath.Join(u.dir, id+".json") }
+
+func (u *uploads) save(up *upload) error {
+	data, err := json.Marshal(up)
+	if err != nil {
+		return err
+	}
+	tmp := u.meta(up.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, u.meta(up.ID))
+}
+
+// Удаляет загрузку; готовый файл остаётся в медиатеке
+func (u *uploads) remove(up *upload) {
+	os.Remove(u.part(up.ID))
+	os.Remove(u.meta(up.ID))
+	u.mu.Lock()
+	delete(u.list, up.ID)
+	u.mu.Unlock()
+}
+
+func (u *uploads) get(id string) (*upload, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	up, ok := u.list[id]
+	return up, ok
+}
+
+// Когда незаконченная загрузка будет удалена
+func (u *uploads) expires(up *upload) time.Time {
+	return up.Created.Add(u.limits.Expire)
+}
+
+// Удаляет просроченные незаконченные загрузки
+func (u *uploads) expire() {
+	if u.limits.Expire <= 0 {
+		return
+	}
+	u.mu.Lock()
+	var stale []*upload
+	for _, up := range u.list {
+		if !up.done() && time.Now().After(u.expires(up)) {
+			stale = append(stale, up)
+		}
+	}
+	u.mu.Unlock()
+	for _, up := range stale {
+		u.remove(up)
+	}
+}
+
+// Резервирует место под новую загрузку; и готовые, и незаконченные
+// загрузки считаются по заявленной длине. Квоту пользователя считаем по
+// адресу клиента, а не по владельцу из метаданных: его клиент выбирает сам
+func (u *uploads) reserve(up *upload) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var user, total int64
+	for _, other := range u.list {
+		total += other.Length
+		if other.Client == up.Client {
+			user += other.Length
+		}
+	}
+	if q := u.limits.UserQuota; q > 0 && user+up.Length > q {
+		return fmt.Errorf("upload quota exceeded: %s of %s used", formatSize(user), formatSize(q))
+	}
+	if q := u.limits.TotalQuota; q > 0 && total+up.Length > q {
+		return errors.New("the server has no room for more uploads")
+	}
+	u.list[up.ID] = up
+	return nil
+}
+
+// Тип видео по первым байтам файла; пусто — не то, что играют браузеры
+func sniffVideo(head []byte) string {
+	switch {
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		// QuickTime браузеры, как и ссылки на .mov, не играют
+		if string(head[8:12]) == "qt  " {
+			return ""
+		}
+		return "video/mp4"
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		// EBML: WebM или Matroska, различаются по DocType
+		if bytes.Contains(head, []byte("webm")) {
+			return "video/webm"
+		}
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return "video/ogg"
+	}
+	return ""
+}
+
+// Сколько байт нужно для sniffVideo
+const sniffLen = 64
+
+var uploadExts = map[string]string{
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+	"video/ogg":  ".ogv",
+}
+
+// Имя файла из метаданных, пригодное для диска: "My movie!.MKV" -> "My_movie_"
+func safeFilename(name string) string {
+	name = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	var b strings.Builder
+	for _, r := range name {
+		if b.Len() >= 64 {
+			break
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	if s := strings.Trim(b.String(), "."); s != "" {
+		return s
+	}
+	return "video"
+}
+
+// Upload-Metadata: "filename bW92aWUubXA0,owner Ym9i"
+func parseUploadMetadata(h string) map[string]string {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(h, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		meta[key] = string(decoded)
+	}
+	return meta
+}
+
+// Upload-Checksum: "sha256 <base64>"
+func parseUploadChecksum(h string) (hash.Hash, []byte, error) {
+	algo, sum, ok := strings.Cut(strings.TrimSpace(h), " ")
+	if !ok {
+		return nil, nil, errors.New("invalid Upload-Checksum")
+	}
+	want, err := base64.StdEncoding.DecodeString(sum)
+	if err != nil {
+		return nil, nil, errors.New("invalid Upload-Checksum")
+	}
+	switch algo {
+	case "sha1":
+		return sha1.New(), want, nil
+	case "sha256":
+		return sha256.New(), want, nil
+	case "md5":
+		return md5.New(), want, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported checksum algorithm %q", algo)
+}
+
+// Общие заголовки ответов tus; false — клиент говорит на другой версии
+func (s *Server) tusHeaders(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Method != http.MethodOptions && r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		writeError(w, http.StatusPreconditionFailed, "unsupported tus version")
+		return false
+	}
+	return true
+}
+
+func (s *Server) uploadPath(id string) string {
+	return s.path("/api/uploads/" + id)
+}
+
+func (s *Server) uploadHeaders(w http.ResponseWriter, up *upload) {
+	h := w.Header()
+	h.Set("Upload-Offset", strconv.FormatInt(up.offset, 10))
+	h.Set("Upload-Length", strconv.FormatInt(up.Length, 10))
+	h.Set("Cache-Control", "no-store")
+	if up.RoomID != "" {
+		h.Set("Upload-Room", up.RoomID)
+	} else if !up.done() && s.uploads.limits.Expire > 0 {
+		h.Set("Upload-Expires", s.uploads.expires(up).UTC().Format(http.TimeFormat))
+	}
+}
+
+// Возможности сервера загрузок
+func (s *Server) uploadOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.uploads == nil {
+		writeError(w, http.StatusNotFound, "uploads are disabled")
+		return
+	}
+	s.tusHeaders(w, r)
+	h := w.Header()
+	h.Set("Tus-Version", tusVersion)
+	h.Set("Tus-Extension", "creation,expiration,checksum,termination")
+	h.Set("Tus-Max-Size", strconv.FormatInt(s.uploads.limits.MaxSize, 10))
+	h.Set("Tus-Checksum-Algorithm", "md5,sha1,sha256")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Создание загрузки
+func (s *Server) createUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if s.uploads == nil {
+		writeError(w, http.StatusNotFound, "uploads are disabled")
+		return
+	}
+	if !s.tusHeaders(w, r) || !s.authorize(w, r, ActionUpload, "") || !s.allowCreate(w, r) {
+		return
+	}
+	if s.draining.Load() {
+		writeError(w, http.StatusServiceUnavailable, ErrShuttingDown.Error())
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		writeError(w, http.StatusBadRequest, "Upload-Length must be a positive number (deferred length is not supported)")
+		return
+	}
+	if length > s.uploads.limits.MaxSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "files larger than "+formatSize(s.uploads.limits.MaxSize)+" can't be uploaded")
+		return
+	}
+	meta := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if meta["owner"] == "" {
+		writeError(w, http.StatusBadRequest, "owner metadata is required")
+		return
+	}
+
+	s.uploads.expire()
+	b := make([]byte, 16)
+	rand.Read(b)
+	up := &upload{
+		ID:       base64.RawURLEncoding.EncodeToString(b),
+		Owner:    meta["owner"],
+		Client:   s.clientIP(r),
+		Filename: meta["filename"],
+		RoomName: meta["roomName"],
+		Length:   length,
+		Created:  time.Now(),
+	}
+	if err := s.uploads.reserve(up); err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	f, err := os.OpenFile(s.uploads.part(up.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err == nil {
+		f.Close()
+		err = s.uploads.save(up)
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "creating upload failed", "err", err)
+		s.uploads.remove(up)
+		writeError(w, http.StatusInternalServerError, "could not create upload")
+		return
+	}
+
+	s.logger.InfoContext(r.Context(), "upload created", "upload_id", up.ID, "user", up.Owner, "client", up.Client, "size", up.Length)
+	s.uploadHeaders(w, up)
+	w.Header().Set("Location", s.uploadPath(up.ID))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Сколько уже принято
+func (s *Server) uploadStatusHandler(w http.ResponseWriter, r *http.Request) {
+	up, ok := s.uploadFor(w, r)
+	if !ok {
+		return
+	}
+	up.mu.Lock()
+	s.uploadHeaders(w, up)
+	up.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+// Загрузка из пути запроса; false — ответ уже отправлен
+func (s *Server) uploadFor(w http.ResponseWriter, r *http.Request) (*upload, bool) {
+	if s.uploads == nil {
+		writeError(w, http.StatusNotFound, "uploads are disabled")
+		return nil, false
+	}
+	if !s.tusHeaders(w, r) || !s.authorize(w, r, ActionUpload, "") {
+		return nil, false
+	}
+	up, ok := s.uploads.get(r.PathValue("uploadID"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "upload not found")
+		return nil, false
+	}
+	return up, true
+}
+
+// Очередной кусок файла
+func (s *Server) patchUploadHandler(w http.ResponseWriter, r *http.Request) {
+	up, ok := s.uploadFor(w, r)
+	if !ok {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream")
+		return
+	}
+	if !up.mu.TryLock() {
+		writeError(w, http.StatusConflict, "another request is writing to this upload")
+		return
+	}
+	defer up.mu.Unlock()
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != up.offset {
+		s.uploadHeaders(w, up)
+		writeError(w, http.StatusConflict, "Upload-Offset does not match the uploaded size")
+		return
+	}
+	if up.done() {
+		s.uploadHeaders(w, up)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var sum hash.Hash
+	var want []byte
+	if h := r.Header.Get("Upload-Checksum"); h != "" {
+		if sum, want, err = parseUploadChecksum(h); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// Кусок может идти дольше ReadTimeout и WriteTimeout сервера
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Now().Add(uploadChunkTimeout))
+	rc.SetWriteDeadline(time.Now().Add(uploadChunkTimeout))
+
+	f, err := os.OpenFile(s.uploads.part(up.ID), os.O_RDWR, 0)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "opening upload failed", "upload_id", up.ID, "err", err)
+		writeError(w, http.StatusInternalServerError, "could not write upload")
+		return
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		writeError(w, http.StatusInternalServerError, "could not write upload")
+		return
+	}
+
+	var dst io.Writer = f
+	if sum != nil {
+		dst = io.MultiWriter(f, sum)
+	}
+	remaining := up.Length - offset
+	n, copyErr := io.Copy(dst, io.LimitReader(r.Body, remaining+1))
+
+	// Лишнее, непроверенное или битое не сохраняем
+	rollback := func(status int, msg string) {
+		f.Truncate(offset)
+		writeError(w, status, msg)
+	}
+	switch {
+	case n > remaining:
+		rollback(http.StatusRequestEntityTooLarge, "chunk goes past Upload-Length")
+		return
+	case sum != nil && copyErr != nil:
+		rollback(http.StatusBadRequest, "chunk was interrupted and can't be verified")
+		return
+	case sum != nil && !bytes.Equal(sum.Sum(nil), want):
+		s.logger.WarnContext(r.Context(), "upload checksum mismatch", "upload_id", up.ID, "offset", offset)
+		rollback(statusChecksumMismatch, "checksum mismatch")
+		return
+	}
+	// Оборванный кусок без контрольной суммы засчитываем: клиент
+	// продолжит с того, что дошло
+	up.offset = offset + n
+
+	// Не видео — отказываем, как только пришло достаточно байт
+	if offset < sniffLen && (up.offset >= sniffLen || up.offset == up.Length) {
+		head := make([]byte, sniffLen)
+		hn, _ := f.ReadAt(head, 0)
+		if sniffVideo(head[:hn]) == "" {
+			f.Close()
+			s.uploads.remove(up)
+			writeError(w, http.StatusUnsupportedMediaType, "only MP4, WebM and Ogg videos can be uploaded")
+			return
+		}
+	}
+
+	if up.offset == up.Length {
+		f.Close()
+		if err := s.finishUpload(w, r, up); err != nil {
+			var mediaErr *MediaError
+			if errors.As(err, &mediaErr) {
+				s.uploads.remove(up)
+				writeError(w, http.StatusUnsupportedMediaType, mediaErr.Error())
+				return
+			}
+			s.logger.ErrorContext(r.Context(), "finishing upload failed", "upload_id", up.ID, "err", err)
+			writeError(w, http.StatusInternalServerError, "could not save the uploaded file")
+			return
+		}
+	}
+	if copyErr != nil {
+		return
+	}
+	s.uploadHeaders(w, up)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Готовый файл переезжает в медиатеку, для него создаётся комната
+func (s *Server) finishUpload(w http.ResponseWriter, r *http.Request, up *upload) error {
+	head := make([]byte, sniffLen)
+	f, err := os.Open(s.uploads.part(up.ID))
+	if err != nil {
+		return err
+	}
+	n, _ := io.ReadFull(f, head)
+	f.Close()
+	typ := sniffVideo(head[:n])
+
+	// Файл с кодеком, который браузеры не играют, в медиатеку не берём
+	if info, err := mediainfo.ProbeFile(s.uploads.part(up.ID)); err == nil {
+		if err := checkCodecs(up.Filename, info.Codecs()); err != nil {
+			return err
+		}
+	}
+
+	dir := filepath.Join(s.library.dir, "uploads")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	name := up.ID[:8] + "-" + safeFilename(up.Filename) + uploadExts[typ]
+	dest := filepath.Join(dir, name)
+	if err := os.Rename(s.uploads.part(up.ID), dest); err != nil {
+		return err
+	}
+	item, err := s.library.add(dest, typ)
+	if err != nil {
+		return err
+	}
+	up.File = item.Name
+
+	token, key := NewOwnerToken()
+	room, err := s.createRoom(r.Context(), store.Room{
+		MediaID:  item.ID,
+		Name:     up.RoomName,
+		Owner:    up.Owner,
+		OwnerKey: key,
+	})
+	if err != nil {
+		// Файл уже в медиатеке; комнату можно создать из неё
+		s.logger.WarnContext(r.Context(), "creating room for upload failed", "upload_id", up.ID, "err", err)
+	} else {
+		up.RoomID = room.ID
+		s.giveOwnerToken(w, r, room.ID, token)
+	}
+	s.logger.InfoContext(r.Context(), "upload finished", "upload_id", up.ID, "media_id", item.ID, "room_id", up.RoomID)
+	return s.uploads.save(up)
+}
+
+// Отмена загрузки; готовый файл остаётся в медиатеке
+func (s *Server) deleteUploadHandler(w http.ResponseWriter, r *http.Request) {
+	up, ok := s.uploadFor(w, r)
+	if !ok {
+		return
+	}
+	if !up.mu.TryLock() {
+		writeError(w, http.StatusConflict, "another request is writing to this upload")
+		return
+	}
+	defer up.mu.Unlock()
+	// Готовый файл остаётся в медиатеке, и его запись держит квоту
+	if up.done() {
+		writeError(w, http.StatusConflict, "the upload is finished; its file stays in the media library")
+		return
+	}
+	s.uploads.remove(up)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Видео, распознанное провайдером
+type Video struct {
+	Provider string        // имя провайдера, например "youtube"
+	URL      string        // исходная ссылка
+	ID       string        // канонический ID у провайдера; у файлов — сама ссылка
+	Kind     string        // вид ролика у провайдера: "video", "live", "clip"
+	Hash     string        // дополнительный ключ доступа (приватные ролики Vimeo)
+	Start    time.Duration // с какого места начинать
+}
+
+// Что умеет плеер провайдера для этого ролика
+type VideoCaps struct {
+	Seekable bool `json:"seekable"` // можно перематывать
+	Live     bool `json:"live"`     // прямой эфир
+}
+
+// Как показать видео на странице комнаты
+type VideoEmbed struct {
+	Kind      string // "iframe", "video", "stream" (HLS/DASH) или "link"
+	Provider  string
+	URL       string // исходная ссылка
+	EmbedURL  string // адрес iframe или файла
+	MIME      string // тип файла для <source>
+	Sources   []VideoSource
+	Poster    string
+	Player    string // адаптер плеера в room.js: youtube, vimeo, html5, hls, dash; пусто — без управления
+	Stream    *StreamInfo
+	Caps      VideoCaps
+	Subtitles Subtitles // дорожки <track>; только у файлов и потоков в <video>
+}
+
+// Параметры встраивания, зависящие от запроса
+type EmbedOptions struct {
+	Host   string // домен страницы без порта; Twitch требует его в parent
+	Origin string // origin страницы, например "https://example.com"; для postMessage
+}
+
+// Провайдер видео: распознаёт ссылки своего сервиса и встраивает плеер
+type VideoProvider interface {
+	Name() string
+	// Match отвечает, похожа ли ссылка на ссылку этого сервиса
+	Match(u *url.URL) bool
+	// Parse достаёт канонический ID и время начала
+	Parse(u *url.URL) (Video, error)
+	Embed(v Video, opts EmbedOptions) VideoEmbed
+	Caps(v Video) VideoCaps
+	// Источники iframe для frame-src в CSP
+	FrameSources() []string
+}
+
+var errNoVideoID = errors.New("video: no video id in url")
+
+// Реестр провайдеров; проверяются по порядку
+type VideoProviders []VideoProvider
+
+func DefaultVideoProviders() VideoProviders {
+	return VideoProviders{YouTube{}, Vimeo{}, Dailymotion{}, Twitch{}, HLS{}, DASH{}, VideoFile{}}
+}
+
+// Провайдеры видео вместо DefaultVideoProviders
+func WithVideoProviders(providers ...VideoProvider) Option {
+	return func(s *Server) { s.videos = VideoProviders(providers) }
+}
+
+// Resolve находит провайдера ссылки; nil — ссылка не распознана
+func (ps VideoProviders) Resolve(raw string) (Video, VideoProvider) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Video{URL: raw}, nil
+	}
+	for _, p := range ps {
+		if !p.Match(u) {
+			continue
+		}
+		v, err := p.Parse(u)
+		if err != nil {
+			continue
+		}
+		v.Provider = p.Name()
+		v.URL = raw
+		return v, p
+	}
+	return Video{URL: raw}, nil
+}
+
+// Встраивание ссылки; нераспознанные открываются в новой вкладке
+func (ps VideoProviders) Embed(raw string, opts EmbedOptions) VideoEmbed {
+	v, p := ps.Resolve(raw)
+	if p == nil {
+		return VideoEmbed{Kind: "link", URL: raw}
+	}
+	e := p.Embed(v, opts)
+	e.Provider = v.Provider
+	e.URL = raw
+	e.Caps = p.Caps(v)
+	return e
+}
+
+// Все источники iframe провайдеров без повторов
+func (ps VideoProviders) FrameSources() []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, p := range ps {
+		for _, src := range p.FrameSources() {
+			if !seen[src] {
+				seen[src] = true
+				out = append(out, src)
+			}
+		}
+	}
+	return out
+}
+
+// Хост без "www." и "m." в нижнем регистре
+func videoHost(u *url.URL) string {
+	h := strings.ToLower(u.Hostname())
+	h = strings.TrimPrefix(h, "www.")
+	return strings.TrimPrefix(h, "m.")
+}
+
+// Непустые сегменты пути
+func pathSegments(u *url.URL) []string {
+	var segs []string
+	for _, s := range strings.Split(path.Clean("/"+u.Path), "/") {
+		if s != "" {
+			segs = append(segs, s)
+		}
+	}
+	return segs
+}
+
+// Время начала: "90", "90s", "1m30s", "1h2m3s" или "01:30"
+func parseStart(s string) time.Duration {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if s == "" {
+		return 0
+	}
+	if strings.Contains(s, ":") {
+		var total time.Duration
+		for _, part := range strings.Split(s, ":") {
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 0 {
+				return 0
+			}
+			total = total*60 + time.Duration(n)*time.Second
+		}
+		return total
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d.Truncate(time.Second)
+}
+
+// Время в виде "1h2m3s" для Twitch и Vimeo
+func formatStart(d time.Duration) string {
+	secs := int64(d / time.Second)
+	var b strings.Builder
+	if h := secs / 3600; h > 0 {
+		b.WriteString(strconv.FormatInt(h, 10) + "h")
+	}
+	if m := secs / 60 % 60; m > 0 {
+		b.WriteString(strconv.FormatInt(m, 10) + "m")
+	}
+	if sec := secs % 60; sec > 0 || b.Len() == 0 {
+		b.WriteString(strconv.FormatInt(sec, 10) + "s")
+	}
+	return b.String()
+}
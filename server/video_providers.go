@@ -0,0 +1,386 @@
+package server
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// YouTube: watch?v=, youtu.be, /shorts/, /embed/, /live/ и /v/
+type YouTube struct{}
+
+var youTubeID = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+func (YouTube) Name() string { return "youtube" }
+
+func (YouTube) Match(u *url.URL) bool {
+	switch videoHost(u) {
+	case "youtube.com", "music.youtube.com", "youtube-nocookie.com", "youtu.be":
+		return true
+	}
+	return false
+}
+
+func (YouTube) Parse(u *url.URL) (Video, error) {
+	q := u.Query()
+	segs := pathSegments(u)
+	v := Video{Kind: "video"}
+
+	switch {
+	case videoHost(u) == "youtu.be" && len(segs) > 0:
+		v.ID = segs[0]
+	case len(segs) == 1 && segs[0] == "watch":
+		v.ID = q.Get("v")
+	case len(segs) >= 2 && (segs[0] == "shorts" || segs[0] == "embed" || segs[0] == "v"):
+		v.ID = segs[1]
+	case len(segs) >= 2 && segs[0] == "live":
+		v.ID = segs[1]
+		v.Kind = "live"
+	}
+	if !youTubeID.MatchString(v.ID) {
+		return Video{}, errNoVideoID
+	}
+
+	if t := q.Get("t"); t != "" {
+		v.Start = parseStart(t)
+	} else {
+		v.Start = parseStart(q.Get("start"))
+	}
+	return v, nil
+}
+
+func (YouTube) Embed(v Video, opts EmbedOptions) VideoEmbed {
+	// enablejsapi и origin нужны, чтобы плеер принимал команды и присылал события
+	q := url.Values{"enablejsapi": {"1"}, "rel": {"0"}}
+	if opts.Origin != "" {
+		q.Set("origin", opts.Origin)
+	}
+	if v.Start > 0 {
+		q.Set("start", strconv.Itoa(int(v.Start.Seconds())))
+	}
+	return VideoEmbed{
+		Kind:     "iframe",
+		EmbedURL: "https://www.youtube.com/embed/" + url.PathEscape(v.ID) + "?" + q.Encode(),
+		Player:   "youtube",
+	}
+}
+
+func (YouTube) Caps(v Video) VideoCaps {
+	return VideoCaps{Seekable: true, Live: v.Kind == "live"}
+}
+
+func (YouTube) FrameSources() []string {
+	return []string{"https://www.youtube.com", "https://www.youtube-nocookie.com"}
+}
+
+// Vimeo: vimeo.com/ID[/HASH], каналы, группы, player.vimeo.com и события
+type Vimeo struct{}
+
+var vimeoID = regexp.MustCompile(`^[0-9]+$`)
+
+func (Vimeo) Name() string { return "vimeo" }
+
+func (Vimeo) Match(u *url.URL) bool {
+	h := videoHost(u)
+	return h == "vimeo.com" || h == "player.vimeo.com"
+}
+
+func (Vimeo) Parse(u *url.URL) (Video, error) {
+	segs := pathSegments(u)
+	v := Video{Kind: "video", Hash: u.Query().Get("h")}
+
+	// Первый числовой сегмент — ID, следующий за ним (если есть) — ключ доступа
+	for i, s := range segs {
+		if !vimeoID.MatchString(s) {
+			continue
+		}
+		v.ID = s
+		if i > 0 && segs[i-1] == "event" {
+			v.Kind = "live"
+		} else if i+1 < len(segs) && v.Hash == "" && segs[i+1] != "embed" {
+			v.Hash = segs[i+1]
+		}
+		break
+	}
+	if v.ID == "" {
+		return Video{}, errNoVideoID
+	}
+
+	// Время в фрагменте: #t=90s или #t=1m30s
+	if t, ok := strings.CutPrefix(u.Fragment, "t="); ok {
+		v.Start = parseStart(t)
+	}
+	return v, nil
+}
+
+func (Vimeo) Embed(v Video, _ EmbedOptions) VideoEmbed {
+	if v.Kind == "live" {
+		return VideoEmbed{Kind: "iframe", EmbedURL: "https://vimeo.com/event/" + v.ID + "/embed"}
+	}
+	q := url.Values{"api": {"1"}}
+	if v.Hash != "" {
+		q.Set("h", v.Hash)
+	}
+	embed := "https://player.vimeo.com/video/" + v.ID + "?" + q.Encode()
+	if v.Start > 0 {
+		embed += "#t=" + formatStart(v.Start)
+	}
+	return VideoEmbed{Kind: "iframe", EmbedURL: embed, Player: "vimeo"}
+}
+
+func (Vimeo) Caps(v Video) VideoCaps {
+	live := v.Kind == "live"
+	return VideoCaps{Seekable: !live, Live: live}
+}
+
+func (Vimeo) FrameSources() []string {
+	return []string{"https://player.vimeo.com", "https://vimeo.com"}
+}
+
+// Dailymotion: dailymotion.com/video/ID, dai.ly/ID и geo-плеер
+type Dailymotion struct{}
+
+var dailymotionID = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+func (Dailymotion) Name() string { return "dailymotion" }
+
+func (Dailymotion) Match(u *url.URL) bool {
+	switch videoHost(u) {
+	case "dailymotion.com", "geo.dailymotion.com", "dai.ly":
+		return true
+	}
+	return false
+}
+
+func (Dailymotion) Parse(u *url.URL) (Video, error) {
+	q := u.Query()
+	segs := pathSegments(u)
+	v := Video{Kind: "video"}
+
+	switch {
+	case videoHost(u) == "dai.ly" && len(segs) > 0:
+		v.ID = segs[0]
+	case videoHost(u) == "geo.dailymotion.com":
+		v.ID = q.Get("video")
+	case len(segs) >= 2 && segs[0] == "video":
+		v.ID = segs[1]
+	case len(segs) >= 3 && segs[0] == "embed" && segs[1] == "video":
+		v.ID = segs[2]
+	}
+	// Старые ссылки: /video/x7tgad0_title-of-the-video
+	v.ID, _, _ = strings.Cut(v.ID, "_")
+	if !dailymotionID.MatchString(v.ID) {
+		return Video{}, errNoVideoID
+	}
+	v.Start = parseStart(q.Get("start"))
+	return v, nil
+}
+
+func (Dailymotion) Embed(v Video, _ EmbedOptions) VideoEmbed {
+	embed := "https://www.dailymotion.com/embed/video/" + v.ID
+	if v.Start > 0 {
+		embed += "?start=" + strconv.Itoa(int(v.Start.Seconds()))
+	}
+	return VideoEmbed{Kind: "iframe", EmbedURL: embed}
+}
+
+func (Dailymotion) Caps(Video) VideoCaps {
+	return VideoCaps{Seekable: true}
+}
+
+func (Dailymotion) FrameSources() []string {
+	return []string{"https://www.dailymotion.com", "https://geo.dailymotion.com"}
+}
+
+// Twitch: записи (/videos/ID), клипы и прямые эфиры каналов
+type Twitch struct{}
+
+var (
+	twitchVideoID = regexp.MustCompile(`^[0-9]+$`)
+	twitchName    = regexp.MustCompile(`^[A-Za-z0-9_]{3,25}$`)
+	twitchClip    = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// Пути twitch.tv, которые не являются каналами
+var twitchReserved = map[string]bool{
+	"directory": true, "downloads": true, "jobs": true, "p": true, "search": true,
+	"settings": true, "subscriptions": true, "turbo": true, "videos": true, "inventory": true,
+}
+
+func (Twitch) Name() string { return "twitch" }
+
+func (Twitch) Match(u *url.URL) bool {
+	switch videoHost(u) {
+	case "twitch.tv", "clips.twitch.tv", "player.twitch.tv":
+		return true
+	}
+	return false
+}
+
+func (Twitch) Parse(u *url.URL) (Video, error) {
+	q := u.Query()
+	segs := pathSegments(u)
+	var v Video
+
+	switch {
+	case videoHost(u) == "clips.twitch.tv" && len(segs) > 0 && segs[0] != "embed":
+		v = Video{Kind: "clip", ID: segs[0]}
+	case videoHost(u) == "clips.twitch.tv":
+		v = Video{Kind: "clip", ID: q.Get("clip")}
+	case videoHost(u) == "player.twitch.tv" && q.Get("video") != "":
+		v = Video{Kind: "video", ID: strings.TrimPrefix(q.Get("video"), "v")}
+	case videoHost(u) == "player.twitch.tv":
+		v = Video{Kind: "live", ID: q.Get("channel")}
+	case len(segs) >= 2 && segs[0] == "videos":
+		v = Video{Kind: "video", ID: segs[1]}
+	case len(segs) >= 3 && segs[1] == "clip":
+		v = Video{Kind: "clip", ID: segs[2]}
+	case len(segs) == 1 && !twitchReserved[strings.ToLower(segs[0])]:
+		v = Video{Kind: "live", ID: strings.ToLower(segs[0])}
+	}
+
+	var valid bool
+	switch v.Kind {
+	case "video":
+		valid = twitchVideoID.MatchString(v.ID)
+	case "clip":
+		valid = twitchClip.MatchString(v.ID)
+	case "live":
+		valid = twitchName.MatchString(v.ID)
+	}
+	if !valid {
+		return Video{}, errNoVideoID
+	}
+	if v.Kind == "video" {
+		v.Start = parseStart(q.Get("t"))
+	}
+	return v, nil
+}
+
+func (Twitch) Embed(v Video, opts EmbedOptions) VideoEmbed {
+	q := url.Values{"parent": {opts.Host}, "autoplay": {"false"}}
+	embed := "https://player.twitch.tv/?"
+	switch v.Kind {
+	case "clip":
+		q.Set("clip", v.ID)
+		embed = "https://clips.twitch.tv/embed?"
+	case "live":
+		q.Set("channel", v.ID)
+	default:
+		q.Set("video", "v"+v.ID)
+		if v.Start > 0 {
+			q.Set("time", formatStart(v.Start))
+		}
+	}
+	return VideoEmbed{Kind: "iframe", EmbedURL: embed + q.Encode()}
+}
+
+func (Twitch) Caps(v Video) VideoCaps {
+	live := v.Kind == "live"
+	return VideoCaps{Seekable: !live, Live: live}
+}
+
+func (Twitch) FrameSources() []string {
+	return []string{"https://player.twitch.tv", "https://clips.twitch.tv"}
+}
+
+// Потоки HLS (.m3u8) и DASH (.mpd). Играются в <video> через встроенный
+// проигрыватель static/js/stream.js; эфир или запись — узнаём из манифеста.
+type HLS struct{}
+
+func (HLS) Name() string { return "hls" }
+
+func (HLS) Match(u *url.URL) bool {
+	return strings.ToLower(path.Ext(u.Path)) == ".m3u8"
+}
+
+func (HLS) Parse(u *url.URL) (Video, error) { return parseStream(u) }
+
+func (HLS) Embed(v Video, _ EmbedOptions) VideoEmbed {
+	return VideoEmbed{Kind: "stream", EmbedURL: v.ID, MIME: "application/vnd.apple.mpegurl", Player: "hls"}
+}
+
+func (HLS) Caps(Video) VideoCaps {
+	return VideoCaps{Seekable: true}
+}
+
+func (HLS) FrameSources() []string { return nil }
+
+type DASH struct{}
+
+func (DASH) Name() string { return "dash" }
+
+func (DASH) Match(u *url.URL) bool {
+	return strings.ToLower(path.Ext(u.Path)) == ".mpd"
+}
+
+func (DASH) Parse(u *url.URL) (Video, error) { return parseStream(u) }
+
+func (DASH) Embed(v Video, _ EmbedOptions) VideoEmbed {
+	return VideoEmbed{Kind: "stream", EmbedURL: v.ID, MIME: "application/dash+xml", Player: "dash"}
+}
+
+func (DASH) Caps(Video) VideoCaps {
+	return VideoCaps{Seekable: true}
+}
+
+func (DASH) FrameSources() []string { return nil }
+
+// Манифест целиком, без фрагмента: query часто несёт токен доступа
+func parseStream(u *url.URL) (Video, error) {
+	manifest := *u
+	manifest.Fragment = ""
+	return Video{Kind: "video", ID: manifest.String()}, nil
+}
+
+// Прямые ссылки на файлы, которые браузер умеет играть в <video>
+type VideoFile struct{}
+
+var videoFileTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".webm": "video/webm",
+	".ogv":  "video/ogg",
+	".ogg":  "video/ogg",
+}
+
+func (VideoFile) Name() string { return "file" }
+
+func (VideoFile) Match(u *url.URL) bool {
+	_, ok := videoFileTypes[strings.ToLower(path.Ext(u.Path))]
+	return ok
+}
+
+func (VideoFile) Parse(u *url.URL) (Video, error) {
+	file := *u
+	file.Fragment = ""
+	v := Video{Kind: "video", ID: file.String()}
+	// Media fragment: #t=90 или #t=90,120
+	if t, ok := strings.CutPrefix(u.Fragment, "t="); ok {
+		t, _, _ = strings.Cut(t, ",")
+		v.Start = parseStart(t)
+	}
+	return v, nil
+}
+
+func (VideoFile) Embed(v Video, _ EmbedOptions) VideoEmbed {
+	u, _ := url.Parse(v.ID)
+	embed := v.ID
+	if v.Start > 0 && u != nil {
+		u.Fragment = "t=" + strconv.Itoa(int(v.Start.Seconds()))
+		embed = u.String()
+	}
+	var mime string
+	if u != nil {
+		mime = videoFileTypes[strings.ToLower(path.Ext(u.Path))]
+	}
+	return VideoEmbed{Kind: "video", EmbedURL: embed, MIME: mime, Player: "html5"}
+}
+
+func (VideoFile) Caps(Video) VideoCaps {
+	return VideoCaps{Seekable: true}
+}
+
+func (VideoFile) FrameSources() []string { return nil }
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveVideoURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		provider string // пусто — ссылка не распознана
+		id       string
+		kind     string
+		hash     string
+		start    time.Duration
+	}{
+		// YouTube
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "youtube", "dQw4w9WgXcQ", "video", "", 0},
+		{"https://m.youtube.com/watch?v=dQw4w9WgXcQ&t=1m30s", "youtube", "dQw4w9WgXcQ", "video", "", 90 * time.Second},
+		{"https://music.youtube.com/watch?v=dQw4w9WgXcQ&list=RD", "youtube", "dQw4w9WgXcQ", "video", "", 0},
+		{"https://youtu.be/dQw4w9WgXcQ?t=42", "youtube", "dQw4w9WgXcQ", "video", "", 42 * time.Second},
+		{"https://YOUTU.BE/dQw4w9WgXcQ", "youtube", "dQw4w9WgXcQ", "video", "", 0},
+		{"https://www.youtube.com/shorts/dQw4w9WgXcQ", "youtube", "dQw4w9WgXcQ", "video", "", 0},
+		{"https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ?start=10", "youtube", "dQw4w9WgXcQ", "video", "", 10 * time.Second},
+		{"https://www.youtube.com/v/dQw4w9WgXcQ", "youtube", "dQw4w9WgXcQ", "video", "", 0},
+		{"https://www.youtube.com/live/dQw4w9WgXcQ", "youtube", "dQw4w9WgXcQ", "live", "", 0},
+		{"https://www.youtube.com/watch?v=short", "", "", "", "", 0},
+		{"https://www.youtube.com/channel/UC123", "", "", "", "", 0},
+
+		// Vimeo
+		{"https://vimeo.com/76979871", "vimeo", "76979871", "video", "", 0},
+		{"https://vimeo.com/76979871/abc123def", "vimeo", "76979871", "video", "abc123def", 0},
+		{"https://vimeo.com/76979871#t=1m5s", "vimeo", "76979871", "video", "", 65 * time.Second},
+		{"https://vimeo.com/channels/staffpicks/76979871", "vimeo", "76979871", "video", "", 0},
+		{"https://vimeo.com/groups/name/videos/76979871", "vimeo", "76979871", "video", "", 0},
+		{"https://player.vimeo.com/video/76979871?h=abc123", "vimeo", "76979871", "video", "abc123", 0},
+		{"https://vimeo.com/event/12345", "vimeo", "12345", "live", "", 0},
+		{"https://vimeo.com/event/12345/embed", "vimeo", "12345", "live", "", 0},
+		{"https://vimeo.com/about", "", "", "", "", 0},
+
+		// Dailymotion
+		{"https://www.dailymotion.com/video/x7tgad0", "dailymotion", "x7tgad0", "video", "", 0},
+		{"https://www.dailymotion.com/video/x7tgad0_title-of-the-video", "dailymotion", "x7tgad0", "video", "", 0},
+		{"https://www.dailymotion.com/embed/video/x7tgad0?start=30", "dailymotion", "x7tgad0", "video", "", 30 * time.Second},
+		{"https://dai.ly/x7tgad0", "dailymotion", "x7tgad0", "video", "", 0},
+		{"https://geo.dailymotion.com/player.html?video=x7tgad0", "dailymotion", "x7tgad0", "video", "", 0},
+		{"https://www.dailymotion.com/user/someone", "", "", "", "", 0},
+
+		// Twitch
+		{"https://www.twitch.tv/videos/123456789?t=1h2m3s", "twitch", "123456789", "video", "", time.Hour + 2*time.Minute + 3*time.Second},
+		{"https://www.twitch.tv/SomeChannel", "twitch", "somechannel", "live", "", 0},
+		{"https://m.twitch.tv/somechannel", "twitch", "somechannel", "live", "", 0},
+		{"https://www.twitch.tv/somechannel/clip/FunnyClip-abc_1", "twitch", "FunnyClip-abc_1", "clip", "", 0},
+		{"https://clips.twitch.tv/FunnyClip", "twitch", "FunnyClip", "clip", "", 0},
+		{"https://clips.twitch.tv/embed?clip=FunnyClip", "twitch", "FunnyClip", "clip", "", 0},
+		{"https://player.twitch.tv/?video=v123456789", "twitch", "123456789", "video", "", 0},
+		{"https://player.twitch.tv/?channel=somechannel", "twitch", "somechannel", "live", "", 0},
+		{"https://www.twitch.tv/directory", "", "", "", "", 0},
+		{"https://www.twitch.tv/ab", "", "", "", "", 0},
+
+		// Потоки и файлы
+		{"https://cdn.example.com/live/index.m3u8?token=x#frag", "hls", "https://cdn.example.com/live/index.m3u8?token=x", "video", "", 0},
+		{"https://cdn.example.com/show/manifest.MPD", "dash", "https://cdn.example.com/show/manifest.MPD", "video", "", 0},
+		{"https://cdn.example.com/movie.mp4#t=90,120", "file", "https://cdn.example.com/movie.mp4", "video", "", 90 * time.Second},
+		{"https://cdn.example.com/clip.WEBM", "file", "https://cdn.example.com/clip.WEBM", "video", "", 0},
+
+		// Не ссылки на видео
+		{"https://example.com/page.html", "", "", "", "", 0},
+		{"https://cdn.example.com/clip.mov", "", "", "", "", 0}, // QuickTime браузеры не играют
+		{"ftp://cdn.example.com/movie.mp4", "", "", "", "", 0},
+		{"javascript:alert(1)//.mp4", "", "", "", "", 0},
+		{"/movie.mp4", "", "", "", "", 0},
+		{"not a url", "", "", "", "", 0},
+	}
+	providers := DefaultVideoProviders()
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			v, p := providers.Resolve(tt.url)
+			if tt.provider == "" {
+				if p != nil {
+					t.Fatalf("resolved by %s as %+v", p.Name(), v)
+				}
+				return
+			}
+			if p == nil {
+				t.Fatal("not resolved")
+			}
+			if v.Provider != tt.provider || v.ID != tt.id || v.Kind != tt.kind || v.Hash != tt.hash || v.Start != tt.start {
+				t.Errorf("got %s %q kind %q hash %q start %v", v.Provider, v.ID, v.Kind, v.Hash, v.Start)
+			}
+		})
+	}
+}
+
+func TestEmbedVideoURL(t *testing.T) {
+	opts := EmbedOptions{Host: "party.example.com", Origin: "https://party.example.com"}
+	tests := []struct {
+		url, kind, embed string
+		caps             VideoCaps
+	}{
+		{"https://youtu.be/dQw4w9WgXcQ?t=42", "iframe",
+			"https://www.youtube.com/embed/dQw4w9WgXcQ?enablejsapi=1&origin=https%3A%2F%2Fparty.example.com&rel=0&start=42",
+			VideoCaps{Seekable: true}},
+		{"https://vimeo.com/76979871/abc123def#t=65", "iframe",
+			"https://player.vimeo.com/video/76979871?api=1&h=abc123def#t=1m5s",
+			VideoCaps{Seekable: true}},
+		{"https://vimeo.com/event/12345", "iframe", "https://vimeo.com/event/12345/embed",
+			VideoCaps{Live: true}},
+		{"https://dai.ly/x7tgad0?start=30", "iframe", "https://www.dailymotion.com/embed/video/x7tgad0?start=30",
+			VideoCaps{Seekable: true}},
+		{"https://www.twitch.tv/videos/123456789?t=3723", "iframe",
+			"https://player.twitch.tv/?autoplay=false&parent=party.example.com&time=1h2m3s&video=v123456789",
+			VideoCaps{Seekable: true}},
+		{"https://www.twitch.tv/somechannel", "iframe",
+			"https://player.twitch.tv/?autoplay=false&channel=somechannel&parent=party.example.com",
+			VideoCaps{Live: true}},
+		{"https://clips.twitch.tv/FunnyClip", "iframe",
+			"https://clips.twitch.tv/embed?autoplay=false&clip=FunnyClip&parent=party.example.com",
+			VideoCaps{Seekable: true}},
+		{"https://cdn.example.com/movie.mp4#t=90", "video", "https://cdn.example.com/movie.mp4#t=90",
+			VideoCaps{Seekable: true}},
+		{"https://cdn.example.com/live/index.m3u8", "stream", "https://cdn.example.com/live/index.m3u8",
+			VideoCaps{Seekable: true}},
+		{"https://example.com/page.html", "link", "", VideoCaps{}},
+	}
+	providers := DefaultVideoProviders()
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			e := providers.Embed(tt.url, opts)
+			if e.Kind != tt.kind || e.EmbedURL != tt.embed || e.Caps != tt.caps {
+				t.Errorf("got %s %q %+v", e.Kind, e.EmbedURL, e.Caps)
+			}
+			if e.URL != tt.url {
+				t.Errorf("url %q, want the original link", e.URL)
+			}
+		})
+	}
+}
+
+func TestParseStart(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"90", 90 * time.Second},
+		{"90s", 90 * time.Second},
+		{"1m30s", 90 * time.Second},
+		{"1H2M3S", time.Hour + 2*time.Minute + 3*time.Second},
+		{"01:30", 90 * time.Second},
+		{"1:02:03", time.Hour + 2*time.Minute + 3*time.Second},
+		{"1.5s", time.Second},
+		{"-5", 0},
+		{"1:-5", 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseStart(tt.in); got != tt.want {
+			t.Errorf("parseStart(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
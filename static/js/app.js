@@ -1,69 +1,89 @@
-// Функция для присоединения к существующей комнате
-function joinExistingRoom() {
-    document.getElementById('joinModal').style.display = 'block';
-}
+// Проверка формы создания комнаты на главной
+document.querySelector('form').addEventListener('submit', function(e) {
+	const url = document.getElementById('videoUrl').value;
+	// Загрузка файла: комнату для него создаёт сервер
+	const upload = document.getElementById('uploadFile');
+	if (upload && upload.files.length) {
+		e.preventDefault();
+		if (url || (document.getElementById('mediaId') || {}).value) {
+			alert('Please choose either a video URL, a library file or an upload');
+			return;
+		}
+		uploadVideo(upload, this);
+		return;
+	}
+	// Файл из медиатеки вместо ссылки
+	const media = document.getElementById('mediaId');
+	if (media && media.value) {
+		if (url) {
+			e.preventDefault();
+			alert('Please choose either a video URL or a library file');
+		}
+		return;
+	}
+	if (!url) {
+		e.preventDefault();
+		alert('Please enter a video URL' + (media ? ' or pick a library file' : ''));
+		return;
+	}
+	if (!url.startsWith('http')) {
+		e.preventDefault();
+		alert('Please enter a valid URL (start with http:// or https://)');
+		return;
+	}
+	// Сервер всё равно откажет, но сказать об этом можно сразу
+	const bad = [url].concat(document.getElementById('sources').value.split('\n'))
+		.map(unplayableFormat).filter(Boolean);
+	if (bad.length) {
+		e.preventDefault();
+		alert('.' + bad[0] + ' files can\'t be played in browsers. Please convert the video to MP4 (H.264/AAC) or WebM.');
+	}
+});
 
-function closeModal() {
-    document.getElementById('joinModal').style.display = 'none';
-}
+// Загрузка выбранного файла с прогрессом и переход в его комнату
+function uploadVideo(input, form) {
+	const file = input.files[0];
+	const username = document.getElementById('username').value.trim();
+	if (!username) {
+		alert('Please enter your name');
+		return;
+	}
+	if (file.size > Number(input.dataset.maxSize)) {
+		alert('This file is too large to upload');
+		return;
+	}
 
-// Закрытие модального окна при клике вне его
-window.onclick = function(event) {
-    const modal = document.getElementById('joinModal');
-    if (event.target === modal) {
-        closeModal();
-    }
-}
+	const bar = document.getElementById('uploadProgress');
+	const status = document.getElementById('uploadStatus');
+	const button = form.querySelector('button[type=submit]');
+	bar.hidden = false;
+	button.disabled = true;
+	status.textContent = 'Starting upload…';
 
-// Валидация URL перед отправкой
-document.getElementById('videoForm').addEventListener('submit', function(e) {
-    const urlInput = document.getElementById('videoUrl');
-    const url = urlInput.value.trim();
-    
-    if (!url) {
-        e.preventDefault();
-        alert('Please enter a video URL');
-        return;
-    }
-    
-    // Простая валидация URL
-    try {
-        new URL(url);
-    } catch (_) {
-        e.preventDefault();
-        alert('Please enter a valid URL (include http:// or https://)');
-        urlInput.focus();
-    }
-});
-
-// Пример: автоматическое определение платформы
-document.getElementById('videoUrl').addEventListener('input', function(e) {
-    const url = e.target.value;
-    const platforms = document.querySelectorAll('.platform');
-    
-    // Сброс всех выделений
-    platforms.forEach(p => p.style.opacity = '0.5');
-    
-    // Определяем платформу и выделяем её
-    if (url.includes('youtube.com') || url.includes('youtu.be')) {
-        highlightPlatform('YouTube');
-    } else if (url.includes('vimeo.com')) {
-        highlightPlatform('Vimeo');
-    } else if (url.includes('twitch.tv')) {
-        highlightPlatform('Twitch');
-    } else if (url.includes('.mp4') || url.includes('.webm') || url.includes('.mov')) {
-        highlightPlatform('Direct Links');
-    }
-});
+	Upload.start(file, input.dataset.endpoint, {
+		filename: file.name,
+		owner: username,
+		roomName: document.getElementById('roomName').value.trim(),
+	}, {
+		onProgress: function(sent, total) {
+			bar.value = total ? Math.floor(sent * 100 / total) : 0;
+			status.textContent = 'Uploaded ' + Math.floor(sent / 1048576) + ' of ' + Math.ceil(total / 1048576) + ' MB';
+		},
+	}).then(function(result) {
+		status.textContent = 'Upload complete, opening the room…';
+		location.href = input.dataset.room + encodeURIComponent(result.roomId) + '?username=' + encodeURIComponent(username);
+	}).catch(function(err) {
+		button.disabled = false;
+		status.textContent = '❌ ' + err.message + '. Submit again to resume.';
+	});
+}
 
-function highlightPlatform(platformName) {
-    const platforms = document.querySelectorAll('.platform');
-    platforms.forEach(p => {
-        if (p.querySelector('span').textContent === platformName) {
-            p.style.opacity = '1';
-            p.style.border = '2px solid #00adb5';
-        } else {
-            p.style.border = 'none';
-        }
-    });
-}
\ No newline at end of file
+// Расширение файла, который браузеры не проигрывают, или null
+function unplayableFormat(link) {
+	try {
+		const m = new URL(link.trim()).pathname.toLowerCase().match(/\.(avi|mkv|flv|wmv|mpe?g)$/);
+		return m ? m[1] : null;
+	} catch (err) {
+		return null;
+	}
+}
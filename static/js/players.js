@@ -0,0 +1,232 @@
+// Адаптеры плееров: общий интерфейс над YouTube, Vimeo и <video>.
+//
+//   play(), pause(), seek(seconds)
+//   getTime()      — текущая позиция в секундах
+//   isPlaying()
+//   onStateChange(fn) — fn({type: 'play' | 'pause' | 'seek', time})
+//   goLive()       — только у потоков HLS/DASH: к краю эфира
+//
+// YouTube и Vimeo управляются через postMessage их iframe — те же протоколы,
+// что используют официальные библиотеки, но без загрузки сторонних скриптов.
+const Players = (function() {
+	'use strict';
+
+	// Общая часть: подписчики и последнее известное состояние
+	function base() {
+		const listeners = [];
+		const state = {time: 0, at: Date.now(), playing: false};
+		return {
+			state: state,
+			emit: function(type) {
+				const ev = {type: type, time: state.time};
+				listeners.forEach(function(fn) { fn(ev); });
+			},
+			// Позиция с поправкой на время, прошедшее с последнего события
+			now: function() {
+				if (!state.playing) return state.time;
+				return state.time + (Date.now() - state.at) / 1000;
+			},
+			setTime: function(t) {
+				state.time = t;
+				state.at = Date.now();
+			},
+			on: function(fn) { listeners.push(fn); }
+		};
+	}
+
+	// Сообщения только от своего iframe; данные бывают строкой JSON
+	function listen(iframe, fn) {
+		window.addEventListener('message', function(e) {
+			if (e.source !== iframe.contentWindow) return;
+			let data = e.data;
+			if (typeof data === 'string') {
+				try { data = JSON.parse(data); } catch (err) { return; }
+			}
+			if (data && typeof data === 'object') fn(data);
+		});
+	}
+
+	// <video>
+	function html5(video) {
+		const b = base();
+		video.addEventListener('play', function() {
+			b.state.playing = true;
+			b.setTime(video.currentTime);
+			b.emit('play');
+		});
+		video.addEventListener('pause', function() {
+			b.state.playing = false;
+			b.setTime(video.currentTime);
+			b.emit('pause');
+		});
+		video.addEventListener('seeked', function() {
+			b.setTime(video.currentTime);
+			b.emit('seek');
+		});
+		return {
+			play: function() { video.play().catch(function() {}); },
+			pause: function() { video.pause(); },
+			seek: function(t) { video.currentTime = t; },
+			getTime: function() { return video.currentTime; },
+			isPlaying: function() { return !video.paused; },
+			onStateChange: b.on
+		};
+	}
+
+	// YouTube: канал "widget" плеера с enablejsapi=1
+	function youtube(iframe) {
+		const b = base();
+		const target = new URL(iframe.src).origin;
+
+		function post(msg) {
+			msg.id = iframe.id;
+			msg.channel = 'widget';
+			iframe.contentWindow.postMessage(JSON.stringify(msg), target);
+		}
+		function command(func, args) {
+			post({event: 'command', func: func, args: args || []});
+		}
+
+		// Плеер начинает присылать события, только когда его «слушают»
+		let attempts = 0;
+		const handshake = setInterval(function() {
+			post({event: 'listening'});
+			if (++attempts > 40) clearInterval(handshake);
+		}, 250);
+
+		// Состояния плеера: 1 — играет, 2 — пауза, 0 — закончилось
+		function setState(s) {
+			if (s === 1 && !b.state.playing) {
+				b.state.playing = true;
+				b.state.at = Date.now();
+				b.emit('play');
+			} else if ((s === 2 || s === 0) && b.state.playing) {
+				b.setTime(b.now());
+				b.state.playing = false;
+				b.emit('pause');
+			}
+		}
+
+		listen(iframe, function(data) {
+			clearInterval(handshake);
+			if (data.event === 'onReady') {
+				command('addEventListener', ['onStateChange']);
+			} else if (data.event === 'onStateChange') {
+				setState(data.info);
+			} else if (data.event === 'infoDelivery' && data.info) {
+				if (typeof data.info.currentTime === 'number') {
+					// Скачок дальше ожидаемого — пользователь перемотал
+					const jumped = Math.abs(data.info.currentTime - b.now()) > 1.5;
+					b.setTime(data.info.currentTime);
+					if (jumped) b.emit('seek');
+				}
+				if (typeof data.info.playerState === 'number') setState(data.info.playerState);
+			}
+		});
+
+		return {
+			play: function() { command('playVideo'); },
+			pause: function() { command('pauseVideo'); },
+			seek: function(t) {
+				b.setTime(t);
+				command('seekTo', [t, true]);
+			},
+			getTime: b.now,
+			isPlaying: function() { return b.state.playing; },
+			onStateChange: b.on
+		};
+	}
+
+	// Vimeo: postMessage API плеера (api=1)
+	function vimeo(iframe) {
+		const b = base();
+		const target = new URL(iframe.src).origin;
+
+		function post(method, value) {
+			const msg = {method: method};
+			if (value !== undefined) msg.value = value;
+			iframe.contentWindow.postMessage(JSON.stringify(msg), target);
+		}
+		function subscribe() {
+			['play', 'pause', 'seeked', 'timeupdate'].forEach(function(ev) {
+				post('addEventListener', ev);
+			});
+		}
+		iframe.addEventListener('load', subscribe);
+
+		listen(iframe, function(data) {
+			const seconds = data.data && typeof data.data.seconds === 'number' ? data.data.seconds : null;
+			if (seconds !== null) b.setTime(seconds);
+			switch (data.event) {
+				case 'ready':
+					subscribe();
+					break;
+				case 'play':
+					b.state.playing = true;
+					b.emit('play');
+					break;
+				case 'pause':
+					b.state.playing = false;
+					b.emit('pause');
+					break;
+				case 'seeked':
+					b.emit('seek');
+					break;
+			}
+		});
+
+		return {
+			play: function() { post('play'); },
+			pause: function() { post('pause'); },
+			seek: function(t) {
+				b.setTime(t);
+				post('setCurrentTime', t);
+			},
+			getTime: b.now,
+			isPlaying: function() { return b.state.playing; },
+			onStateChange: b.on
+		};
+	}
+
+	// HLS и DASH: тот же <video>, поток в него грузит stream.js. Эфир ли это,
+	// становится известно из манифеста — тогда меняются и caps.
+	function stream(video, info) {
+		const player = html5(video);
+		const ctl = Stream.attach(video, info.url, info.player, {
+			onLive: function() {
+				player.caps = {seekable: false, live: true};
+			},
+			onError: function(err) {
+				console.error('Stream playback failed:', err);
+				video.dispatchEvent(new CustomEvent('streamerror', {detail: err}));
+			}
+		});
+		player.goLive = ctl.goLive;
+		return player;
+	}
+
+	// Плеер без API (Dailymotion, Twitch, ссылки): команды игнорируются
+	function passive() {
+		return {
+			play: function() {},
+			pause: function() {},
+			seek: function() {},
+			getTime: function() { return 0; },
+			isPlaying: function() { return false; },
+			onStateChange: function() {}
+		};
+	}
+
+	const adapters = {html5: html5, youtube: youtube, vimeo: vimeo, hls: stream, dash: stream};
+
+	return {
+		// video — описание из room-data, element — iframe или <video> плеера
+		create: function(video, element) {
+			const make = adapters[video.player];
+			const player = make && element ? make(element, video) : passive();
+			player.name = make && element ? video.player : 'none';
+			player.caps = video.caps || {seekable: false, live: false};
+			return player;
+		}
+	};
+})();
@@ -0,0 +1,511 @@
+// Данные комнаты сервер кладёт в JSON-блок страницы
+const page = JSON.parse(document.getElementById('room-data').textContent);
+const roomId = page.roomId;
+const username = page.username;
+const videoUrl = page.videoUrl;
+const ownerName = page.ownerName;
+const isOwner = page.isOwner;
+const basePath = page.basePath;
+let ws;
+let roomClosed = false;
+let restartDelay = 0;
+
+// WebSocket соединение
+function connectWebSocket() {
+	const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+	ws = new WebSocket(protocol + '//' + window.location.host + basePath + '/ws/' + roomId + '?username=' + encodeURIComponent(username));
+	
+	ws.onopen = function() {
+		console.log('WebSocket connected');
+		updateStatus('✅ Connected');
+		ws.send(JSON.stringify({type: 'join', user: username}));
+	};
+	
+	ws.onmessage = function(event) {
+		const msg = JSON.parse(event.data);
+		handleMessage(msg);
+	};
+	
+	ws.onclose = function() {
+		if (roomClosed) return;
+		if (restartDelay) {
+			// Сервер сам попросил подождать перед переподключением
+			setTimeout(connectWebSocket, restartDelay);
+			restartDelay = 0;
+			return;
+		}
+		updateStatus('❌ Disconnected - Reconnecting...');
+		setTimeout(connectWebSocket, 3000);
+	};
+	
+	ws.onerror = function(error) {
+		console.error('WebSocket error:', error);
+		updateStatus('⚠️ Connection error');
+	};
+}
+
+function handleMessage(msg) {
+	switch(msg.type) {
+		case 'chat':
+			addChatMessage(msg.user, msg.data);
+			break;
+		
+		case 'users':
+			updateUsersList(msg.data);
+			break;
+		
+		case 'play':
+			playVideo();
+			break;
+		
+		case 'pause':
+			pauseVideo();
+			break;
+		
+		case 'seek':
+			seekVideo(msg.data);
+			break;
+		
+		case 'state':
+			syncVideo(msg.data);
+			break;
+		
+		case 'room_closed':
+			roomClosed = true;
+			updateStatus('🚪 Room was closed');
+			break;
+		
+		case 'server_restarting':
+			restartDelay = msg.data.reconnectAfterMs;
+			updateStatus('🔄 Server restarting - Reconnecting in ' + Math.ceil(restartDelay / 1000) + 's...');
+			break;
+		
+		case 'rate_limited':
+			updateStatus('⚠️ Too many messages - slow down');
+			setTimeout(function() {
+				if (ws.readyState === WebSocket.OPEN) updateStatus('✅ Connected');
+			}, Math.max(msg.data.retryAfterMs, 2000));
+			break;
+		
+		case 'chat_policy':
+			applyChatPolicy(msg.data);
+			break;
+		
+		case 'chat_rejected':
+			updateStatus('⚠️ ' + (msg.data.detail || chatRejectReasons[msg.data.reason] || 'Message rejected'));
+			setTimeout(function() {
+				if (ws.readyState === WebSocket.OPEN) updateStatus('✅ Connected');
+			}, Math.max(msg.data.retryAfterMs || 0, 3000));
+			break;
+		
+		case 'chat_filtered':
+			updateStatus('ℹ️ ' + msg.data.reasons.join('; '));
+			setTimeout(function() {
+				if (ws.readyState === WebSocket.OPEN) updateStatus('✅ Connected');
+			}, 3000);
+			break;
+		
+		case 'chat_flagged':
+			addChatMessage('🚩 ' + msg.data.user, msg.data.text + ' (' + msg.data.reasons.join('; ') + ')');
+			break;
+		
+		case 'subtitles':
+			applySubtitles(msg.data);
+			break;
+	}
+}
+
+const chatRejectReasons = {
+	slow_mode: 'Slow mode is on - wait a bit',
+	duplicate: 'You already sent that',
+	too_long: 'Message is too long',
+	too_many_links: 'Too many links in one message',
+	links_forbidden: 'Only the room owner can post links'
+};
+
+// Правила чата комнаты: подсказка и предел длины в поле ввода
+function applyChatPolicy(policy) {
+	const input = document.getElementById('chatInput');
+	if (policy.maxLength > 0) {
+		input.maxLength = policy.maxLength;
+	} else {
+		input.removeAttribute('maxlength');
+	}
+	input.placeholder = policy.slowModeSeconds > 0 && !isOwner
+		? 'Slow mode: one message every ' + policy.slowModeSeconds + 's'
+		: 'Type a message...';
+}
+
+function updateUsersList(users) {
+	const list = document.getElementById('usersList');
+	list.innerHTML = '';
+	users.forEach(user => {
+		const badge = document.createElement('span');
+		badge.className = 'user-badge' + (user === ownerName ? ' owner' : '');
+		badge.textContent = user;
+		if (user === ownerName) {
+			const crown = document.createElement('span');
+			crown.className = 'icon';
+			crown.textContent = '👑';
+			badge.append(' ', crown);
+		}
+		list.appendChild(badge);
+	});
+	document.getElementById('userCount').textContent = users.length;
+}
+
+function addChatMessage(user, text) {
+	const chat = document.getElementById('chatMessages');
+	const msgDiv = document.createElement('div');
+	msgDiv.className = 'chat-message';
+	// Только текстовые узлы: имя и сообщение приходят от других пользователей
+	const name = document.createElement('strong');
+	name.textContent = user + ':';
+	msgDiv.append(name, ' ' + text);
+	chat.appendChild(msgDiv);
+	chat.scrollTop = chat.scrollHeight;
+}
+
+// Субтитры: дорожку и сдвиг каждый зритель выбирает себе и хранит
+// в localStorage, владелец задаёт дорожку по умолчанию для всех
+const subtitleKey = 'subtitles:' + roomId;
+const MAX_SUBTITLE_OFFSET = 600; // секунд в любую сторону
+let subtitles = page.subtitles || null;
+let subtitlePrefs = loadSubtitlePrefs();
+
+function loadSubtitlePrefs() {
+	const prefs = {track: '', offset: 0}; // track: '' — как у комнаты, 'off' — выключены
+	try {
+		Object.assign(prefs, JSON.parse(localStorage.getItem(subtitleKey)));
+	} catch (e) {}
+	return prefs;
+}
+
+function saveSubtitlePrefs() {
+	try {
+		localStorage.setItem(subtitleKey, JSON.stringify(subtitlePrefs));
+	} catch (e) {}
+}
+
+function subtitleTracks() {
+	return document.querySelectorAll('#player track');
+}
+
+// Сдвиг реплик уже загруженной дорожки до выбранного зрителем;
+// у выключенной дорожки реплик нет — сдвинем, когда её включат
+function alignCues(el) {
+	const cues = el.track.cues;
+	if (el.readyState !== 2 || !cues) return;
+	const delta = subtitlePrefs.offset - (Number(el.dataset.offset) || 0);
+	if (!delta) return;
+	for (let i = 0; i < cues.length; i++) {
+		cues[i].startTime += delta;
+		cues[i].endTime += delta;
+	}
+	el.dataset.offset = subtitlePrefs.offset;
+}
+
+function watchTrack(el) {
+	el.addEventListener('load', function() { alignCues(el); });
+	alignCues(el);
+}
+
+// Включаем выбранную дорожку, остальные выключаем
+function showSubtitles() {
+	const ids = subtitles.tracks.map(function(t) { return t.id; });
+	let chosen = subtitlePrefs.track;
+	if (chosen !== 'off' && ids.indexOf(chosen) < 0) chosen = subtitles.default;
+	subtitleTracks().forEach(function(el) {
+		el.track.mode = el.id === 'sub-' + chosen ? 'showing' : 'disabled';
+		alignCues(el);
+	});
+}
+
+// Список дорожек от сервера: <track> приводим к нему
+function applySubtitles(list) {
+	if (!subtitles) return;
+	subtitles = list;
+	const video = document.getElementById('player');
+	const wanted = {};
+	list.tracks.forEach(function(t) { wanted['sub-' + t.id] = t; });
+	subtitleTracks().forEach(function(el) {
+		if (wanted[el.id]) {
+			delete wanted[el.id];
+		} else {
+			el.remove();
+		}
+	});
+	Object.keys(wanted).forEach(function(id) {
+		const t = wanted[id];
+		const el = document.createElement('track');
+		el.kind = 'subtitles';
+		el.id = id;
+		el.label = t.label;
+		if (t.lang) el.srclang = t.lang;
+		el.src = t.url;
+		video.appendChild(el);
+		watchTrack(el);
+	});
+	renderSubtitleChoice();
+	renderSubtitleOwner();
+	showSubtitles();
+}
+
+function trackName(t) {
+	return t.lang && t.lang !== t.label ? t.label + ' (' + t.lang + ')' : t.label;
+}
+
+function renderSubtitleChoice() {
+	const select = document.getElementById('subtitleSelect');
+	const def = subtitles.tracks.find(function(t) { return t.id === subtitles.default; });
+	const options = [['', 'Room default: ' + (def ? trackName(def) : 'off')], ['off', 'Off']];
+	subtitles.tracks.forEach(function(t) { options.push([t.id, trackName(t)]); });
+	select.replaceChildren();
+	options.forEach(function(o) {
+		select.appendChild(new Option(o[1], o[0]));
+	});
+	select.value = subtitlePrefs.track;
+	if (select.value !== subtitlePrefs.track) select.value = '';
+}
+
+// Управление дорожками видно только владельцу; права проверяет сервер
+function renderSubtitleOwner() {
+	if (!isOwner) return;
+	document.getElementById('subtitleOwner').hidden = false;
+	const list = document.getElementById('subtitleList');
+	list.replaceChildren();
+	subtitles.tracks.forEach(function(t) {
+		const item = document.createElement('li');
+		const name = document.createElement('span');
+		name.textContent = (t.id === subtitles.default ? '⭐ ' : '') + trackName(t);
+		const def = document.createElement('button');
+		def.className = 'btn btn-secondary';
+		def.textContent = t.id === subtitles.default ? 'Unset default' : 'Make default';
+		def.addEventListener('click', function() {
+			subtitleRequest('PUT', '/default', JSON.stringify({id: t.id === subtitles.default ? '' : t.id}));
+		});
+		const del = document.createElement('button');
+		del.className = 'btn btn-danger';
+		del.textContent = 'Delete';
+		del.addEventListener('click', function() {
+			if (confirm('Delete subtitles "' + t.label + '"?')) subtitleRequest('DELETE', '/' + encodeURIComponent(t.id));
+		});
+		item.append(name, def, del);
+		list.appendChild(item);
+	});
+}
+
+// Запрос к API субтитров комнаты; новый список придёт по WebSocket.
+// Ошибку показываем в статусе, промис тогда вернёт null
+function subtitleRequest(method, path, body) {
+	const url = basePath + '/api/rooms/' + encodeURIComponent(roomId) + '/subtitles' + path;
+	return fetch(url, {method: method, body: body}).then(function(resp) {
+		if (resp.ok) return resp.json();
+		return resp.json().catch(function() { return {}; }).then(function(b) {
+			throw new Error(b.error || 'HTTP ' + resp.status);
+		});
+	}).catch(function(err) {
+		updateStatus('⚠️ Subtitles: ' + err.message);
+		setTimeout(function() {
+			if (ws.readyState === WebSocket.OPEN) updateStatus('✅ Connected');
+		}, 4000);
+		return null;
+	});
+}
+
+function uploadSubtitles() {
+	const input = document.getElementById('subtitleFile');
+	const file = input.files[0];
+	if (!file) {
+		input.click();
+		return;
+	}
+	const params = new URLSearchParams();
+	const label = document.getElementById('subtitleLabel').value.trim();
+	const lang = document.getElementById('subtitleLang').value.trim();
+	if (label) params.set('label', label);
+	if (lang) params.set('lang', lang);
+	if (!subtitles.tracks.length) params.set('default', '1');
+	const btn = document.getElementById('subtitleUploadBtn');
+	btn.disabled = true;
+	subtitleRequest('POST', '?' + params, file).then(function(track) {
+		btn.disabled = false;
+		if (!track) return;
+		input.value = '';
+		document.getElementById('subtitleLabel').value = '';
+		document.getElementById('subtitleLang').value = '';
+	});
+}
+
+function setupSubtitles() {
+	if (!subtitles) return;
+	subtitleTracks().forEach(watchTrack);
+	const select = document.getElementById('subtitleSelect');
+	select.addEventListener('change', function() {
+		subtitlePrefs.track = select.value;
+		saveSubtitlePrefs();
+		showSubtitles();
+	});
+	const offset = document.getElementById('subtitleOffset');
+	offset.value = subtitlePrefs.offset;
+	offset.addEventListener('change', function() {
+		let value = parseFloat(offset.value) || 0;
+		value = Math.max(-MAX_SUBTITLE_OFFSET, Math.min(MAX_SUBTITLE_OFFSET, value));
+		offset.value = value;
+		subtitlePrefs.offset = value;
+		saveSubtitlePrefs();
+		subtitleTracks().forEach(alignCues);
+	});
+	document.getElementById('subtitleUploadBtn').addEventListener('click', uploadSubtitles);
+	renderSubtitleChoice();
+	renderSubtitleOwner();
+	showSubtitles();
+}
+
+// Управление видео через адаптер плеера (players.js)
+let player;
+// Команды из комнаты вызывают у плеера те же события, что и действия
+// пользователя; их не отправляем обратно, чтобы не зациклиться
+const REMOTE_ECHO_MS = 1000;
+let remoteUntil = 0;
+
+function applyRemote(fn) {
+	remoteUntil = Date.now() + REMOTE_ECHO_MS;
+	fn();
+}
+
+function playVideo() {
+	applyRemote(function() {
+		// В эфире все смотрят с края, а не с места, где остановились
+		if (player.caps.live && player.goLive) player.goLive();
+		player.play();
+	});
+}
+
+function pauseVideo() {
+	applyRemote(function() { player.pause(); });
+}
+
+function seekVideo(time) {
+	if (!player.caps.seekable) return;
+	applyRemote(function() { player.seek(time); });
+}
+
+function syncVideo(state) {
+	if (state.currentTime) seekVideo(state.currentTime);
+	if (state.playing) playVideo(); else pauseVideo();
+}
+
+function sendMessage() {
+	const input = document.getElementById('chatInput');
+	const text = input.value.trim();
+	if (text && ws.readyState === WebSocket.OPEN) {
+		ws.send(JSON.stringify({type: 'chat', user: username, data: text}));
+		input.value = '';
+	}
+}
+
+function syncWithRoom() {
+	if (player.caps.live && player.goLive) player.goLive();
+	if (ws.readyState === WebSocket.OPEN && player.name !== 'none') {
+		ws.send(JSON.stringify({
+			type: 'state_update',
+			user: username,
+			data: {
+				playing: player.isPlaying(),
+				currentTime: player.getTime()
+			}
+		}));
+	}
+}
+
+function copyInviteLink() {
+	const input = document.getElementById('inviteInput');
+	input.select();
+	navigator.clipboard.writeText(input.value);
+	
+	const notification = document.getElementById('copyNotification');
+	notification.style.display = 'block';
+	notification.textContent = '✅ Link copied to clipboard!';
+	setTimeout(() => {
+		notification.style.display = 'none';
+	}, 2000);
+}
+
+function openOriginal() {
+	// Адрес задаёт создатель комнаты — открываем только http(s)
+	if (/^https?:\/\//i.test(videoUrl)) {
+		window.open(videoUrl, '_blank', 'noopener');
+	}
+}
+
+function leaveRoom() {
+	if (confirm('Leave this room?')) {
+		if (ws.readyState === WebSocket.OPEN) {
+			ws.send(JSON.stringify({type: 'leave', user: username}));
+			ws.close();
+		}
+		window.location.href = basePath + '/';
+	}
+}
+
+function updateStatus(text) {
+	document.getElementById('status').textContent = text;
+}
+
+function showHelp() {
+	alert('🎬 VideoParty Help:\n\n' +
+		  '1. Share the invite link with friends\n' +
+		  '2. Use "Sync with Room" to match playback\n' +
+		  '3. Chat with others in real-time\n' +
+		  '4. Play/pause/seek will sync with everyone');
+}
+
+// События плеера -> комната
+function setupPlayer() {
+	const element = document.getElementById('player');
+	player = Players.create(page.video, element);
+	if (element) {
+		element.addEventListener('streamerror', function(e) {
+			updateStatus('⚠️ Can\'t play this stream: ' + e.detail.message);
+		});
+	}
+	player.onStateChange(function(ev) {
+		if (Date.now() < remoteUntil || ws.readyState !== WebSocket.OPEN) return;
+		if (ev.type === 'play' && player.caps.live && player.goLive) {
+			applyRemote(function() { player.goLive(); });
+		}
+		if (ev.type === 'seek') {
+			if (!player.caps.seekable) return;
+			ws.send(JSON.stringify({type: 'seek', user: username, data: ev.time}));
+		} else {
+			ws.send(JSON.stringify({type: ev.type, user: username}));
+		}
+	});
+}
+
+// Обработчики кнопок (без inline-атрибутов onclick)
+function setupControls() {
+	document.getElementById('helpLink').addEventListener('click', function(e) {
+		e.preventDefault();
+		showHelp();
+	});
+	document.getElementById('copyInviteBtn').addEventListener('click', copyInviteLink);
+	document.getElementById('syncBtn').addEventListener('click', syncWithRoom);
+	document.getElementById('openOriginalBtn').addEventListener('click', openOriginal);
+	document.getElementById('leaveBtn').addEventListener('click', leaveRoom);
+	document.getElementById('sendBtn').addEventListener('click', sendMessage);
+	document.getElementById('chatInput').addEventListener('keypress', function(e) {
+		if (e.key === 'Enter') sendMessage();
+	});
+}
+
+// Запуск
+window.onload = function() {
+	setupControls();
+	setupPlayer();
+	setupSubtitles();
+	connectWebSocket();
+	// Авто-фокус на чате
+	document.getElementById('chatInput').focus();
+};
@@ -0,0 +1,626 @@
+// Проигрыватель HLS и DASH на Media Source Extensions.
+//
+//   Stream.attach(video, url, format, opts) -> {goLive(), destroy()}
+//     format     — 'hls' или 'dash'
+//     opts.onLive()     — манифест оказался эфиром
+//     opts.onError(err) — поток не получается играть
+//
+// Сегменты должны быть fragmented MP4 (CMAF): HLS с #EXT-X-MAP, DASH с
+// SegmentTemplate (по номеру или SegmentTimeline) или SegmentList. HLS с
+// сегментами MPEG-TS через MSE не сыграть — его играет сам <video>, если
+// браузер умеет HLS (Safari, Chrome на Android). Качество выбирается один
+// раз при старте по оценке скорости соединения.
+const Stream = (function() {
+	'use strict';
+
+	const BUFFER_AHEAD = 30;  // секунд буфера впереди позиции
+	const BUFFER_BEHIND = 60; // сколько просмотренного держать в буфере
+	const LIVE_SEGMENTS = 3;  // с какого сегмента от края начинать эфир
+
+	function resolve(ref, base) {
+		return new URL(ref, base).href;
+	}
+
+	function fetchText(url) {
+		return fetch(url).then(function(r) {
+			if (!r.ok) throw new Error(url + ': HTTP ' + r.status);
+			return r.text().then(function(text) { return {text: text, url: r.url}; });
+		});
+	}
+
+	function fetchBytes(ref) {
+		const opts = ref.range ? {headers: {Range: 'bytes=' + ref.range}} : {};
+		return fetch(ref.url, opts).then(function(r) {
+			if (!r.ok) throw new Error(ref.url + ': HTTP ' + r.status);
+			return r.arrayBuffer();
+		});
+	}
+
+	// Скорость соединения в бит/с для выбора качества
+	function estimateBandwidth() {
+		const c = navigator.connection;
+		return c && c.downlink ? c.downlink * 1e6 : 3e6;
+	}
+
+	// Лучший вариант, который пролезает в канал; иначе самый лёгкий
+	function chooseVariant(variants) {
+		const budget = estimateBandwidth() * 0.8;
+		const sorted = variants.slice().sort(function(a, b) { return a.bandwidth - b.bandwidth; });
+		let best = sorted[0];
+		sorted.forEach(function(v) {
+			if (v.bandwidth <= budget) best = v;
+		});
+		return best;
+	}
+
+	const audioCodec = /^(mp4a|ac-3|ec-3|opus|flac)/;
+
+	// "avc1.64001f,mp4a.40.2" -> {video: "avc1.64001f", audio: "mp4a.40.2"}
+	function splitCodecs(codecs) {
+		const out = {video: [], audio: []};
+		(codecs || '').split(',').forEach(function(c) {
+			c = c.trim();
+			if (c) out[audioCodec.test(c) ? 'audio' : 'video'].push(c);
+		});
+		return {video: out.video.join(','), audio: out.audio.join(',')};
+	}
+
+	function mp4Type(kind, codecs) {
+		return kind + '/mp4' + (codecs ? '; codecs="' + codecs + '"' : '');
+	}
+
+	// --- HLS ---
+
+	// BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2"
+	function parseAttrs(s) {
+		const attrs = {};
+		const re = /([A-Z0-9-]+)=("[^"]*"|[^,]*)/g;
+		let m;
+		while ((m = re.exec(s)) !== null) {
+			attrs[m[1]] = m[2].replace(/^"|"$/g, '');
+		}
+		return attrs;
+	}
+
+	// "длина@смещение" -> диапазон для заголовка Range
+	function byteRange(spec, last) {
+		const parts = spec.split('@');
+		const length = parseInt(parts[0], 10);
+		const offset = parts.length > 1 ? parseInt(parts[1], 10) : last;
+		return {range: offset + '-' + (offset + length - 1), end: offset + length};
+	}
+
+	function parseM3U8(text, base) {
+		const lines = text.split(/\r?\n/);
+		if (lines[0].replace(/^\uFEFF/, '').trim() !== '#EXTM3U') {
+			throw new Error('not an HLS playlist');
+		}
+		const pl = {variants: [], audio: {}, segments: [], init: null, target: 6, sequence: 0, ended: false};
+		let variant = null;
+		let duration = 0;
+		let range = null;
+		let rangeEnd = 0;
+		let time = 0;
+
+		lines.slice(1).forEach(function(line) {
+			line = line.trim();
+			const colon = line.indexOf(':');
+			const tag = colon < 0 ? line : line.slice(0, colon);
+			const value = colon < 0 ? '' : line.slice(colon + 1);
+
+			if (!line) return;
+			switch (tag) {
+				case '#EXT-X-STREAM-INF': {
+					const a = parseAttrs(value);
+					variant = {bandwidth: parseInt(a.BANDWIDTH, 10) || 0, codecs: a.CODECS || '', audio: a.AUDIO};
+					return;
+				}
+				case '#EXT-X-MEDIA': {
+					const a = parseAttrs(value);
+					if (a.TYPE === 'AUDIO' && a.URI) {
+						const group = pl.audio[a['GROUP-ID']] = pl.audio[a['GROUP-ID']] || [];
+						group.push({url: resolve(a.URI, base), default: a.DEFAULT === 'YES'});
+					}
+					return;
+				}
+				case '#EXT-X-MAP': {
+					const a = parseAttrs(value);
+					pl.init = {url: resolve(a.URI, base)};
+					if (a.BYTERANGE) pl.init.range = byteRange(a.BYTERANGE, 0).range;
+					return;
+				}
+				case '#EXT-X-TARGETDURATION':
+					pl.target = parseFloat(value) || pl.target;
+					return;
+				case '#EXT-X-MEDIA-SEQUENCE':
+					pl.sequence = parseInt(value, 10) || 0;
+					return;
+				case '#EXTINF':
+					duration = parseFloat(value) || 0;
+					return;
+				case '#EXT-X-BYTERANGE':
+					range = byteRange(value, rangeEnd);
+					return;
+				case '#EXT-X-ENDLIST':
+					pl.ended = true;
+					return;
+				case '#EXT-X-PLAYLIST-TYPE':
+					if (value === 'VOD') pl.ended = true;
+					return;
+			}
+			if (line[0] === '#') return;
+
+			if (variant) {
+				variant.url = resolve(line, base);
+				pl.variants.push(variant);
+				variant = null;
+				return;
+			}
+			const seg = {url: resolve(line, base), start: time, duration: duration, id: pl.sequence + pl.segments.length};
+			if (range) {
+				seg.range = range.range;
+				rangeEnd = range.end;
+				range = null;
+			}
+			pl.segments.push(seg);
+			time += duration;
+		});
+		return pl;
+	}
+
+	// Дорожка из медиаплейлиста: refresh() перечитывает его
+	function hlsTrack(url, mime) {
+		return {
+			mime: mime,
+			refresh: function() {
+				return fetchText(url).then(function(res) {
+					const pl = parseM3U8(res.text, res.url);
+					if (!pl.init) throw new Error('HLS segments are not fragmented MP4');
+					return {init: pl.init, segments: pl.segments, live: !pl.ended, update: pl.target};
+				});
+			}
+		};
+	}
+
+	function loadHLS(url) {
+		return fetchText(url).then(function(res) {
+			const pl = parseM3U8(res.text, res.url);
+			if (!pl.variants.length) {
+				// Без мастер-плейлиста кодеков не знаем; чаще всего это H.264 + AAC
+				return [hlsTrack(res.url, mp4Type('video', 'avc1.64001f,mp4a.40.2'))];
+			}
+			const v = chooseVariant(pl.variants);
+			const codecs = splitCodecs(v.codecs);
+			const group = v.audio && pl.audio[v.audio];
+			if (!group || !group.length) {
+				return [hlsTrack(v.url, mp4Type('video', v.codecs))];
+			}
+			// Звук отдельным плейлистом: две дорожки, два SourceBuffer
+			const audio = group.filter(function(a) { return a.default; })[0] || group[0];
+			return [
+				hlsTrack(v.url, mp4Type('video', codecs.video)),
+				hlsTrack(audio.url, mp4Type('audio', codecs.audio))
+			];
+		});
+	}
+
+	// --- DASH ---
+
+	// PT1H2M3.5S -> секунды
+	function isoDuration(s) {
+		const m = /^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$/.exec(s || '');
+		if (!m) return 0;
+		return (parseFloat(m[1]) || 0) * 86400 + (parseFloat(m[2]) || 0) * 3600 +
+			(parseFloat(m[3]) || 0) * 60 + (parseFloat(m[4]) || 0);
+	}
+
+	function child(el, name) {
+		for (let c = el && el.firstElementChild; c; c = c.nextElementSibling) {
+			if (c.localName === name) return c;
+		}
+		return null;
+	}
+
+	function children(el, name) {
+		const out = [];
+		for (let c = el && el.firstElementChild; c; c = c.nextElementSibling) {
+			if (c.localName === name) out.push(c);
+		}
+		return out;
+	}
+
+	function withBase(el, base) {
+		const b = child(el, 'BaseURL');
+		return b ? resolve(b.textContent.trim(), base) : base;
+	}
+
+	// Атрибут с ближайшего уровня: Representation, AdaptationSet, Period
+	function inherit(els, name) {
+		for (let i = 0; i < els.length; i++) {
+			if (els[i] && els[i].hasAttribute(name)) return els[i].getAttribute(name);
+		}
+		return null;
+	}
+
+	// $RepresentationID$, $Bandwidth$, $Number%05d$, $Time$
+	function fillTemplate(tpl, rep, number, time) {
+		return tpl.replace(/\$(RepresentationID|Bandwidth|Number|Time|)(?:%0(\d+)d)?\$/g, function(all, name, width) {
+			let v;
+			switch (name) {
+				case '': return '$';
+				case 'RepresentationID': return rep.id;
+				case 'Bandwidth': v = rep.bandwidth; break;
+				case 'Number': v = number; break;
+				case 'Time': v = time; break;
+			}
+			v = String(v);
+			return width ? v.padStart(parseInt(width, 10), '0') : v;
+		});
+	}
+
+	function parseMPD(text, base) {
+		const doc = new DOMParser().parseFromString(text, 'application/xml');
+		const root = doc.documentElement;
+		if (!root || root.localName !== 'MPD') throw new Error('not a DASH manifest');
+
+		const period = child(root, 'Period');
+		if (!period) throw new Error('DASH manifest has no periods');
+		const mpd = {
+			live: root.getAttribute('type') === 'dynamic',
+			duration: isoDuration(root.getAttribute('mediaPresentationDuration')),
+			start: Date.parse(root.getAttribute('availabilityStartTime') || '') || 0,
+			update: isoDuration(root.getAttribute('minimumUpdatePeriod')) || 2,
+			depth: isoDuration(root.getAttribute('timeShiftBufferDepth')) || 30,
+			periodStart: isoDuration(period.getAttribute('start')),
+			sets: []
+		};
+		const periodBase = withBase(period, withBase(root, base));
+
+		children(period, 'AdaptationSet').forEach(function(set) {
+			const setBase = withBase(set, periodBase);
+			const reps = children(set, 'Representation').map(function(rep) {
+				const levels = [rep, set, period];
+				const mime = inherit(levels, 'mimeType') || '';
+				return {
+					id: rep.getAttribute('id') || '',
+					bandwidth: parseInt(rep.getAttribute('bandwidth'), 10) || 0,
+					mime: mime,
+					codecs: inherit(levels, 'codecs') || '',
+					kind: mime.split('/')[0] || set.getAttribute('contentType') || '',
+					base: withBase(rep, setBase),
+					template: child(rep, 'SegmentTemplate') || child(set, 'SegmentTemplate') || child(period, 'SegmentTemplate'),
+					list: child(rep, 'SegmentList') || child(set, 'SegmentList')
+				};
+			});
+			if (reps.length) mpd.sets.push(reps);
+		});
+		return mpd;
+	}
+
+	// Сегменты представления на момент now (для эфира — окно доступных)
+	function dashSegments(rep, mpd, now) {
+		const tpl = rep.template;
+		if (tpl) {
+			const timescale = parseInt(tpl.getAttribute('timescale'), 10) || 1;
+			const startNumber = tpl.hasAttribute('startNumber') ? parseInt(tpl.getAttribute('startNumber'), 10) : 1;
+			const offset = parseInt(tpl.getAttribute('presentationTimeOffset'), 10) || 0;
+			const media = tpl.getAttribute('media');
+			const init = tpl.getAttribute('initialization');
+			const out = {init: init ? {url: resolve(fillTemplate(init, rep), rep.base)} : null, segments: []};
+			const timeline = child(tpl, 'SegmentTimeline');
+
+			if (timeline) {
+				let number = startNumber;
+				let t = 0;
+				const end = mpd.live ? Infinity : (mpd.duration || Infinity) * timescale + offset;
+				children(timeline, 'S').forEach(function(s) {
+					if (s.hasAttribute('t')) t = parseInt(s.getAttribute('t'), 10);
+					const d = parseInt(s.getAttribute('d'), 10);
+					let r = parseInt(s.getAttribute('r'), 10) || 0;
+					// r=-1: повторять до конца периода
+					if (r < 0) r = Math.max(0, Math.ceil((end - t) / d) - 1);
+					for (let i = 0; i <= r && t < end; i++) {
+						out.segments.push({
+							url: resolve(fillTemplate(media, rep, number, t), rep.base),
+							start: (t - offset) / timescale,
+							duration: d / timescale,
+							id: number
+						});
+						t += d;
+						number++;
+					}
+				});
+				return out;
+			}
+
+			const duration = (parseInt(tpl.getAttribute('duration'), 10) || 0) / timescale;
+			if (!duration) throw new Error('DASH SegmentTemplate has no duration');
+			let first = 0;
+			let last;
+			if (mpd.live) {
+				// Сегмент доступен, когда целиком записан
+				const elapsed = (now - mpd.start) / 1000 - mpd.periodStart;
+				last = Math.floor(elapsed / duration) - 1;
+				first = Math.max(0, last - Math.ceil(mpd.depth / duration));
+			} else {
+				last = Math.ceil(mpd.duration / duration) - 1;
+			}
+			for (let i = first; i <= last; i++) {
+				out.segments.push({
+					url: resolve(fillTemplate(media, rep, startNumber + i, offset + i * duration * timescale), rep.base),
+					start: i * duration,
+					duration: duration,
+					id: startNumber + i
+				});
+			}
+			return out;
+		}
+
+		if (rep.list) {
+			const timescale = parseInt(rep.list.getAttribute('timescale'), 10) || 1;
+			const duration = (parseInt(rep.list.getAttribute('duration'), 10) || 0) / timescale;
+			const init = child(rep.list, 'Initialization');
+			const out = {init: null, segments: []};
+			if (init) {
+				out.init = {url: resolve(init.getAttribute('sourceURL') || '', rep.base)};
+				if (init.hasAttribute('range')) out.init.range = init.getAttribute('range');
+			}
+			children(rep.list, 'SegmentURL').forEach(function(s, i) {
+				const seg = {url: resolve(s.getAttribute('media') || '', rep.base), start: i * duration, duration: duration, id: i};
+				if (s.hasAttribute('mediaRange')) seg.range = s.getAttribute('mediaRange');
+				out.segments.push(seg);
+			});
+			return out;
+		}
+		throw new Error('DASH representations without SegmentTemplate or SegmentList are not supported');
+	}
+
+	function dashTrack(url, pick) {
+		return {
+			mime: '',
+			refresh: function() {
+				return fetchText(url).then(function(res) {
+					const mpd = parseMPD(res.text, res.url);
+					const rep = pick(mpd);
+					const list = dashSegments(rep, mpd, Date.now());
+					return {init: list.init, segments: list.segments, live: mpd.live, update: mpd.update};
+				});
+			}
+		};
+	}
+
+	function loadDASH(url) {
+		return fetchText(url).then(function(res) {
+			const mpd = parseMPD(res.text, res.url);
+			const tracks = [];
+			['video', 'audio'].forEach(function(kind) {
+				const set = mpd.sets.filter(function(reps) { return reps[0].kind === kind; })[0];
+				if (!set) return;
+				const rep = kind === 'video' ? chooseVariant(set) : set[0];
+				// Манифест эфира перечитываем целиком; представление ищем по id
+				const track = dashTrack(res.url, function(m) {
+					for (let i = 0; i < m.sets.length; i++) {
+						for (let j = 0; j < m.sets[i].length; j++) {
+							if (m.sets[i][j].id === rep.id && m.sets[i][j].kind === kind) return m.sets[i][j];
+						}
+					}
+					throw new Error('DASH representation ' + rep.id + ' disappeared');
+				});
+				track.mime = (rep.mime || kind + '/mp4') + (rep.codecs ? '; codecs="' + rep.codecs + '"' : '');
+				tracks.push(track);
+			});
+			if (!tracks.length) throw new Error('DASH manifest has no audio or video');
+			return tracks;
+		});
+	}
+
+	// --- Загрузка сегментов в MediaSource ---
+
+	function append(sb, data) {
+		return new Promise(function(resolve, reject) {
+			sb.addEventListener('updateend', resolve, {once: true});
+			sb.addEventListener('error', reject, {once: true});
+			sb.appendBuffer(data);
+		});
+	}
+
+	function remove(sb, start, end) {
+		return new Promise(function(resolve) {
+			sb.addEventListener('updateend', resolve, {once: true});
+			sb.remove(start, end);
+		});
+	}
+
+	function sleep(ms) {
+		return new Promise(function(resolve) { setTimeout(resolve, ms); });
+	}
+
+	// Сколько секунд впереди t уже в буфере
+	function aheadOf(ranges, t) {
+		for (let i = 0; i < ranges.length; i++) {
+			if (ranges.start(i) <= t + 0.5 && ranges.end(i) > t) return ranges.end(i) - t;
+		}
+		return 0;
+	}
+
+	// Одна дорожка: держит буфер на BUFFER_AHEAD секунд впереди
+	async function runTrack(ctx, track) {
+		const video = ctx.video;
+		const sb = ctx.ms.addSourceBuffer(track.mime);
+		let list = null;
+		let refreshAt = 0;
+		let initKey = '';
+		let next = null; // id следующего сегмента
+
+		while (!ctx.stopped) {
+			if (!list || (list.live && Date.now() >= refreshAt)) {
+				list = await track.refresh();
+				refreshAt = Date.now() + list.update * 1000;
+				if (list.live) {
+					ctx.setLive();
+				} else if (list.segments.length) {
+					const last = list.segments[list.segments.length - 1];
+					ctx.setDuration(last.start + last.duration);
+				}
+				if (next === null && list.segments.length) {
+					const i = list.live ? Math.max(0, list.segments.length - LIVE_SEGMENTS) : 0;
+					next = list.segments[i].id;
+				}
+			}
+
+			// Перемотка за пределы буфера: продолжаем с сегмента новой позиции
+			if (ctx.seekTo !== null && !list.live) {
+				const t = ctx.seekTo;
+				if (!aheadOf(sb.buffered, t)) {
+					const seg = list.segments.filter(function(s) { return s.start <= t + 0.1; }).pop();
+					if (seg) next = seg.id;
+				}
+				ctx.seeked(track);
+			}
+
+			const first = list.segments.length ? list.segments[0].id : 0;
+			if (list.live && next < first) {
+				// Отстали от окна эфира: прыгаем ближе к краю
+				next = list.segments[Math.max(0, list.segments.length - LIVE_SEGMENTS)].id;
+			}
+			const seg = list.segments.filter(function(s) { return s.id === next; })[0];
+
+			if (!seg) {
+				if (!list.live) {
+					ctx.finished(track);
+					await sleep(1000);
+				} else {
+					await sleep(Math.max(500, refreshAt - Date.now()));
+				}
+				continue;
+			}
+			if (aheadOf(sb.buffered, video.currentTime) > BUFFER_AHEAD) {
+				await sleep(1000);
+				continue;
+			}
+
+			// Просмотренное выкидываем, чтобы не упереться в квоту буфера
+			if (sb.buffered.length && sb.buffered.start(0) < video.currentTime - BUFFER_BEHIND) {
+				await remove(sb, 0, video.currentTime - BUFFER_BEHIND / 2);
+			}
+
+			const key = list.init ? list.init.url + '#' + (list.init.range || '') : '';
+			if (key && key !== initKey) {
+				await append(sb, await fetchBytes(list.init));
+				initKey = key;
+			}
+			await append(sb, await fetchBytes(seg));
+			next = seg.id + 1;
+			ctx.appended();
+		}
+	}
+
+	function busy(ms) {
+		return Array.prototype.some.call(ms.sourceBuffers, function(sb) { return sb.updating; });
+	}
+
+	function attachMSE(video, format, url, opts) {
+		const ms = new MediaSource();
+		const ctx = {
+			video: video,
+			ms: ms,
+			stopped: false,
+			live: false,
+			seekTo: null,
+			pendingSeek: [],
+			done: [],
+			tracks: [],
+			setLive: function() {
+				if (ctx.live) return;
+				ctx.live = true;
+				ctx.setDuration(Infinity);
+				if (opts.onLive) opts.onLive();
+			},
+			setDuration: function(d) {
+				if (ms.readyState === 'open' && !busy(ms) && !(ms.duration >= d)) {
+					try { ms.duration = d; } catch (err) { /* обновится со следующим плейлистом */ }
+				}
+			},
+			seeked: function(track) {
+				ctx.pendingSeek = ctx.pendingSeek.filter(function(t) { return t !== track; });
+				if (!ctx.pendingSeek.length) ctx.seekTo = null;
+			},
+			finished: function(track) {
+				if (ctx.done.indexOf(track) < 0) ctx.done.push(track);
+				if (ctx.done.length === ctx.tracks.length && ms.readyState === 'open' && !busy(ms)) {
+					ms.endOfStream();
+				}
+			},
+			appended: function() {
+				// Первые сегменты эфира начинаются не с нуля
+				const b = video.buffered;
+				if (b.length && video.currentTime < b.start(0)) video.currentTime = b.start(0);
+			}
+		};
+
+		video.addEventListener('seeking', function() {
+			ctx.seekTo = video.currentTime;
+			ctx.pendingSeek = ctx.tracks.slice();
+			// После конца потока перемотка назад снова требует загрузки
+			ctx.done = [];
+		});
+
+		video.removeAttribute('src');
+		Array.prototype.forEach.call(video.querySelectorAll('source'), function(s) { s.remove(); });
+		video.src = URL.createObjectURL(ms);
+
+		ms.addEventListener('sourceopen', function() {
+			URL.revokeObjectURL(video.src);
+			const load = format === 'dash' ? loadDASH(url) : loadHLS(url);
+			load.then(function(tracks) {
+				tracks.forEach(function(track) {
+					if (!MediaSource.isTypeSupported(track.mime)) {
+						throw new Error('this browser can\'t play ' + track.mime);
+					}
+				});
+				ctx.tracks = tracks;
+				return Promise.all(tracks.map(function(track) { return runTrack(ctx, track); }));
+			}).catch(function(err) {
+				if (ctx.stopped) return;
+				ctx.stopped = true;
+				if (opts.onError) opts.onError(err);
+			});
+		}, {once: true});
+
+		return ctx;
+	}
+
+	function liveEdge(video) {
+		const r = video.seekable.length ? video.seekable : video.buffered;
+		if (!r.length) return;
+		// Секунда до края, чтобы не упираться в недозагруженный сегмент
+		video.currentTime = Math.max(r.start(r.length - 1), r.end(r.length - 1) - 1);
+	}
+
+	return {
+		// Умеет ли браузер играть такой поток сам, без MSE
+		native: function(video, format) {
+			return format === 'hls' && video.canPlayType('application/vnd.apple.mpegurl') !== '';
+		},
+
+		attach: function(video, url, format, opts) {
+			opts = opts || {};
+			if (this.native(video, format)) {
+				// Встроенный HLS: <source> уже на месте
+				video.addEventListener('loadedmetadata', function() {
+					if (video.duration === Infinity && opts.onLive) opts.onLive();
+				}, {once: true});
+				return {goLive: function() { liveEdge(video); }, destroy: function() {}};
+			}
+			if (!window.MediaSource) {
+				if (opts.onError) opts.onError(new Error('this browser can\'t play ' + format.toUpperCase() + ' streams'));
+				return {goLive: function() {}, destroy: function() {}};
+			}
+			const ctx = attachMSE(video, format, url, opts);
+			return {
+				goLive: function() { liveEdge(video); },
+				destroy: function() { ctx.stopped = true; }
+			};
+		}
+	};
+})();
@@ -0,0 +1,153 @@
+// Загрузка видео в медиатеку по протоколу tus 1.0.
+//
+//   Upload.start(file, endpoint, meta, opts) -> Promise<{roomId}>
+//     meta            — filename, owner, roomName
+//     opts.onProgress(sent, total)
+//
+// Адрес начатой загрузки запоминается в localStorage по имени, размеру и
+// времени изменения файла: если вкладку закрыли или пропала сеть, тот же
+// файл продолжится с места, где остановился. Куски подписываются SHA-256,
+// если браузер умеет crypto.subtle (только HTTPS и localhost).
+const Upload = (function() {
+	'use strict';
+
+	const TUS = '1.0.0';
+	const CHUNK = 8 << 20;      // байт за один PATCH
+	const RETRIES = 5;          // попыток на кусок
+	const RETRY_DELAY = 2000;   // мс, растёт с каждой попыткой
+	const CHECKSUM_MISMATCH = 460;
+
+	function storageKey(file) {
+		return 'upload:' + file.name + ':' + file.size + ':' + file.lastModified;
+	}
+
+	// Ответ сервера с текстом ошибки из JSON, если он есть
+	function fail(resp) {
+		return resp.json().catch(function() { return {}; }).then(function(body) {
+			const err = new Error(body.error || 'Upload failed: HTTP ' + resp.status);
+			err.status = resp.status;
+			throw err;
+		});
+	}
+
+	function request(method, url, headers, body) {
+		headers['Tus-Resumable'] = TUS;
+		return fetch(url, {method: method, headers: headers, body: body});
+	}
+
+	function encodeMeta(meta) {
+		return Object.keys(meta).filter(function(k) { return meta[k]; }).map(function(k) {
+			const bytes = new TextEncoder().encode(meta[k]);
+			let bin = '';
+			bytes.forEach(function(b) { bin += String.fromCharCode(b); });
+			return k + ' ' + btoa(bin);
+		}).join(',');
+	}
+
+	function checksum(buf) {
+		if (!window.crypto || !crypto.subtle) return Promise.resolve(null);
+		return crypto.subtle.digest('SHA-256', buf).then(function(sum) {
+			let bin = '';
+			new Uint8Array(sum).forEach(function(b) { bin += String.fromCharCode(b); });
+			return 'sha256 ' + btoa(bin);
+		});
+	}
+
+	function sleep(ms) {
+		return new Promise(function(resolve) { setTimeout(resolve, ms); });
+	}
+
+	// Смещение уже начатой загрузки; null — её на сервере больше нет
+	function resume(url) {
+		return request('HEAD', url, {}).then(function(resp) {
+			if (!resp.ok) return null;
+			return {
+				offset: Number(resp.headers.get('Upload-Offset')),
+				roomId: resp.headers.get('Upload-Room'),
+			};
+		}).catch(function() { return null; });
+	}
+
+	function create(file, endpoint, meta) {
+		return request('POST', endpoint, {
+			'Upload-Length': String(file.size),
+			'Upload-Metadata': encodeMeta(meta),
+		}).then(function(resp) {
+			if (resp.status !== 201) return fail(resp);
+			return new URL(resp.headers.get('Location'), location.href).href;
+		});
+	}
+
+	// Кусок с offset; повторяется при обрыве сети и несовпадении суммы.
+	// Возвращает новое смещение и комнату, если файл загружен целиком.
+	function sendChunk(file, url, offset, attempt) {
+		const blob = file.slice(offset, offset + CHUNK);
+		return blob.arrayBuffer().then(function(buf) {
+			return checksum(buf).then(function(sum) {
+				const headers = {
+					'Content-Type': 'application/offset+octet-stream',
+					'Upload-Offset': String(offset),
+				};
+				if (sum) headers['Upload-Checksum'] = sum;
+				return request('PATCH', url, headers, buf);
+			});
+		}).then(function(resp) {
+			if (resp.ok) {
+				return {
+					offset: Number(resp.headers.get('Upload-Offset')),
+					roomId: resp.headers.get('Upload-Room'),
+				};
+			}
+			if (resp.status !== CHECKSUM_MISMATCH && resp.status !== 409 && resp.status < 500) return fail(resp);
+			throw Object.assign(new Error('Upload failed: HTTP ' + resp.status), {retry: true});
+		}).catch(function(err) {
+			// Обрыв сети fetch отдаёт как TypeError
+			if (!(err.retry || err instanceof TypeError) || attempt >= RETRIES) throw err;
+			return sleep(RETRY_DELAY * (attempt + 1)).then(function() {
+				// Часть куска могла дойти: спрашиваем сервер, откуда продолжать
+				return resume(url);
+			}).then(function(state) {
+				if (!state) throw new Error('The upload expired, please start again');
+				if (state.roomId) return state;
+				return sendChunk(file, url, state.offset, attempt + 1);
+			});
+		});
+	}
+
+	function start(file, endpoint, meta, opts) {
+		opts = opts || {};
+		const progress = opts.onProgress || function() {};
+		const key = storageKey(file);
+		const saved = localStorage.getItem(key);
+
+		let url;
+		return (saved ? resume(saved) : Promise.resolve(null)).then(function(state) {
+			if (state) {
+				url = saved;
+				return state;
+			}
+			return create(file, endpoint, meta).then(function(created) {
+				url = created;
+				localStorage.setItem(key, url);
+				return {offset: 0, roomId: null};
+			});
+		}).then(function loop(state) {
+			progress(state.offset, file.size);
+			if (state.roomId) {
+				localStorage.removeItem(key);
+				return {roomId: state.roomId};
+			}
+			if (state.offset >= file.size) {
+				localStorage.removeItem(key);
+				throw new Error('The video was uploaded, but no room could be created for it');
+			}
+			return sendChunk(file, url, state.offset, 0).then(loop);
+		}).catch(function(err) {
+			// Отвергнутую загрузку продолжать бессмысленно
+			if (err.status) localStorage.removeItem(key);
+			throw err;
+		});
+	}
+
+	return {start: start};
+})();
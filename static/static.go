@@ -0,0 +1,10 @@
+// Пакет static хранит CSS и JavaScript страниц. Сервер раздаёт их
+// под именами с хешем содержимого, поэтому кэшировать можно навсегда.
+//
+// Сжатые версии (brotli и gzip) сервер готовит сам при запуске.
+package static
+
+import "embed"
+
+//go:embed css js
+var FS embed.FS
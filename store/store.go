@@ -0,0 +1,234 @@
+// Пакет store хранит данные комнат между перезапусками сервера.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"main.go/protocol"
+)
+
+var ErrNotFound = errors.New("store: room not found")
+
+// Сохраняемая часть комнаты (без подключений)
+type Room struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	VideoURL  string    `json:"videoUrl"`
+	MediaID   string    `json:"mediaId,omitempty"` // файл медиатеки сервера вместо VideoURL
+	Owner     string    `json:"owner"`
+	OwnerKey  string    `json:"ownerKey,omitempty"` // SHA-256 секрета владельца
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Для прямых ссылок на файлы
+	VideoType string        `json:"videoType,omitempty"` // MIME основного файла
+	Sources   []VideoSource `json:"sources,omitempty"`   // альтернативные файлы
+	Poster    string        `json:"poster,omitempty"`    // картинка до начала просмотра
+	Proxy     bool          `json:"proxy,omitempty"`     // файл идёт браузеру через сервер
+
+	Stream *StreamInfo `json:"stream,omitempty"` // разбор манифеста HLS/DASH
+	File   *FileInfo   `json:"file,omitempty"`   // разбор заголовков файла
+
+	Chat  *protocol.ChatPolicy `json:"chat,omitempty"`  // nil — правила сервера по умолчанию
+	Words *WordList            `json:"words,omitempty"` // nil — список слов сервера
+
+	Subtitles       []Subtitle `json:"subtitles,omitempty"`
+	DefaultSubtitle string     `json:"defaultSubtitle,omitempty"` // ID дорожки, включённой по умолчанию
+}
+
+// Альтернативный источник видео: браузер выберет первый, который умеет играть
+type VideoSource struct {
+	URL  string `json:"url"`
+	Type string `json:"type,omitempty"`
+}
+
+// Что сервер узнал из манифеста HLS или DASH
+type StreamInfo struct {
+	Format     string      `json:"format"`             // hls или dash
+	Live       bool        `json:"live"`               // эфир: манифест ещё дописывается
+	Duration   float64     `json:"duration,omitempty"` // секунды; у эфира 0
+	Renditions []Rendition `json:"renditions,omitempty"`
+	Origins    []string    `json:"origins,omitempty"` // откуда грузятся плейлисты и сегменты; для connect-src
+}
+
+// Один из вариантов качества потока
+type Rendition struct {
+	Bandwidth int    `json:"bandwidth"` // бит/с
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	Codecs    string `json:"codecs,omitempty"`
+}
+
+// Что сервер узнал из заголовков видеофайла
+type FileInfo struct {
+	Duration float64  `json:"duration,omitempty"` // секунды; 0 — не записана
+	Width    int      `json:"width,omitempty"`
+	Height   int      `json:"height,omitempty"`
+	Codecs   []string `json:"codecs,omitempty"` // RFC 6381: avc1.64001f, mp4a.40.2
+}
+
+// Дорожка субтитров; SRT сервер переводит в WebVTT при загрузке
+type Subtitle struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	Lang  string `json:"lang,omitempty"`
+	VTT   string `json:"vtt"`
+}
+
+// Список слов фильтра чата для комнаты
+type WordList struct {
+	Action  string   `json:"action,omitempty"` // mask, reject или flag; пусто — как у сервера
+	Words   []string `json:"words"`
+	Replace bool     `json:"replace,omitempty"` // заменить список сервера, а не дополнить
+}
+
+type Store interface {
+	List() ([]Room, error)
+	Get(id string) (Room, error)
+	Put(room Room) error
+	Delete(id string) error
+	// Ping проверяет, что хранилище доступно
+	Ping() error
+}
+
+// Хранилище в памяти: ничего не переживает перезапуск
+type Memory struct {
+	mu    sync.RWMutex
+	rooms map[string]Room
+}
+
+func NewMemory() *Memory {
+	return &Memory{rooms: make(map[string]Room)}
+}
+
+func (m *Memory) List() ([]Room, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]Room, 0, len(m.rooms))
+	for _, r := range m.rooms {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+func (m *Memory) Get(id string) (Room, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, ok := m.rooms[id]
+	if !ok {
+		return Room{}, ErrNotFound
+	}
+	return r, nil
+}
+
+func (m *Memory) Put(room Room) error {
+	m.mu.Lock()
+	m.rooms[room.ID] = room
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) Ping() error {
+	return nil
+}
+
+func (m *Memory) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.rooms, id)
+	return nil
+}
+
+// Хранилище в JSON-файле; каждое изменение переписывает файл целиком
+type File struct {
+	Memory
+	path string
+	wmu  sync.Mutex
+}
+
+// OpenFile загружает комнаты из path; отсутствующий файл — пустое хранилище
+func OpenFile(path string) (*File, error) {
+	f := &File{path: path}
+	f.rooms = make(map[string]Room)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Room
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for _, r := range list {
+		f.rooms[r.ID] = r
+	}
+	return f, nil
+}
+
+func (f *File) Put(room Room) error {
+	f.Memory.Put(room)
+	return f.save()
+}
+
+func (f *File) Delete(id string) error {
+	if err := f.Memory.Delete(id); err != nil {
+		return err
+	}
+	return f.save()
+}
+
+// Каталог файла должен существовать и быть доступен для записи
+func (f *File) Ping() error {
+	dir := filepath.Dir(f.path)
+	tmp, err := os.CreateTemp(dir, ".ping-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
+
+// Запись через временный файл, чтобы не оставить полузаписанный JSON
+func (f *File) save() error {
+	f.wmu.Lock()
+	defer f.wmu.Unlock()
+
+	list, _ := f.List()
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,9 @@
+// Пакет templates хранит HTML-шаблоны страниц. Каждая страница
+// определяет блоки "title", "head" и "content", которые подставляются
+// в общий макет "base" из base.html.
+package templates
+
+import "embed"
+
+//go:embed *.html
+var FS embed.FS
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Как часто при рукопожатии проверять, не сменились ли файлы
+const certCheckInterval = 10 * time.Second
+
+// Отдаёт сертификат из файлов и перечитывает их, когда они меняются
+// (например, после продления certbot), без перезапуска сервера.
+// Если новая пара не загружается, продолжаем работать со старой.
+type certReloader struct {
+	certFile, keyFile string
+	logger            *slog.Logger
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(certFile, keyFile string, logger *slog.Logger) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.cert = &cert
+	c.modTime = c.latestModTime()
+	c.checkedAt = time.Now()
+	return nil
+}
+
+func (c *certReloader) latestModTime() time.Time {
+	var latest time.Time
+	for _, name := range []string{c.certFile, c.keyFile} {
+		if fi, err := os.Stat(name); err == nil && fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.checkedAt) < certCheckInterval {
+		return c.cert, nil
+	}
+	c.checkedAt = time.Now()
+	if !c.latestModTime().After(c.modTime) {
+		return c.cert, nil
+	}
+
+	if err := c.load(); err != nil {
+		c.logger.Error("reloading TLS certificate failed, keeping the old one", "cert", c.certFile, "err", err)
+		return c.cert, nil
+	}
+	c.logger.Info("TLS certificate reloaded", "cert", c.certFile)
+	return c.cert, nil
+}